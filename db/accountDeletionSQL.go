@@ -0,0 +1,266 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nest/models"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	ErrDeletionAlreadyScheduled = errors.New("account deletion is already scheduled")
+	ErrNoDeletionScheduled      = errors.New("account deletion is not scheduled")
+)
+
+// ScheduleUserDeletion sets when the account will be purged, refusing to schedule the last super admin
+func ScheduleUserDeletion(ctx context.Context, userID int, purgeAt time.Time) error {
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the super admin rows the same way SetUserRole does
+	var superAdmins int
+	err = tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM (
+			SELECT id FROM users WHERE role = $1 AND NOT disabled AND deletion_scheduled_at IS NULL FOR UPDATE
+		) sa
+	`, models.SuperAdmin).Scan(&superAdmins)
+	if err != nil {
+		return fmt.Errorf("failed to count super admins: %w", err)
+	}
+
+	var role models.Role
+	var scheduledAt *time.Time
+	err = tx.QueryRow(ctx, `
+		SELECT role, deletion_scheduled_at FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE
+	`, userID).Scan(&role, &scheduledAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return errors.New("user not found")
+		}
+		return fmt.Errorf("query error: %w", err)
+	}
+
+	if scheduledAt != nil {
+		return ErrDeletionAlreadyScheduled
+	}
+	if role == models.SuperAdmin && superAdmins <= 1 {
+		return ErrLastSuperAdmin
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE users SET deletion_scheduled_at = $1 WHERE id = $2`, purgeAt, userID); err != nil {
+		return fmt.Errorf("failed to schedule user deletion: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+func CancelUserDeletion(ctx context.Context, userID int) error {
+	query := `
+		UPDATE users
+		SET deletion_scheduled_at = NULL
+		WHERE id = $1 AND deletion_scheduled_at IS NOT NULL AND deleted_at IS NULL
+	`
+	tag, err := Pool.Exec(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel user deletion: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoDeletionScheduled
+	}
+
+	return nil
+}
+
+// GetUsersDueForPurge returns the accounts whose grace period has ended
+func GetUsersDueForPurge(ctx context.Context) ([]int, error) {
+	query := `
+		SELECT id
+		FROM users
+		WHERE deletion_scheduled_at <= NOW() AND deleted_at IS NULL
+		ORDER BY deletion_scheduled_at
+	`
+	rows, err := Pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	var userIDs []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("failed to scan user row: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, rows.Err()
+}
+
+// PurgeUser removes the account's personal data and turns the row into an anonymous placeholder, so the
+// events and groups it created keep a valid creator. Audit events are append-only and keep referring to the ID.
+func PurgeUser(ctx context.Context, userID int, unusablePasswordHash []byte) error {
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// The deletion may have been cancelled since the purge job listed the account
+	var due bool
+	err = tx.QueryRow(ctx, `
+		SELECT deletion_scheduled_at <= NOW() AND deleted_at IS NULL FROM users WHERE id = $1 FOR UPDATE
+	`, userID).Scan(&due)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return errors.New("user not found")
+		}
+		return fmt.Errorf("query error: %w", err)
+	}
+	if !due {
+		return ErrNoDeletionScheduled
+	}
+
+	personalTables := []string{
+		"sessions",
+		"personal_access_tokens",
+		"password_reset_codes",
+		"magic_links",
+		"email_reverts",
+		"user_totp",
+		"user_recovery_codes",
+		"two_factor_challenges",
+		"user_identities",
+		"webauthn_credentials",
+		"webauthn_challenges",
+		"group_memberships",
+		"event_attendance",
+		"event_reactions",
+	}
+	for _, table := range personalTables {
+		if _, err := tx.Exec(ctx, `DELETE FROM `+table+` WHERE user_id = $1`, userID); err != nil {
+			return fmt.Errorf("failed to purge %s: %w", table, err)
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE users
+		SET first_name = 'deleted',
+			last_name = 'user',
+			username = 'deleted_user_' || id,
+			email = 'deleted_user_' || id || '@deleted.invalid',
+			password_hash = $2,
+			role = $3,
+			disabled = TRUE,
+			password_reset_required = FALSE,
+			email_verified_at = NULL,
+			pending_email = NULL,
+			display_name = '',
+			bio = '',
+			timezone = '',
+			avatar_key = NULL,
+			avatar_updated_at = NULL,
+			failed_login_attempts = 0,
+			last_failed_login_at = NULL,
+			locked_until = NULL,
+			deletion_scheduled_at = NULL,
+			deleted_at = NOW()
+		WHERE id = $1
+	`, userID, unusablePasswordHash, models.Member)
+	if err != nil {
+		return fmt.Errorf("failed to anonymize user: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetGroupMembershipsForUser lists the groups the user belongs to with their role in each
+func GetGroupMembershipsForUser(ctx context.Context, userID int) ([]models.GroupMembership, error) {
+	query := `
+		SELECT g.id, g.group_name, gm.role_in_group
+		FROM groups g
+		INNER JOIN group_memberships gm ON g.id = gm.group_id
+		WHERE gm.user_id = $1
+		ORDER BY g.id
+	`
+	rows, err := Pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get memberships for user %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	memberships := []models.GroupMembership{}
+	for rows.Next() {
+		var membership models.GroupMembership
+		if err := rows.Scan(&membership.GroupID, &membership.GroupName, &membership.Role); err != nil {
+			return nil, fmt.Errorf("failed to scan membership row: %w", err)
+		}
+		memberships = append(memberships, membership)
+	}
+
+	return memberships, rows.Err()
+}
+
+func GetAttendanceForUser(ctx context.Context, userID int) ([]models.EventAttendance, error) {
+	query := `
+		SELECT id, user_id, event_id, status, created_at
+		FROM event_attendance
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+	rows, err := Pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attendance for user %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	attendances := []models.EventAttendance{}
+	for rows.Next() {
+		var attendance models.EventAttendance
+		err := rows.Scan(
+			&attendance.ID,
+			&attendance.UserID,
+			&attendance.EventID,
+			&attendance.Status,
+			&attendance.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan attendance row: %w", err)
+		}
+		attendances = append(attendances, attendance)
+	}
+
+	return attendances, rows.Err()
+}
+
+func GetReactionsByUser(ctx context.Context, userID int) ([]models.UserReaction, error) {
+	query := `
+		SELECT user_id, reaction, event_id
+		FROM event_reactions
+		WHERE user_id = $1
+		ORDER BY event_id
+	`
+	rows, err := Pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reactions for user %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	reactions := []models.UserReaction{}
+	for rows.Next() {
+		var reaction models.UserReaction
+		if err := rows.Scan(&reaction.UserID, &reaction.Reaction, &reaction.EventID); err != nil {
+			return nil, fmt.Errorf("failed to scan reaction row: %w", err)
+		}
+		reactions = append(reactions, reaction)
+	}
+
+	return reactions, rows.Err()
+}
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"nest/models"
+	"strings"
+)
+
+func CreateAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	query := `
+		INSERT INTO audit_events (actor_id, impersonator_id, action, target_type, target_id, group_id, before, after, metadata, ip, user_agent)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id, created_at
+	`
+
+	err := Pool.QueryRow(
+		ctx,
+		query,
+		event.ActorID,
+		event.ImpersonatorID,
+		event.Action,
+		event.TargetType,
+		event.TargetID,
+		event.GroupID,
+		nullableJSON(event.Before),
+		nullableJSON(event.After),
+		nullableJSON(event.Metadata),
+		event.IP,
+		event.UserAgent,
+	).Scan(&event.ID, &event.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create audit event: %w", err)
+	}
+
+	return nil
+}
+
+// nullableJSON stores an empty snapshot as NULL rather than invalid JSON
+func nullableJSON(data []byte) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
+
+// GetAuditEvents returns a page of audit events matching the filter, newest first, along with the total match count
+func GetAuditEvents(ctx context.Context, filter models.AuditFilter, limit, offset int) ([]models.AuditEvent, int, error) {
+	// Build dynamic query based on provided filters
+	conditions := make([]string, 0)
+	args := make([]interface{}, 0)
+	argPosition := 1
+
+	if filter.ActorID != nil {
+		conditions = append(conditions, fmt.Sprintf("actor_id = $%d", argPosition))
+		args = append(args, *filter.ActorID)
+		argPosition++
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, fmt.Sprintf("action = $%d", argPosition))
+		args = append(args, filter.Action)
+		argPosition++
+	}
+	if filter.TargetType != "" {
+		conditions = append(conditions, fmt.Sprintf("target_type = $%d", argPosition))
+		args = append(args, filter.TargetType)
+		argPosition++
+	}
+	if filter.TargetID != nil {
+		conditions = append(conditions, fmt.Sprintf("target_id = $%d", argPosition))
+		args = append(args, *filter.TargetID)
+		argPosition++
+	}
+	if filter.GroupID != nil {
+		conditions = append(conditions, fmt.Sprintf("group_id = $%d", argPosition))
+		args = append(args, *filter.GroupID)
+		argPosition++
+	}
+	if filter.Since != nil {
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", argPosition))
+		args = append(args, *filter.Since)
+		argPosition++
+	}
+	if filter.Until != nil {
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", argPosition))
+		args = append(args, *filter.Until)
+		argPosition++
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	err := Pool.QueryRow(ctx, `SELECT COUNT(*) FROM audit_events `+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit events: %w", err)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, created_at, actor_id, impersonator_id, action, target_type, target_id, group_id, before, after, metadata, ip, user_agent
+		FROM audit_events
+		%s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d OFFSET $%d
+	`, where, argPosition, argPosition+1)
+
+	args = append(args, limit, offset)
+
+	rows, err := Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get audit events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+
+	for rows.Next() {
+		var event models.AuditEvent
+		var before, after, metadata []byte
+		err = rows.Scan(
+			&event.ID,
+			&event.CreatedAt,
+			&event.ActorID,
+			&event.ImpersonatorID,
+			&event.Action,
+			&event.TargetType,
+			&event.TargetID,
+			&event.GroupID,
+			&before,
+			&after,
+			&metadata,
+			&event.IP,
+			&event.UserAgent,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan audit event row: %w", err)
+		}
+		event.Before, event.After, event.Metadata = before, after, metadata
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating audit event rows: %w", err)
+	}
+
+	return events, total, nil
+}
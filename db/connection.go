@@ -16,4 +16,8 @@ func InitDB(connStr string) {
 		log.Fatalf("Unable to connect to database: %v\n", err)
 	}
 	log.Println("Connected to the database!")
+
+	if err := Migrate(context.Background()); err != nil {
+		log.Fatalf("Unable to migrate database: %v\n", err)
+	}
 }
@@ -0,0 +1,167 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// Postgres reports this code when an insert or update breaks a unique index
+const uniqueViolation = "23505"
+
+var (
+	ErrEmailTaken         = errors.New("email is already in use")
+	ErrInvalidEmailRevert = errors.New("email revert link is invalid, expired, already used or out of date")
+)
+
+// SetPendingEmail records an email change that only takes effect once the new address is verified
+func SetPendingEmail(ctx context.Context, userID int, email string) error {
+	query := `
+		UPDATE users
+		SET pending_email = $1
+		WHERE id = $2
+	`
+	_, err := Pool.Exec(ctx, query, email, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set pending email: %w", err)
+	}
+
+	return nil
+}
+
+func MarkEmailVerified(ctx context.Context, userID int) error {
+	query := `
+		UPDATE users
+		SET email_verified_at = NOW()
+		WHERE id = $1
+	`
+	_, err := Pool.Exec(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark email verified: %w", err)
+	}
+
+	return nil
+}
+
+// ConfirmEmail verifies the address the user was sent a link for. If it is their pending address it replaces
+// the current one, in which case the previous address is returned so it can be told about the change.
+func ConfirmEmail(ctx context.Context, userID int, email string) (string, error) {
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var currentEmail string
+	var pendingEmail *string
+	err = tx.QueryRow(ctx, `SELECT email, pending_email FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&currentEmail, &pendingEmail)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return "", errors.New("user not found")
+		}
+		return "", fmt.Errorf("query error: %w", err)
+	}
+
+	previousEmail := ""
+	switch {
+	case pendingEmail != nil && *pendingEmail == email:
+		_, err = tx.Exec(ctx, `
+			UPDATE users
+			SET email = pending_email, pending_email = NULL, email_verified_at = NOW()
+			WHERE id = $1
+		`, userID)
+		previousEmail = currentEmail
+	case currentEmail == email:
+		_, err = tx.Exec(ctx, `UPDATE users SET email_verified_at = NOW() WHERE id = $1`, userID)
+	default:
+		return "", errors.New("email no longer matches the account")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to confirm email: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("failed to commit email confirmation: %w", err)
+	}
+
+	return previousEmail, nil
+}
+
+// CreateEmailRevert records the link sent to the previous address after an email change and returns its ID
+func CreateEmailRevert(ctx context.Context, userID int, previousEmail, changedTo string, expiresAt time.Time) (int, error) {
+	query := `
+		INSERT INTO email_reverts (user_id, previous_email, changed_to, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+	var revertID int
+	err := Pool.QueryRow(ctx, query, userID, previousEmail, changedTo, expiresAt).Scan(&revertID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to store email revert: %w", err)
+	}
+
+	return revertID, nil
+}
+
+// RevertEmail uses a revert link to restore the previous address and cancel any pending change, returning the
+// user and the restored address. A link works once, and only while the account still has the address it undoes,
+// so an old link can't roll back a change the owner made later on purpose.
+func RevertEmail(ctx context.Context, revertID int) (int, string, error) {
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var userID int
+	var previousEmail, changedTo string
+	err = tx.QueryRow(ctx, `
+		UPDATE email_reverts
+		SET consumed_at = NOW()
+		WHERE id = $1 AND consumed_at IS NULL AND expires_at > NOW()
+		RETURNING user_id, previous_email, changed_to
+	`, revertID).Scan(&userID, &previousEmail, &changedTo)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, "", ErrInvalidEmailRevert
+		}
+		return 0, "", fmt.Errorf("failed to consume email revert: %w", err)
+	}
+
+	var taken bool
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM users WHERE email_normalized = lower($1) AND id <> $2)
+	`, previousEmail, userID).Scan(&taken)
+	if err != nil {
+		return 0, "", fmt.Errorf("query error: %w", err)
+	}
+	if taken {
+		return 0, "", ErrEmailTaken
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE users
+		SET email = $1, pending_email = NULL, email_verified_at = NOW()
+		WHERE id = $2 AND email = $3
+	`, previousEmail, userID, changedTo)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return 0, "", ErrEmailTaken
+		}
+		return 0, "", fmt.Errorf("failed to revert email: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return 0, "", ErrInvalidEmailRevert
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, "", fmt.Errorf("failed to commit email revert: %w", err)
+	}
+
+	return userID, previousEmail, nil
+}
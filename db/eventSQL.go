@@ -253,17 +253,17 @@ func UpdateEvent(ctx context.Context, eventID int, updates map[string]interface{
 
 	if name, ok := updates["name"].(string); ok {
 		setFields = append(setFields, fmt.Sprintf("name = $%d", argPosition))
-		args = append(args, strings.ToLower(name))
+		args = append(args, name)
 		argPosition++
 	}
 	if description, ok := updates["description"].(string); ok {
 		setFields = append(setFields, fmt.Sprintf("description = $%d", argPosition))
-		args = append(args, strings.ToLower(description))
+		args = append(args, description)
 		argPosition++
 	}
 	if location, ok := updates["location"].(string); ok {
 		setFields = append(setFields, fmt.Sprintf("location = $%d", argPosition))
-		args = append(args, strings.ToLower(location))
+		args = append(args, location)
 		argPosition++
 	}
 
@@ -211,45 +211,30 @@ func GetAllGroups(ctx context.Context) ([]models.Group, error) {
 	return groups, nil
 }
 
-func GetAllMembersForGroup(ctx context.Context, groupID int) ([]models.User, error) {
+func GetAllMembersForGroup(ctx context.Context, groupID int, viewer models.Viewer) ([]models.User, error) {
 	query := `
-		SELECT u.id, u.username, u.email, u.first_name, u.last_name, u.role, u.created_at
+		SELECT ` + visibleUserColumns + `
 		FROM users u
 		JOIN group_memberships gm ON u.id = gm.user_id
 		WHERE gm.group_id = $1;
 	`
 
-	rows, err := Pool.Query(ctx, query, groupID)
+	rows, err := Pool.Query(ctx, query, groupID, viewer.UserID, viewer.IsSuperAdmin)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
 	defer rows.Close()
 
-	var users []models.User
-
-	for rows.Next() {
-		var user models.User
-		err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.FirstName, &user.LastName, &user.Role, &user.CreatedAt)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan row: %w", err)
-		}
-
-		users = append(users, user)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating rows: %w", err)
-	}
-
-	return users, nil
+	return scanVisibleUsers(rows)
 }
 
-func GetAllNonMembersForGroup(ctx context.Context, groupID int) ([]models.User, error) {
+// GetVerifiedEmailsForGroup returns the addresses of group members that have verified their email
+func GetVerifiedEmailsForGroup(ctx context.Context, groupID int) ([]string, error) {
 	query := `
-		SELECT u.id, u.username, u.email, u.first_name, u.last_name, u.role, u.created_at
+		SELECT u.email
 		FROM users u
-		LEFT JOIN group_memberships gm ON u.id = gm.user_id AND gm.group_id = $1
-		WHERE gm.user_id IS NULL;
+		JOIN group_memberships gm ON u.id = gm.user_id
+		WHERE gm.group_id = $1 AND u.email_verified_at IS NOT NULL;
 	`
 
 	rows, err := Pool.Query(ctx, query, groupID)
@@ -258,88 +243,73 @@ func GetAllNonMembersForGroup(ctx context.Context, groupID int) ([]models.User,
 	}
 	defer rows.Close()
 
-	var users []models.User
+	var emails []string
 
 	for rows.Next() {
-		var user models.User
-		err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.FirstName, &user.LastName, &user.Role, &user.CreatedAt)
-		if err != nil {
+		var email string
+		if err := rows.Scan(&email); err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
-		users = append(users, user)
+
+		emails = append(emails, email)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating rows: %w", err)
 	}
 
-	return users, nil
+	return emails, nil
 }
 
-func GetAllNonAdminMembersForGroup(ctx context.Context, groupID int) ([]models.User, error) {
+func GetAllNonMembersForGroup(ctx context.Context, groupID int, viewer models.Viewer) ([]models.User, error) {
 	query := `
-		SELECT u.id, u.username, u.email, u.first_name, u.last_name, u.role, u.created_at
+		SELECT ` + visibleUserColumns + `
 		FROM users u
-		JOIN group_memberships gm ON u.id = gm.user_id
-		WHERE gm.group_id = $1 and gm.role_in_group = 'member';
+		LEFT JOIN group_memberships gm ON u.id = gm.user_id AND gm.group_id = $1
+		WHERE gm.user_id IS NULL AND u.deleted_at IS NULL;
 	`
 
-	rows, err := Pool.Query(ctx, query, groupID)
+	rows, err := Pool.Query(ctx, query, groupID, viewer.UserID, viewer.IsSuperAdmin)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
 	defer rows.Close()
 
-	var users []models.User
-
-	for rows.Next() {
-		var user models.User
-		err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.FirstName, &user.LastName, &user.Role, &user.CreatedAt)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan row: %w", err)
-		}
+	return scanVisibleUsers(rows)
+}
 
-		users = append(users, user)
-	}
+func GetAllNonAdminMembersForGroup(ctx context.Context, groupID int, viewer models.Viewer) ([]models.User, error) {
+	query := `
+		SELECT ` + visibleUserColumns + `
+		FROM users u
+		JOIN group_memberships gm ON u.id = gm.user_id
+		WHERE gm.group_id = $1 and gm.role_in_group = 'member';
+	`
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating rows: %w", err)
+	rows, err := Pool.Query(ctx, query, groupID, viewer.UserID, viewer.IsSuperAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
+	defer rows.Close()
 
-	return users, nil
+	return scanVisibleUsers(rows)
 }
 
-func GetAllAdminMembersForGroup(ctx context.Context, groupID int) ([]models.User, error) {
+func GetAllAdminMembersForGroup(ctx context.Context, groupID int, viewer models.Viewer) ([]models.User, error) {
 	query := `
-		SELECT u.id, u.username, u.email, u.first_name, u.last_name, u.role, u.created_at
+		SELECT ` + visibleUserColumns + `
 		FROM users u
 		JOIN group_memberships gm ON u.id = gm.user_id
 		WHERE gm.group_id = $1 and gm.role_in_group != 'member';
 	`
 
-	rows, err := Pool.Query(ctx, query, groupID)
+	rows, err := Pool.Query(ctx, query, groupID, viewer.UserID, viewer.IsSuperAdmin)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
 	defer rows.Close()
 
-	var users []models.User
-
-	for rows.Next() {
-		var user models.User
-		err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.FirstName, &user.LastName, &user.Role, &user.CreatedAt)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan row: %w", err)
-		}
-
-		users = append(users, user)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating rows: %w", err)
-	}
-
-	return users, nil
+	return scanVisibleUsers(rows)
 }
 
 func IsUserGroupAdmin(ctx context.Context, userID, groupID int) (bool, error) {
@@ -477,3 +447,41 @@ func RemoveGroupAdmin(ctx context.Context, groupID, userID int) error {
 
 	return nil
 }
+
+// visibleUserColumns selects a user with their email and last name blanked unless the viewer in $2 and $3 may see them
+const visibleUserColumns = `u.id, u.username,
+	CASE WHEN user_field_visible(u.email_visibility, u.id, $2, $3) THEN u.email ELSE '' END,
+	u.first_name,
+	CASE WHEN user_field_visible(u.last_name_visibility, u.id, $2, $3) THEN u.last_name ELSE '' END,
+	u.role, u.created_at, u.display_name, u.bio, u.avatar_updated_at`
+
+func scanVisibleUsers(rows pgx.Rows) ([]models.User, error) {
+	var users []models.User
+
+	for rows.Next() {
+		var user models.User
+		err := rows.Scan(
+			&user.ID,
+			&user.Username,
+			&user.Email,
+			&user.FirstName,
+			&user.LastName,
+			&user.Role,
+			&user.CreatedAt,
+			&user.DisplayName,
+			&user.Bio,
+			&user.AvatarUpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return users, nil
+}
@@ -0,0 +1,182 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nest/models"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var ErrInvitationNotFound = errors.New("invitation not found")
+
+const invitationColumns = `id, email, group_id, invited_by, created_at, expires_at, accepted_at, accepted_user_id, revoked_at`
+
+func scanInvitation(row pgx.Row, invitation *models.Invitation) error {
+	return row.Scan(
+		&invitation.ID,
+		&invitation.Email,
+		&invitation.GroupID,
+		&invitation.InvitedByID,
+		&invitation.CreatedAt,
+		&invitation.ExpiresAt,
+		&invitation.AcceptedAt,
+		&invitation.AcceptedUserID,
+		&invitation.RevokedAt,
+	)
+}
+
+func queryInvitations(ctx context.Context, query string, args ...interface{}) ([]models.Invitation, error) {
+	rows, err := Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var invitations []models.Invitation
+
+	for rows.Next() {
+		var invitation models.Invitation
+		if err := scanInvitation(rows, &invitation); err != nil {
+			return nil, fmt.Errorf("failed to scan invitation row: %w", err)
+		}
+		invitations = append(invitations, invitation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating invitation rows: %w", err)
+	}
+
+	return invitations, nil
+}
+
+func CreateInvitation(ctx context.Context, invitation *models.Invitation) (*models.Invitation, error) {
+	query := `
+		INSERT INTO invitations (email, group_id, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	err := Pool.QueryRow(
+		ctx,
+		query,
+		invitation.Email,
+		invitation.GroupID,
+		invitation.InvitedByID,
+		invitation.ExpiresAt,
+	).Scan(&invitation.ID, &invitation.CreatedAt)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	return invitation, nil
+}
+
+func GetInvitationByID(ctx context.Context, invitationID int) (*models.Invitation, error) {
+	var invitation models.Invitation
+	query := `SELECT ` + invitationColumns + ` FROM invitations WHERE id = $1`
+
+	err := scanInvitation(Pool.QueryRow(ctx, query, invitationID), &invitation)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrInvitationNotFound
+		}
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	return &invitation, nil
+}
+
+// GetPendingInvitationByEmail returns the newest invitation for the email that can still be redeemed
+func GetPendingInvitationByEmail(ctx context.Context, email string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	query := `
+		SELECT ` + invitationColumns + `
+		FROM invitations
+		WHERE email = $1 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	err := scanInvitation(Pool.QueryRow(ctx, query, email), &invitation)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrInvitationNotFound
+		}
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	return &invitation, nil
+}
+
+func GetAllInvitations(ctx context.Context) ([]models.Invitation, error) {
+	query := `SELECT ` + invitationColumns + ` FROM invitations ORDER BY created_at DESC`
+	return queryInvitations(ctx, query)
+}
+
+func GetInvitationsForGroup(ctx context.Context, groupID int) ([]models.Invitation, error) {
+	query := `SELECT ` + invitationColumns + ` FROM invitations WHERE group_id = $1 ORDER BY created_at DESC`
+	return queryInvitations(ctx, query, groupID)
+}
+
+func RevokeInvitation(ctx context.Context, invitationID int) error {
+	query := `
+		UPDATE invitations
+		SET revoked_at = NOW()
+		WHERE id = $1 AND accepted_at IS NULL AND revoked_at IS NULL
+	`
+	_, err := Pool.Exec(ctx, query, invitationID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+
+	return nil
+}
+
+// RedeemInvitation creates the user, marks the invitation accepted and joins the inviting group in one transaction
+func RedeemInvitation(ctx context.Context, invitationID int, user *models.User) (*models.User, error) {
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO users (first_name, last_name, username, email, password_hash)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, user.FirstName, user.LastName, user.Username, user.Email, user.PasswordHash).Scan(&user.ID, &user.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	var groupID *int64
+	err = tx.QueryRow(ctx, `
+		UPDATE invitations
+		SET accepted_at = NOW(), accepted_user_id = $2
+		WHERE id = $1 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+		RETURNING group_id
+	`, invitationID, user.ID).Scan(&groupID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, errors.New("invitation is no longer valid")
+		}
+		return nil, fmt.Errorf("failed to accept invitation: %w", err)
+	}
+
+	if groupID != nil {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO group_memberships (group_id, user_id, role_in_group)
+			VALUES ($1, $2, $3)
+		`, *groupID, user.ID, models.Member)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add user to group: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit invitation: %w", err)
+	}
+
+	return user, nil
+}
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nest/models"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func GetLoginLockout(ctx context.Context, userID int) (*models.LoginLockout, error) {
+	var lockout models.LoginLockout
+	query := `
+		SELECT id, username, email, failed_login_attempts, last_failed_login_at, locked_until
+		FROM users
+		WHERE id = $1
+	`
+	err := Pool.QueryRow(ctx, query, userID).Scan(
+		&lockout.UserID,
+		&lockout.Username,
+		&lockout.Email,
+		&lockout.FailedAttempts,
+		&lockout.LastFailedLoginAt,
+		&lockout.LockedUntil,
+	)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, errors.New("user not found")
+		}
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	return &lockout, nil
+}
+
+// RecordFailedLogin counts a failed login, locking the account until lockedUntil once maxAttempts is reached.
+// The returned bool is true when this failure caused the lock.
+func RecordFailedLogin(ctx context.Context, userID, maxAttempts int, lockedUntil time.Time) (bool, error) {
+	query := `
+		UPDATE users
+		SET failed_login_attempts = CASE WHEN failed_login_attempts + 1 >= $2 THEN 0 ELSE failed_login_attempts + 1 END,
+			locked_until = CASE WHEN failed_login_attempts + 1 >= $2 THEN $3 ELSE locked_until END,
+			last_failed_login_at = NOW()
+		WHERE id = $1
+		RETURNING failed_login_attempts
+	`
+	var attempts int
+	err := Pool.QueryRow(ctx, query, userID, maxAttempts, lockedUntil).Scan(&attempts)
+	if err != nil {
+		return false, fmt.Errorf("failed to record failed login: %w", err)
+	}
+
+	return attempts == 0, nil
+}
+
+func ClearFailedLogins(ctx context.Context, userID int) error {
+	query := `
+		UPDATE users
+		SET failed_login_attempts = 0, last_failed_login_at = NULL, locked_until = NULL
+		WHERE id = $1
+	`
+	_, err := Pool.Exec(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to clear failed logins: %w", err)
+	}
+
+	return nil
+}
+
+func GetLockedUsers(ctx context.Context) ([]models.LoginLockout, error) {
+	query := `
+		SELECT id, username, email, failed_login_attempts, last_failed_login_at, locked_until
+		FROM users
+		WHERE locked_until > NOW()
+		ORDER BY locked_until DESC
+	`
+
+	rows, err := Pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var lockouts []models.LoginLockout
+
+	for rows.Next() {
+		var lockout models.LoginLockout
+		err := rows.Scan(
+			&lockout.UserID,
+			&lockout.Username,
+			&lockout.Email,
+			&lockout.FailedAttempts,
+			&lockout.LastFailedLoginAt,
+			&lockout.LockedUntil,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		lockouts = append(lockouts, lockout)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return lockouts, nil
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// magicLinkCooldown stops the login form from being used to flood someone's inbox
+const magicLinkCooldown = time.Minute
+
+var (
+	ErrMagicLinkCooldown = errors.New("a magic link was sent recently")
+	ErrInvalidMagicLink  = errors.New("magic link is invalid, expired or already used")
+)
+
+// CreateMagicLink records a login link for the user with the verified email, invalidating any earlier links,
+// and returns the link and user IDs
+func CreateMagicLink(ctx context.Context, email string, expiresAt time.Time) (int, int, error) {
+	var userID int
+	err := Pool.QueryRow(ctx, `SELECT id FROM users WHERE email_normalized = lower($1) AND email_verified_at IS NOT NULL`, email).Scan(&userID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, 0, ErrNoUserForEmail
+		}
+		return 0, 0, fmt.Errorf("query error: %w", err)
+	}
+
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Serialize requests for the same user so the cooldown can't be raced
+	if _, err := tx.Exec(ctx, `SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+		return 0, 0, fmt.Errorf("failed to lock user: %w", err)
+	}
+
+	var recent bool
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM magic_links WHERE user_id = $1 AND created_at > $2)
+	`, userID, time.Now().Add(-magicLinkCooldown)).Scan(&recent)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to check recent magic links: %w", err)
+	}
+	if recent {
+		return 0, 0, ErrMagicLinkCooldown
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE magic_links
+		SET consumed_at = NOW()
+		WHERE user_id = $1 AND consumed_at IS NULL
+	`, userID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to invalidate previous magic links: %w", err)
+	}
+
+	var linkID int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO magic_links (user_id, expires_at)
+		VALUES ($1, $2)
+		RETURNING id
+	`, userID, expiresAt).Scan(&linkID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to store magic link: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit magic link: %w", err)
+	}
+
+	return linkID, userID, nil
+}
+
+// ConsumeMagicLink marks the link as used and returns its user, failing if it was already used or has expired
+func ConsumeMagicLink(ctx context.Context, linkID int) (int, error) {
+	query := `
+		UPDATE magic_links
+		SET consumed_at = NOW()
+		WHERE id = $1 AND consumed_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`
+	var userID int
+	err := Pool.QueryRow(ctx, query, linkID).Scan(&userID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, ErrInvalidMagicLink
+		}
+		return 0, fmt.Errorf("failed to consume magic link: %w", err)
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS sessions (
+	id                 TEXT PRIMARY KEY,
+	user_id            INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	refresh_token_hash TEXT NOT NULL,
+	user_agent         TEXT NOT NULL DEFAULT '',
+	ip                 TEXT NOT NULL DEFAULT '',
+	created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	last_used_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at         TIMESTAMPTZ NOT NULL,
+	revoked_at         TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS password_reset_codes (
+	id          SERIAL PRIMARY KEY,
+	user_id     INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	code_hash   TEXT NOT NULL,
+	attempts    INTEGER NOT NULL DEFAULT 0,
+	created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at  TIMESTAMPTZ NOT NULL,
+	consumed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS password_reset_codes_user_id_idx ON password_reset_codes (user_id);
+
+-- Plaintext codes are no longer honoured
+UPDATE users SET password_reset_code = NULL WHERE password_reset_code IS NOT NULL;
@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS user_totp (
+	user_id        INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	secret         TEXT NOT NULL,
+	last_used_step BIGINT,
+	created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	confirmed_at   TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+	id         SERIAL PRIMARY KEY,
+	user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	code_hash  TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	used_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS user_recovery_codes_user_id_idx ON user_recovery_codes (user_id);
+
+CREATE TABLE IF NOT EXISTS two_factor_challenges (
+	token_hash  TEXT PRIMARY KEY,
+	user_id     INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	attempts    INTEGER NOT NULL DEFAULT 0,
+	created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at  TIMESTAMPTZ NOT NULL,
+	consumed_at TIMESTAMPTZ
+);
+
+-- Deployment wide settings, there is only ever a single row
+CREATE TABLE IF NOT EXISTS app_settings (
+	id                 BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+	require_two_factor BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+INSERT INTO app_settings (id) VALUES (TRUE) ON CONFLICT DO NOTHING;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS invitations (
+	id               SERIAL PRIMARY KEY,
+	email            TEXT NOT NULL,
+	group_id         INTEGER REFERENCES groups(id) ON DELETE CASCADE,
+	invited_by       INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at       TIMESTAMPTZ NOT NULL,
+	accepted_at      TIMESTAMPTZ,
+	accepted_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	revoked_at       TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS invitations_email_idx ON invitations (email);
+CREATE INDEX IF NOT EXISTS invitations_group_id_idx ON invitations (group_id);
@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email TEXT;
+
+-- Everyone registered before verification existed was allowlisted by email, so treat them as verified
+UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL;
@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS audit_events (
+	id              BIGSERIAL PRIMARY KEY,
+	created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	actor_id        INTEGER,
+	impersonator_id INTEGER,
+	action          TEXT NOT NULL,
+	target_type     TEXT NOT NULL,
+	target_id       INTEGER,
+	group_id        INTEGER,
+	before          JSONB,
+	after           JSONB,
+	metadata        JSONB,
+	ip              TEXT NOT NULL DEFAULT '',
+	user_agent      TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_created_at_idx ON audit_events (created_at);
+CREATE INDEX IF NOT EXISTS audit_events_actor_id_idx ON audit_events (actor_id);
+CREATE INDEX IF NOT EXISTS audit_events_group_id_idx ON audit_events (group_id);
+
+-- Audit records are append-only
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS TRIGGER AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+CREATE TRIGGER audit_events_append_only
+	BEFORE UPDATE OR DELETE ON audit_events
+	FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
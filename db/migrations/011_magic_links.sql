@@ -0,0 +1,11 @@
+ALTER TABLE app_settings ADD COLUMN IF NOT EXISTS magic_link_login BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS magic_links (
+	id          SERIAL PRIMARY KEY,
+	user_id     INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at  TIMESTAMPTZ NOT NULL,
+	consumed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS magic_links_user_id_idx ON magic_links (user_id);
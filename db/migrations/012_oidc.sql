@@ -0,0 +1,24 @@
+-- Pending authorization code flows, consumed when the provider redirects back
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+	id            SERIAL PRIMARY KEY,
+	state_hash    TEXT NOT NULL UNIQUE,
+	provider      TEXT NOT NULL,
+	nonce         TEXT NOT NULL,
+	code_verifier TEXT NOT NULL,
+	created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at    TIMESTAMPTZ NOT NULL,
+	consumed_at   TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+	id            SERIAL PRIMARY KEY,
+	user_id       INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	provider      TEXT NOT NULL,
+	subject       TEXT NOT NULL,
+	email         TEXT NOT NULL,
+	created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	last_login_at TIMESTAMPTZ,
+	UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS user_identities_user_id_idx ON user_identities (user_id);
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+	id            SERIAL PRIMARY KEY,
+	user_id       INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	credential_id BYTEA NOT NULL UNIQUE,
+	public_key    BYTEA NOT NULL,
+	sign_count    BIGINT NOT NULL DEFAULT 0,
+	name          TEXT NOT NULL,
+	created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	last_used_at  TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS webauthn_credentials_user_id_idx ON webauthn_credentials (user_id);
+
+-- Outstanding ceremony challenges, registration challenges belong to the signed in user
+CREATE TABLE IF NOT EXISTS webauthn_challenges (
+	challenge_hash TEXT PRIMARY KEY,
+	user_id        INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	purpose        TEXT NOT NULL,
+	created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at     TIMESTAMPTZ NOT NULL,
+	consumed_at    TIMESTAMPTZ
+);
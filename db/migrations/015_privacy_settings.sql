@@ -0,0 +1,26 @@
+-- Who besides the user and super admins may see their email and last name
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_visibility TEXT NOT NULL DEFAULT 'group_admins'
+	CHECK (email_visibility IN ('group_members', 'group_admins', 'nobody'));
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_name_visibility TEXT NOT NULL DEFAULT 'group_members'
+	CHECK (last_name_visibility IN ('group_members', 'group_admins', 'nobody'));
+
+-- Whether the viewer may see a field of the target user's profile under the given visibility setting.
+-- Group-mates share a group with the user, group admins administer a group the user is in.
+CREATE OR REPLACE FUNCTION user_field_visible(visibility TEXT, target_id INTEGER, viewer_id INTEGER, viewer_is_super_admin BOOLEAN)
+RETURNS BOOLEAN AS $$
+	SELECT target_id = viewer_id OR viewer_is_super_admin OR CASE visibility
+		WHEN 'group_members' THEN EXISTS (
+			SELECT 1
+			FROM group_memberships t
+			JOIN group_memberships v ON v.group_id = t.group_id
+			WHERE t.user_id = target_id AND v.user_id = viewer_id
+		)
+		WHEN 'group_admins' THEN EXISTS (
+			SELECT 1
+			FROM group_memberships t
+			JOIN group_memberships v ON v.group_id = t.group_id
+			WHERE t.user_id = target_id AND v.user_id = viewer_id AND v.role_in_group = 'group_admin'
+		)
+		ELSE FALSE
+	END
+$$ LANGUAGE sql STABLE;
@@ -0,0 +1,7 @@
+-- Usernames and emails keep the casing they were entered with, uniqueness and lookups go through these lowercased copies.
+-- Everything stored before this was already lowercased, so the indexes can't find duplicates.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS username_normalized TEXT GENERATED ALWAYS AS (lower(username)) STORED;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_normalized TEXT GENERATED ALWAYS AS (lower(email)) STORED;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_normalized_idx ON users (username_normalized);
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_normalized_idx ON users (email_normalized);
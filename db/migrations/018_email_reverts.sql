@@ -0,0 +1,12 @@
+-- Links sent to the previous address after an email change, each one can undo that change once
+CREATE TABLE IF NOT EXISTS email_reverts (
+	id             SERIAL PRIMARY KEY,
+	user_id        INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	previous_email TEXT NOT NULL,
+	changed_to     TEXT NOT NULL,
+	created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at     TIMESTAMPTZ NOT NULL,
+	consumed_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS email_reverts_user_id_idx ON email_reverts (user_id);
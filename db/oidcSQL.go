@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nest/models"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var ErrInvalidOIDCState = errors.New("login state is invalid, expired or already used")
+
+func CreateOIDCLoginState(ctx context.Context, state *models.OIDCLoginState) error {
+	query := `
+		INSERT INTO oidc_login_states (state_hash, provider, nonce, code_verifier, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+	err := Pool.QueryRow(ctx, query, state.StateHash, state.Provider, state.Nonce, state.CodeVerifier, state.ExpiresAt).
+		Scan(&state.ID, &state.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create login state: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeOIDCLoginState marks the state as used and returns it, so each authorization response is accepted once
+func ConsumeOIDCLoginState(ctx context.Context, stateHash, provider string) (*models.OIDCLoginState, error) {
+	var state models.OIDCLoginState
+	query := `
+		UPDATE oidc_login_states
+		SET consumed_at = NOW()
+		WHERE state_hash = $1 AND provider = $2 AND consumed_at IS NULL AND expires_at > NOW()
+		RETURNING id, state_hash, provider, nonce, code_verifier, created_at, expires_at, consumed_at
+	`
+	err := Pool.QueryRow(ctx, query, stateHash, provider).Scan(
+		&state.ID,
+		&state.StateHash,
+		&state.Provider,
+		&state.Nonce,
+		&state.CodeVerifier,
+		&state.CreatedAt,
+		&state.ExpiresAt,
+		&state.ConsumedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrInvalidOIDCState
+		}
+		return nil, fmt.Errorf("failed to consume login state: %w", err)
+	}
+
+	return &state, nil
+}
+
+func GetUserIdentity(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	query := `
+		SELECT id, user_id, provider, subject, email, created_at, last_login_at
+		FROM user_identities
+		WHERE provider = $1 AND subject = $2
+	`
+	err := Pool.QueryRow(ctx, query, provider, subject).Scan(
+		&identity.ID,
+		&identity.UserID,
+		&identity.Provider,
+		&identity.Subject,
+		&identity.Email,
+		&identity.CreatedAt,
+		&identity.LastLoginAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, errors.New("identity not found")
+		}
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+
+	return &identity, nil
+}
+
+func CreateUserIdentity(ctx context.Context, identity *models.UserIdentity) (*models.UserIdentity, error) {
+	query := `
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+	err := Pool.QueryRow(ctx, query, identity.UserID, identity.Provider, identity.Subject, identity.Email).
+		Scan(&identity.ID, &identity.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to link identity: %w", err)
+	}
+
+	return identity, nil
+}
+
+func TouchUserIdentity(ctx context.Context, identityID int64, email string) error {
+	query := `
+		UPDATE user_identities
+		SET last_login_at = NOW(), email = $2
+		WHERE id = $1
+	`
+	_, err := Pool.Exec(ctx, query, identityID, email)
+	if err != nil {
+		return fmt.Errorf("failed to update identity: %w", err)
+	}
+
+	return nil
+}
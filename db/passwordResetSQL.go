@@ -0,0 +1,174 @@
+package db
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"nest/helpers"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	passwordResetCodeTTL     = 15 * time.Minute
+	maxPasswordResetAttempts = 5
+
+	// Failed attempts are counted across every code issued in the window, so requesting a new code doesn't reset them
+	passwordResetAttemptWindow = time.Hour
+)
+
+var (
+	ErrNoUserForEmail       = errors.New("no user with that email")
+	ErrInvalidResetCode     = errors.New("invalid password reset code")
+	ErrExpiredResetCode     = errors.New("password reset code has expired")
+	ErrTooManyResetAttempts = errors.New("too many password reset attempts")
+)
+
+// GeneratePasswordResetCode issues a new code for the email, invalidating any earlier codes, and returns the plaintext
+func GeneratePasswordResetCode(ctx context.Context, email string) (string, error) {
+	var userID int
+	err := Pool.QueryRow(ctx, `SELECT id FROM users WHERE email_normalized = lower($1) AND email_verified_at IS NOT NULL`, email).Scan(&userID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return "", ErrNoUserForEmail
+		}
+		return "", fmt.Errorf("query error: %w", err)
+	}
+
+	passwordResetCode, err := helpers.GenerateRandomString(16)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate password reset code: %w", err)
+	}
+
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE password_reset_codes
+		SET consumed_at = NOW()
+		WHERE user_id = $1 AND consumed_at IS NULL
+	`, userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to invalidate previous password reset codes: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO password_reset_codes (user_id, code_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`, userID, helpers.HashToken(passwordResetCode), time.Now().Add(passwordResetCodeTTL))
+	if err != nil {
+		return "", fmt.Errorf("failed to store password reset code: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("failed to commit password reset code: %w", err)
+	}
+
+	return passwordResetCode, nil
+}
+
+// checkPasswordResetCode locks the email's outstanding code and checks it, spending one attempt on a mismatch against
+// the user's budget. The caller must commit the transaction even on failure so the spent attempt is persisted.
+func checkPasswordResetCode(ctx context.Context, tx pgx.Tx, code, email string) (codeID int, userID int, err error) {
+	query := `
+		SELECT prc.id, prc.user_id, prc.code_hash, prc.expires_at
+		FROM password_reset_codes prc
+		JOIN users u ON u.id = prc.user_id
+		WHERE u.email_normalized = lower($1) AND prc.consumed_at IS NULL
+		ORDER BY prc.created_at DESC
+		LIMIT 1
+		FOR UPDATE OF prc
+	`
+	var codeHash string
+	var expiresAt time.Time
+
+	err = tx.QueryRow(ctx, query, email).Scan(&codeID, &userID, &codeHash, &expiresAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, 0, ErrInvalidResetCode
+		}
+		return 0, 0, fmt.Errorf("query error: %w", err)
+	}
+
+	if time.Now().After(expiresAt) {
+		return 0, 0, ErrExpiredResetCode
+	}
+
+	var attempts int
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE(SUM(attempts), 0)
+		FROM password_reset_codes
+		WHERE user_id = $1 AND created_at > $2
+	`, userID, time.Now().Add(-passwordResetAttemptWindow)).Scan(&attempts)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count password reset attempts: %w", err)
+	}
+
+	if attempts >= maxPasswordResetAttempts {
+		return 0, 0, ErrTooManyResetAttempts
+	}
+
+	if subtle.ConstantTimeCompare([]byte(helpers.HashToken(code)), []byte(codeHash)) != 1 {
+		_, err = tx.Exec(ctx, `UPDATE password_reset_codes SET attempts = attempts + 1 WHERE id = $1`, codeID)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to record password reset attempt: %w", err)
+		}
+		return 0, 0, ErrInvalidResetCode
+	}
+
+	return codeID, userID, nil
+}
+
+func VerifyPasswordResetCode(ctx context.Context, code, email string) error {
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, _, checkErr := checkPasswordResetCode(ctx, tx, code, email)
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit password reset attempt: %w", err)
+	}
+
+	return checkErr
+}
+
+// ResetPassword verifies the code and, if it is valid, sets the new password hash and consumes the code
+func ResetPassword(ctx context.Context, email, code string, hashedPassword []byte) (int, error) {
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	codeID, userID, err := checkPasswordResetCode(ctx, tx, code, email)
+	if err != nil {
+		if commitErr := tx.Commit(ctx); commitErr != nil {
+			return 0, fmt.Errorf("failed to commit password reset attempt: %w", commitErr)
+		}
+		return 0, fmt.Errorf("cannot reset password, failed to verify password reset code: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE users SET password_hash = $1, password_reset_required = FALSE WHERE id = $2`, hashedPassword, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reset password: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE password_reset_codes SET consumed_at = NOW() WHERE id = $1`, codeID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to consume password reset code: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit password reset: %w", err)
+	}
+
+	return userID, nil
+}
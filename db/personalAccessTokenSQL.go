@@ -0,0 +1,140 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nest/models"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func CreatePersonalAccessToken(ctx context.Context, token *models.PersonalAccessToken) (*models.PersonalAccessToken, error) {
+	query := `
+		INSERT INTO personal_access_tokens (user_id, name, token_hash, read_only, group_ids, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+
+	err := Pool.QueryRow(
+		ctx,
+		query,
+		token.UserID,
+		token.Name,
+		token.TokenHash,
+		token.ReadOnly,
+		token.GroupIDs,
+		token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create personal access token: %w", err)
+	}
+
+	return token, nil
+}
+
+func GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (*models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	query := `
+		SELECT id, user_id, name, token_hash, read_only, group_ids, created_at, last_used_at, expires_at, revoked_at
+		FROM personal_access_tokens
+		WHERE token_hash = $1
+	`
+	err := Pool.QueryRow(ctx, query, tokenHash).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		&token.TokenHash,
+		&token.ReadOnly,
+		&token.GroupIDs,
+		&token.CreatedAt,
+		&token.LastUsedAt,
+		&token.ExpiresAt,
+		&token.RevokedAt,
+	)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, errors.New("token not found")
+		}
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	return &token, nil
+}
+
+func GetPersonalAccessTokensForUser(ctx context.Context, userID int) ([]models.PersonalAccessToken, error) {
+	query := `
+		SELECT id, user_id, name, token_hash, read_only, group_ids, created_at, last_used_at, expires_at, revoked_at
+		FROM personal_access_tokens
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`
+
+	rows, err := Pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tokens for user %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	var tokens []models.PersonalAccessToken
+
+	for rows.Next() {
+		var token models.PersonalAccessToken
+		err = rows.Scan(
+			&token.ID,
+			&token.UserID,
+			&token.Name,
+			&token.TokenHash,
+			&token.ReadOnly,
+			&token.GroupIDs,
+			&token.CreatedAt,
+			&token.LastUsedAt,
+			&token.ExpiresAt,
+			&token.RevokedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan token row: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating token rows: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// TouchPersonalAccessToken records that the token was used, at most once a minute to avoid a write per request
+func TouchPersonalAccessToken(ctx context.Context, tokenID int64) error {
+	query := `
+		UPDATE personal_access_tokens
+		SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`
+	_, err := Pool.Exec(ctx, query, tokenID)
+	if err != nil {
+		return fmt.Errorf("failed to update token last used: %w", err)
+	}
+
+	return nil
+}
+
+func RevokePersonalAccessToken(ctx context.Context, userID, tokenID int) error {
+	query := `
+		UPDATE personal_access_tokens
+		SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`
+	tag, err := Pool.Exec(ctx, query, tokenID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return errors.New("token not found")
+	}
+
+	return nil
+}
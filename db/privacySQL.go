@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nest/models"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func GetPrivacySettings(ctx context.Context, userID int) (*models.PrivacySettings, error) {
+	var settings models.PrivacySettings
+	query := `
+		SELECT email_visibility, last_name_visibility
+		FROM users
+		WHERE id = $1
+	`
+	err := Pool.QueryRow(ctx, query, userID).Scan(&settings.EmailVisibility, &settings.LastNameVisibility)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, errors.New("user not found")
+		}
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+
+	return &settings, nil
+}
+
+func UpdatePrivacySettings(ctx context.Context, userID int, settings *models.PrivacySettings) error {
+	query := `
+		UPDATE users
+		SET email_visibility = $1, last_name_visibility = $2
+		WHERE id = $3
+	`
+	tag, err := Pool.Exec(ctx, query, settings.EmailVisibility, settings.LastNameVisibility, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update privacy settings: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return errors.New("user not found")
+	}
+
+	return nil
+}
+
+// GetVisibleUser loads a user with the fields the viewer may not see left blank
+func GetVisibleUser(ctx context.Context, userID int, viewer models.Viewer) (*models.User, error) {
+	var user models.User
+	query := `
+		SELECT ` + visibleUserColumns + `
+		FROM users u
+		WHERE u.id = $1
+	`
+	err := Pool.QueryRow(ctx, query, userID, viewer.UserID, viewer.IsSuperAdmin).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.FirstName,
+		&user.LastName,
+		&user.Role,
+		&user.CreatedAt,
+		&user.DisplayName,
+		&user.Bio,
+		&user.AvatarUpdatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, errors.New("user not found")
+		}
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+
+	return &user, nil
+}
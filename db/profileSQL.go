@@ -0,0 +1,43 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+func UpdateUserProfile(ctx context.Context, userID int, displayName, bio, timezone string) error {
+	query := `
+		UPDATE users
+		SET display_name = $1, bio = $2, timezone = $3
+		WHERE id = $4
+	`
+	tag, err := Pool.Exec(ctx, query, displayName, bio, timezone, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update user profile: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return errors.New("user not found")
+	}
+
+	return nil
+}
+
+// SetUserAvatar points the user at a newly stored avatar and returns the key of the one it replaced, if any
+func SetUserAvatar(ctx context.Context, userID int, avatarKey *string) (*string, error) {
+	query := `
+		UPDATE users u
+		SET avatar_key = $1, avatar_updated_at = CASE WHEN $1::TEXT IS NULL THEN NULL ELSE NOW() END
+		FROM (SELECT id, avatar_key FROM users WHERE id = $2 FOR UPDATE) previous
+		WHERE u.id = previous.id
+		RETURNING previous.avatar_key
+	`
+	var previousKey *string
+	err := Pool.QueryRow(ctx, query, avatarKey, userID).Scan(&previousKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update user avatar: %w", err)
+	}
+
+	return previousKey, nil
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nest/models"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func CreateSession(ctx context.Context, session *models.Session) (*models.Session, error) {
+	query := `
+		INSERT INTO sessions (id, user_id, refresh_token_hash, user_agent, ip, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at, last_used_at
+	`
+
+	err := Pool.QueryRow(
+		ctx,
+		query,
+		session.ID,
+		session.UserID,
+		session.RefreshTokenHash,
+		session.UserAgent,
+		session.IP,
+		session.ExpiresAt,
+	).Scan(&session.CreatedAt, &session.LastUsedAt)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return session, nil
+}
+
+func GetSessionByID(ctx context.Context, sessionID string) (*models.Session, error) {
+	var session models.Session
+	query := `
+		SELECT id, user_id, refresh_token_hash, user_agent, ip, created_at, last_used_at, expires_at, revoked_at
+		FROM sessions
+		WHERE id = $1
+	`
+	err := Pool.QueryRow(ctx, query, sessionID).Scan(
+		&session.ID,
+		&session.UserID,
+		&session.RefreshTokenHash,
+		&session.UserAgent,
+		&session.IP,
+		&session.CreatedAt,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+		&session.RevokedAt,
+	)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, errors.New("session not found")
+		}
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	return &session, nil
+}
+
+// IsSessionActive reports whether the session exists, has not been revoked and has not expired
+func IsSessionActive(ctx context.Context, sessionID string) (bool, error) {
+	query := `
+		SELECT 1
+		FROM sessions
+		WHERE id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+	`
+	var result int
+
+	err := Pool.QueryRow(ctx, query, sessionID).Scan(&result)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("query error: %w", err)
+	}
+	return true, nil
+}
+
+// RotateSessionRefreshToken replaces the session's refresh token hash, only succeeding if the previous hash still matches
+func RotateSessionRefreshToken(ctx context.Context, sessionID, oldHash, newHash string, expiresAt time.Time) error {
+	query := `
+		UPDATE sessions
+		SET refresh_token_hash = $1, expires_at = $2, last_used_at = NOW()
+		WHERE id = $3 AND refresh_token_hash = $4 AND revoked_at IS NULL
+	`
+	tag, err := Pool.Exec(ctx, query, newHash, expiresAt, sessionID, oldHash)
+	if err != nil {
+		return fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return errors.New("refresh token has already been used")
+	}
+
+	return nil
+}
+
+func RevokeSession(ctx context.Context, sessionID string) error {
+	query := `
+		UPDATE sessions
+		SET revoked_at = NOW()
+		WHERE id = $1 AND revoked_at IS NULL
+	`
+	_, err := Pool.Exec(ctx, query, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	return nil
+}
+
+func RevokeAllSessionsForUser(ctx context.Context, userID int) error {
+	query := `
+		UPDATE sessions
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`
+	_, err := Pool.Exec(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeOtherSessionsForUser revokes every session for the user except the one making the request
+func RevokeOtherSessionsForUser(ctx context.Context, userID int, keepSessionID string) error {
+	query := `
+		UPDATE sessions
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL
+	`
+	_, err := Pool.Exec(ctx, query, userID, keepSessionID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"nest/models"
+)
+
+func GetSettings(ctx context.Context) (*models.Settings, error) {
+	var settings models.Settings
+	query := `
+		SELECT require_two_factor, magic_link_login
+		FROM app_settings
+		WHERE id = TRUE
+	`
+	err := Pool.QueryRow(ctx, query).Scan(
+		&settings.RequireTwoFactor,
+		&settings.MagicLinkLogin,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	return &settings, nil
+}
+
+func UpdateRequireTwoFactor(ctx context.Context, requireTwoFactor bool) error {
+	query := `
+		UPDATE app_settings
+		SET require_two_factor = $1
+		WHERE id = TRUE;
+	`
+	_, err := Pool.Exec(ctx, query, requireTwoFactor)
+	if err != nil {
+		return fmt.Errorf("failed to update settings: %w", err)
+	}
+
+	return nil
+}
+
+func UpdateMagicLinkLogin(ctx context.Context, magicLinkLogin bool) error {
+	query := `
+		UPDATE app_settings
+		SET magic_link_login = $1
+		WHERE id = TRUE;
+	`
+	_, err := Pool.Exec(ctx, query, magicLinkLogin)
+	if err != nil {
+		return fmt.Errorf("failed to update settings: %w", err)
+	}
+
+	return nil
+}
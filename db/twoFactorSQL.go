@@ -0,0 +1,208 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nest/models"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func GetUserTOTP(ctx context.Context, userID int) (*models.UserTOTP, error) {
+	var totp models.UserTOTP
+	query := `
+		SELECT user_id, secret, last_used_step, created_at, confirmed_at
+		FROM user_totp
+		WHERE user_id = $1
+	`
+	err := Pool.QueryRow(ctx, query, userID).Scan(
+		&totp.UserID,
+		&totp.Secret,
+		&totp.LastUsedStep,
+		&totp.CreatedAt,
+		&totp.ConfirmedAt,
+	)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, errors.New("two-factor authentication not set up")
+		}
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	return &totp, nil
+}
+
+// SetPendingTOTPSecret stores a new unconfirmed secret, replacing any earlier unconfirmed one
+func SetPendingTOTPSecret(ctx context.Context, userID int, secret string) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = NULL, created_at = NOW(), confirmed_at = NULL
+		WHERE user_totp.confirmed_at IS NULL
+	`
+	tag, err := Pool.Exec(ctx, query, userID, secret)
+	if err != nil {
+		return fmt.Errorf("failed to store TOTP secret: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return errors.New("two-factor authentication is already enabled")
+	}
+
+	return nil
+}
+
+func ConfirmTOTP(ctx context.Context, userID int) error {
+	query := `
+		UPDATE user_totp
+		SET confirmed_at = NOW()
+		WHERE user_id = $1 AND confirmed_at IS NULL
+	`
+	_, err := Pool.Exec(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to confirm TOTP: %w", err)
+	}
+
+	return nil
+}
+
+// MarkTOTPStepUsed records the time step of an accepted code, returning false if it (or a later one) was already used
+func MarkTOTPStepUsed(ctx context.Context, userID int, step int64) (bool, error) {
+	query := `
+		UPDATE user_totp
+		SET last_used_step = $2
+		WHERE user_id = $1 AND (last_used_step IS NULL OR last_used_step < $2)
+	`
+	tag, err := Pool.Exec(ctx, query, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to record TOTP use: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func DeleteUserTOTP(ctx context.Context, userID int) error {
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete TOTP: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ReplaceRecoveryCodes discards all of the user's recovery codes and stores the given hashes in their place
+func ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	for _, codeHash := range codeHashes {
+		_, err := tx.Exec(ctx, `INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, codeHash)
+		if err != nil {
+			return fmt.Errorf("failed to store recovery code: %w", err)
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ConsumeRecoveryCode marks a matching unused recovery code as used, returning false if there was none
+func ConsumeRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	query := `
+		UPDATE user_recovery_codes
+		SET used_at = NOW()
+		WHERE id = (
+			SELECT id FROM user_recovery_codes
+			WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+			LIMIT 1
+		)
+	`
+	tag, err := Pool.Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to consume recovery code: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func CountRemainingRecoveryCodes(ctx context.Context, userID int) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM user_recovery_codes
+		WHERE user_id = $1 AND used_at IS NULL
+	`
+	var count int
+	err := Pool.QueryRow(ctx, query, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("query error: %w", err)
+	}
+
+	return count, nil
+}
+
+func CreateTwoFactorChallenge(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO two_factor_challenges (token_hash, user_id, expires_at)
+		VALUES ($1, $2, $3)
+	`
+	_, err := Pool.Exec(ctx, query, tokenHash, userID, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create two-factor challenge: %w", err)
+	}
+
+	return nil
+}
+
+// SpendTwoFactorChallengeAttempt counts an attempt against a challenge that is still usable and returns its user.
+// The limit is checked by the same statement that counts, so parallel requests can't make more than maxAttempts tries.
+func SpendTwoFactorChallengeAttempt(ctx context.Context, tokenHash string, maxAttempts int) (int, error) {
+	query := `
+		UPDATE two_factor_challenges
+		SET attempts = attempts + 1
+		WHERE token_hash = $1 AND consumed_at IS NULL AND expires_at > NOW() AND attempts < $2
+		RETURNING user_id
+	`
+	var userID int
+	err := Pool.QueryRow(ctx, query, tokenHash, maxAttempts).Scan(&userID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, errors.New("challenge not found or no longer usable")
+		}
+		return 0, fmt.Errorf("failed to record challenge attempt: %w", err)
+	}
+
+	return userID, nil
+}
+
+// ConsumeTwoFactorChallenge marks the challenge used, returning false if it had already been consumed
+func ConsumeTwoFactorChallenge(ctx context.Context, tokenHash string) (bool, error) {
+	query := `
+		UPDATE two_factor_challenges
+		SET consumed_at = NOW()
+		WHERE token_hash = $1 AND consumed_at IS NULL
+	`
+	tag, err := Pool.Exec(ctx, query, tokenHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to consume challenge: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
@@ -4,17 +4,19 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"nest/helpers"
 	"nest/models"
 	"strings"
 
 	"github.com/jackc/pgx/v4"
 )
 
+var ErrLastSuperAdmin = errors.New("cannot demote the last super admin")
+
 func GetUserByID(ctx context.Context, id int) (*models.User, error) {
 	var user models.User
 	query := `
-		SELECT id, username, email, first_name, last_name, password_hash, role, created_at
+		SELECT id, username, email, first_name, last_name, password_hash, role, created_at, email_verified_at, pending_email, deletion_scheduled_at,
+			display_name, bio, timezone, avatar_key, avatar_updated_at
 		FROM users 
 		WHERE id = $1
 	`
@@ -27,6 +29,14 @@ func GetUserByID(ctx context.Context, id int) (*models.User, error) {
 		&user.PasswordHash,
 		&user.Role,
 		&user.CreatedAt,
+		&user.EmailVerifiedAt,
+		&user.PendingEmail,
+		&user.DeletionScheduledAt,
+		&user.DisplayName,
+		&user.Bio,
+		&user.Timezone,
+		&user.AvatarKey,
+		&user.AvatarUpdatedAt,
 	)
 
 	if err != nil {
@@ -38,9 +48,10 @@ func GetUserByID(ctx context.Context, id int) (*models.User, error) {
 func GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
 	var user models.User
 	query := `
-        SELECT id, username, email, first_name, last_name, password_hash, role, created_at
+        SELECT id, username, email, first_name, last_name, password_hash, role, created_at, email_verified_at, pending_email, deletion_scheduled_at,
+			display_name, bio, timezone, avatar_key, avatar_updated_at
         FROM users 
-        WHERE username = $1
+        WHERE username_normalized = lower($1)
     `
 	err := Pool.QueryRow(ctx, query, username).Scan(
 		&user.ID,
@@ -51,6 +62,51 @@ func GetUserByUsername(ctx context.Context, username string) (*models.User, erro
 		&user.PasswordHash,
 		&user.Role,
 		&user.CreatedAt,
+		&user.EmailVerifiedAt,
+		&user.PendingEmail,
+		&user.DeletionScheduledAt,
+		&user.DisplayName,
+		&user.Bio,
+		&user.Timezone,
+		&user.AvatarKey,
+		&user.AvatarUpdatedAt,
+	)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, errors.New("user not found")
+		}
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	return &user, nil
+}
+
+// GetUserByVerifiedEmail finds the account whose confirmed email matches, ignoring unverified addresses
+func GetUserByVerifiedEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	query := `
+		SELECT id, username, email, first_name, last_name, password_hash, role, created_at, email_verified_at, pending_email, deletion_scheduled_at,
+			display_name, bio, timezone, avatar_key, avatar_updated_at
+		FROM users
+		WHERE email_normalized = lower($1) AND email_verified_at IS NOT NULL
+	`
+	err := Pool.QueryRow(ctx, query, email).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.FirstName,
+		&user.LastName,
+		&user.PasswordHash,
+		&user.Role,
+		&user.CreatedAt,
+		&user.EmailVerifiedAt,
+		&user.PendingEmail,
+		&user.DeletionScheduledAt,
+		&user.DisplayName,
+		&user.Bio,
+		&user.Timezone,
+		&user.AvatarKey,
+		&user.AvatarUpdatedAt,
 	)
 
 	if err != nil {
@@ -66,7 +122,7 @@ func IsUsernameTaken(ctx context.Context, username string) (bool, error) {
 	query := `
 		SELECT 1
 		FROM users
-		WHERE username = $1
+		WHERE username_normalized = lower($1)
 	`
 	var result int
 
@@ -81,6 +137,45 @@ func IsUsernameTaken(ctx context.Context, username string) (bool, error) {
 	return true, nil
 }
 
+// IsUsernameTakenByOther is IsUsernameTaken ignoring the given user, so they can keep their username or change its casing
+func IsUsernameTakenByOther(ctx context.Context, username string, userID int) (bool, error) {
+	query := `
+		SELECT 1
+		FROM users
+		WHERE username_normalized = lower($1) AND id <> $2
+	`
+	var result int
+
+	err := Pool.QueryRow(ctx, query, username, userID).Scan(&result)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("query error: %w", err)
+	}
+	return true, nil
+}
+
+func IsEmailTaken(ctx context.Context, email string) (bool, error) {
+	query := `
+		SELECT 1
+		FROM users
+		WHERE email_normalized = lower($1)
+	`
+	var result int
+
+	err := Pool.QueryRow(ctx, query, email).Scan(&result)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("query error: %w", err)
+	}
+	return true, nil
+}
+
 func CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
 	query := `
 		INSERT INTO users (first_name, last_name, username, email, password_hash)
@@ -105,33 +200,30 @@ func CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
 	return user, nil
 }
 
-func DeleteUser(ctx context.Context, userID int) error {
+func UpdateUserPassword(ctx context.Context, userID int, hashedPassword []byte) error {
 	query := `
-		DELETE FROM users
-		WHERE id = $1;
+		UPDATE users
+		SET password_hash = $1, password_reset_required = FALSE
+		WHERE id = $2
 	`
-	_, err := Pool.Exec(
-		ctx,
-		query,
-		userID,
-	)
-
+	_, err := Pool.Exec(ctx, query, hashedPassword, userID)
 	if err != nil {
-		return fmt.Errorf("failed to delete user: %w", err)
+		return fmt.Errorf("failed to update user password: %w", err)
 	}
 
 	return nil
 }
 
-func UpdateUserPassword(ctx context.Context, userID int, hashedPassword string) error {
+// UpgradePasswordHash swaps in a stronger hash of the same password, unless the password changed in the meantime
+func UpgradePasswordHash(ctx context.Context, userID int, oldHash, newHash []byte) error {
 	query := `
 		UPDATE users
-		SET password = $1
-		WHERE user_id = $2
+		SET password_hash = $1
+		WHERE id = $2 AND password_hash = $3
 	`
-	_, err := Pool.Exec(ctx, query, hashedPassword, userID)
+	_, err := Pool.Exec(ctx, query, newHash, userID, oldHash)
 	if err != nil {
-		return fmt.Errorf("failed to update user password: %w", err)
+		return fmt.Errorf("failed to upgrade password hash: %w", err)
 	}
 
 	return nil
@@ -165,20 +257,6 @@ func UpdateUserLastName(ctx context.Context, userID int, lastName string) error
 	return nil
 }
 
-func UpdateUserEmail(ctx context.Context, userID int, email string) error {
-	query := `
-		UPDATE users
-		SET email = $1
-		WHERE user_id = $2
-	`
-	_, err := Pool.Exec(ctx, query, email, userID)
-	if err != nil {
-		return fmt.Errorf("failed to update user email: %w", err)
-	}
-
-	return nil
-}
-
 func UpdateUser(ctx context.Context, userID int, updates map[string]interface{}) error {
 	// Build dynamic query based on provided fields
 	setFields := make([]string, 0)
@@ -187,22 +265,17 @@ func UpdateUser(ctx context.Context, userID int, updates map[string]interface{})
 
 	if firstName, ok := updates["first_name"].(string); ok {
 		setFields = append(setFields, fmt.Sprintf("first_name = $%d", argPosition))
-		args = append(args, strings.ToLower(firstName))
+		args = append(args, firstName)
 		argPosition++
 	}
 	if lastName, ok := updates["last_name"].(string); ok {
 		setFields = append(setFields, fmt.Sprintf("last_name = $%d", argPosition))
-		args = append(args, strings.ToLower(lastName))
-		argPosition++
-	}
-	if email, ok := updates["email"].(string); ok {
-		setFields = append(setFields, fmt.Sprintf("email = $%d", argPosition))
-		args = append(args, strings.ToLower(email))
+		args = append(args, lastName)
 		argPosition++
 	}
 	if username, ok := updates["username"].(string); ok {
 		setFields = append(setFields, fmt.Sprintf("username = $%d", argPosition))
-		args = append(args, strings.ToLower(username))
+		args = append(args, username)
 		argPosition++
 	}
 
@@ -226,58 +299,165 @@ func UpdateUser(ctx context.Context, userID int, updates map[string]interface{})
 	return nil
 }
 
-func GeneratePasswordResetCode(ctx context.Context, email string) (string, error) {
-	passwordResetCode, err := helpers.GenerateRandomString(16)
+func GetPrincipal(ctx context.Context, userID int) (*models.Principal, error) {
+	var principal models.Principal
+	query := `
+		SELECT u.id, u.username, u.role, u.disabled, u.password_reset_required,
+			EXISTS (SELECT 1 FROM group_memberships gm WHERE gm.user_id = u.id AND gm.role_in_group = 'group_admin'),
+			EXISTS (SELECT 1 FROM user_totp t WHERE t.user_id = u.id AND t.confirmed_at IS NOT NULL)
+		FROM users u
+		WHERE u.id = $1
+	`
+	err := Pool.QueryRow(ctx, query, userID).Scan(
+		&principal.UserID,
+		&principal.Username,
+		&principal.Role,
+		&principal.Disabled,
+		&principal.PasswordResetRequired,
+		&principal.IsGroupAdmin,
+		&principal.TwoFactorEnabled,
+	)
+
 	if err != nil {
-		return "", fmt.Errorf("failed to generate password reset code: %w", err)
+		if err == pgx.ErrNoRows {
+			return nil, errors.New("user not found")
+		}
+		return nil, fmt.Errorf("query error: %w", err)
 	}
+	return &principal, nil
+}
+
+// SearchUsers returns a page of users whose name, username or email contains the search text, along with the total match count
+func SearchUsers(ctx context.Context, search string, limit, offset int) ([]models.UserSummary, int, error) {
+	// Escape LIKE wildcards so the search text is matched literally
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(search) + "%"
 
 	query := `
-		UPDATE users
-		SET password_reset_code = $1
-		WHERE email = $2
+		SELECT id, username, email, first_name, last_name, role, disabled, password_reset_required, email_verified_at, created_at,
+			COUNT(*) OVER()
+		FROM users
+		WHERE $1 = '' OR username ILIKE $2 OR email ILIKE $2 OR first_name ILIKE $2 OR last_name ILIKE $2
+		ORDER BY username
+		LIMIT $3 OFFSET $4
 	`
-	_, err = Pool.Exec(ctx, query, passwordResetCode, email)
+
+	rows, err := Pool.Query(ctx, query, search, pattern, limit, offset)
 	if err != nil {
-		return "", fmt.Errorf("failed to update user password: %w", err)
+		return nil, 0, fmt.Errorf("failed to search users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []models.UserSummary{}
+	total := 0
+
+	for rows.Next() {
+		var user models.UserSummary
+		err = rows.Scan(
+			&user.ID,
+			&user.Username,
+			&user.Email,
+			&user.FirstName,
+			&user.LastName,
+			&user.Role,
+			&user.Disabled,
+			&user.PasswordResetRequired,
+			&user.EmailVerifiedAt,
+			&user.CreatedAt,
+			&total,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan user row: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating user rows: %w", err)
+	}
+
+	// The window count is missing when the page is past the end
+	if len(users) == 0 && offset > 0 {
+		err = Pool.QueryRow(ctx, `
+			SELECT COUNT(*)
+			FROM users
+			WHERE $1 = '' OR username ILIKE $2 OR email ILIKE $2 OR first_name ILIKE $2 OR last_name ILIKE $2
+		`, search, pattern).Scan(&total)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to count users: %w", err)
+		}
 	}
 
-	return passwordResetCode, nil
+	return users, total, nil
 }
 
-func VerifyPasswordResetCode(ctx context.Context, code, email string) error {
-	query := `
-		SELECT 1
-		FROM users
-		WHERE password_reset_code = $1 AND email = $2
-	`
-	var result int
-	err := Pool.QueryRow(ctx, query, code, email).Scan(&result)
+// SetUserRole changes the user's role, refusing to demote the last super admin
+func SetUserRole(ctx context.Context, userID int, role models.Role) error {
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the super admin rows so two concurrent demotions can't both pass the check
+	var superAdmins int
+	err = tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM (SELECT id FROM users WHERE role = $1 AND NOT disabled FOR UPDATE) sa
+	`, models.SuperAdmin).Scan(&superAdmins)
+	if err != nil {
+		return fmt.Errorf("failed to count super admins: %w", err)
+	}
+
+	var currentRole models.Role
+	err = tx.QueryRow(ctx, `SELECT role FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&currentRole)
 	if err != nil {
 		if err == pgx.ErrNoRows {
-			return errors.New("invalid password reset code")
+			return errors.New("user not found")
 		}
 		return fmt.Errorf("query error: %w", err)
 	}
 
-	return nil
+	if currentRole == models.SuperAdmin && role != models.SuperAdmin && superAdmins <= 1 {
+		return ErrLastSuperAdmin
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE users SET role = $1 WHERE id = $2`, role, userID); err != nil {
+		return fmt.Errorf("failed to update user role: %w", err)
+	}
+
+	return tx.Commit(ctx)
 }
 
-func ResetPassword(ctx context.Context, email, code string, hashedPassword []byte) error {
-	// Verify code is valid for email
-	err := VerifyPasswordResetCode(ctx, code, email)
+func SetUserDisabled(ctx context.Context, userID int, disabled bool) error {
+	query := `
+		UPDATE users
+		SET disabled = $1
+		WHERE id = $2 AND deleted_at IS NULL
+	`
+	tag, err := Pool.Exec(ctx, query, disabled, userID)
 	if err != nil {
-		return fmt.Errorf("cannot reset password, failed to verify password reset code: %w", err)
+		return fmt.Errorf("failed to update user disabled status: %w", err)
 	}
 
+	if tag.RowsAffected() == 0 {
+		return errors.New("user not found")
+	}
+
+	return nil
+}
+
+func SetPasswordResetRequired(ctx context.Context, userID int) error {
 	query := `
 		UPDATE users
-		SET password_hash = $1, password_reset_code = NULL
-		WHERE email = $2
+		SET password_reset_required = TRUE
+		WHERE id = $1
 	`
-	_, err = Pool.Exec(ctx, query, hashedPassword, email)
+	tag, err := Pool.Exec(ctx, query, userID)
 	if err != nil {
-		return fmt.Errorf("failed to reset password: %w", err)
+		return fmt.Errorf("failed to require password reset: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return errors.New("user not found")
 	}
 
 	return nil
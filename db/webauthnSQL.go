@@ -0,0 +1,173 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nest/models"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var ErrInvalidWebAuthnChallenge = errors.New("passkey challenge is invalid, expired or already used")
+
+// CreateWebAuthnChallenge records a ceremony challenge, userID is zero for sign in challenges
+func CreateWebAuthnChallenge(ctx context.Context, challengeHash string, userID int, purpose string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO webauthn_challenges (challenge_hash, user_id, purpose, expires_at)
+		VALUES ($1, NULLIF($2, 0), $3, $4)
+	`
+	_, err := Pool.Exec(ctx, query, challengeHash, userID, purpose, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to store passkey challenge: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeWebAuthnChallenge marks the challenge as used and returns the user it was issued to, zero for sign in
+func ConsumeWebAuthnChallenge(ctx context.Context, challengeHash, purpose string) (int, error) {
+	query := `
+		UPDATE webauthn_challenges
+		SET consumed_at = NOW()
+		WHERE challenge_hash = $1 AND purpose = $2 AND consumed_at IS NULL AND expires_at > NOW()
+		RETURNING COALESCE(user_id, 0)
+	`
+	var userID int
+	err := Pool.QueryRow(ctx, query, challengeHash, purpose).Scan(&userID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, ErrInvalidWebAuthnChallenge
+		}
+		return 0, fmt.Errorf("failed to consume passkey challenge: %w", err)
+	}
+
+	return userID, nil
+}
+
+func CreateWebAuthnCredential(ctx context.Context, credential *models.WebAuthnCredential) (*models.WebAuthnCredential, error) {
+	query := `
+		INSERT INTO webauthn_credentials (user_id, credential_id, public_key, sign_count, name)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+	err := Pool.QueryRow(
+		ctx,
+		query,
+		credential.UserID,
+		[]byte(credential.CredentialID),
+		credential.PublicKey,
+		int64(credential.SignCount),
+		credential.Name,
+	).Scan(&credential.ID, &credential.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create passkey: %w", err)
+	}
+
+	return credential, nil
+}
+
+const webAuthnCredentialColumns = `id, user_id, credential_id, public_key, sign_count, name, created_at, last_used_at`
+
+func scanWebAuthnCredential(row pgx.Row) (*models.WebAuthnCredential, error) {
+	var credential models.WebAuthnCredential
+	var credentialID []byte
+	var signCount int64
+
+	err := row.Scan(
+		&credential.ID,
+		&credential.UserID,
+		&credentialID,
+		&credential.PublicKey,
+		&signCount,
+		&credential.Name,
+		&credential.CreatedAt,
+		&credential.LastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	credential.CredentialID = credentialID
+	credential.SignCount = uint32(signCount)
+	return &credential, nil
+}
+
+func GetWebAuthnCredentialByCredentialID(ctx context.Context, credentialID []byte) (*models.WebAuthnCredential, error) {
+	query := `
+		SELECT ` + webAuthnCredentialColumns + `
+		FROM webauthn_credentials
+		WHERE credential_id = $1
+	`
+	credential, err := scanWebAuthnCredential(Pool.QueryRow(ctx, query, credentialID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, errors.New("passkey not found")
+		}
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+
+	return credential, nil
+}
+
+func GetWebAuthnCredentialsForUser(ctx context.Context, userID int) ([]models.WebAuthnCredential, error) {
+	query := `
+		SELECT ` + webAuthnCredentialColumns + `
+		FROM webauthn_credentials
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`
+	rows, err := Pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	credentials := []models.WebAuthnCredential{}
+	for rows.Next() {
+		credential, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan passkey: %w", err)
+		}
+		credentials = append(credentials, *credential)
+	}
+
+	return credentials, rows.Err()
+}
+
+// UpdateWebAuthnSignCount stores the counter from a sign in, failing if another sign in with the same credential won the race
+func UpdateWebAuthnSignCount(ctx context.Context, credentialID int64, oldCount, newCount uint32) error {
+	query := `
+		UPDATE webauthn_credentials
+		SET sign_count = $3, last_used_at = NOW()
+		WHERE id = $1 AND sign_count = $2
+	`
+	tag, err := Pool.Exec(ctx, query, credentialID, int64(oldCount), int64(newCount))
+	if err != nil {
+		return fmt.Errorf("failed to update passkey counter: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return errors.New("passkey was used concurrently")
+	}
+
+	return nil
+}
+
+func DeleteWebAuthnCredential(ctx context.Context, userID, credentialID int) error {
+	query := `
+		DELETE FROM webauthn_credentials
+		WHERE id = $1 AND user_id = $2
+	`
+	tag, err := Pool.Exec(ctx, query, credentialID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete passkey: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return errors.New("passkey not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"nest/db"
+	"nest/helpers"
+	"nest/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+func GetAuditEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		log.Printf("ERROR: Invalid audit log filter: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeAuditEventPage(w, r, filter)
+}
+
+// GetGroupAuditEvents lets group admins see the audit log for their own group
+func GetGroupAuditEvents(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	groupID, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("ERROR: Invalid group ID format: %s: %v", idStr, err)
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		log.Printf("ERROR: Invalid audit log filter for group %d: %v", groupID, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.GroupID = &groupID
+
+	writeAuditEventPage(w, r, filter)
+}
+
+func writeAuditEventPage(w http.ResponseWriter, r *http.Request, filter models.AuditFilter) {
+	limit, offset, err := helpers.GetPagination(r, defaultAuditPageSize, maxAuditPageSize)
+	if err != nil {
+		log.Printf("ERROR: Invalid pagination for audit log: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events, total, err := db.GetAuditEvents(r.Context(), filter, limit, offset)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve audit events: %v", err)
+		http.Error(w, "Failed to get audit events", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("INFO: Retrieved %d of %d audit events", len(events), total)
+	json.NewEncoder(w).Encode(models.AuditEventPage{
+		Events: events,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+func parseAuditFilter(r *http.Request) (models.AuditFilter, error) {
+	query := r.URL.Query()
+	filter := models.AuditFilter{
+		Action:     query.Get("action"),
+		TargetType: query.Get("target_type"),
+	}
+
+	for name, dest := range map[string]**int{
+		"actor_id":  &filter.ActorID,
+		"target_id": &filter.TargetID,
+		"group_id":  &filter.GroupID,
+	} {
+		if value := query.Get(name); value != "" {
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s", name)
+			}
+			*dest = &id
+		}
+	}
+
+	for name, dest := range map[string]**time.Time{
+		"since": &filter.Since,
+		"until": &filter.Until,
+	} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s, expected RFC 3339", name)
+			}
+			*dest = &t
+		}
+	}
+
+	return filter, nil
+}
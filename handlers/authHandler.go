@@ -1,20 +1,22 @@
 package handlers
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"nest/db"
+	"nest/helpers"
 	"nest/models"
 	"nest/utils"
 	"net/http"
-	"os"
-	"slices"
+	"strconv"
 	"strings"
 	"time"
-
-	"github.com/golang-jwt/jwt/v4"
-	"golang.org/x/crypto/bcrypt"
 )
 
 func Register(w http.ResponseWriter, r *http.Request) {
@@ -26,38 +28,36 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := utils.ValidateNewUser(r, userDto); err != nil {
-		log.Printf("ERROR: User validation failed for %s: %v", userDto.Email, err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if errs := utils.ValidateNewUser(r, userDto); len(errs) > 0 {
+		log.Printf("ERROR: User validation failed for %s: %v", userDto.Email, errs)
+		utils.WriteValidationErrors(w, errs)
 		return
 	}
 
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(userDto.Password), bcrypt.DefaultCost)
+	hashedPassword, err := utils.HashPassword(userDto.Password)
 	if err != nil {
 		log.Printf("ERROR: Failed to hash password for user %s: %v", userDto.Email, err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	validEmailsStr := os.Getenv("VALID_EMAILS")
-	validEmails := strings.Split(validEmailsStr, ",")
-
-	if !slices.Contains(validEmails, strings.ToLower(userDto.Email)) {
-		log.Printf("ERROR: Registration attempt with non-whitelisted email: %s", userDto.Email)
-		http.Error(w, "Email not whitelisted", http.StatusUnauthorized)
+	invitation, err := findRegistrationInvitation(r, userDto)
+	if err != nil {
+		log.Printf("ERROR: Registration attempt with invalid invitation for %s: %v", userDto.Email, err)
+		http.Error(w, "Invalid or expired invitation", http.StatusUnauthorized)
 		return
 	}
 
-	user := models.User{
-		FirstName:    strings.ToLower(userDto.FirstName),
-		LastName:     strings.ToLower(userDto.LastName),
-		Email:        strings.ToLower(userDto.Email),
-		Username:     strings.ToLower(userDto.Username),
-		PasswordHash: hashedPassword,
+	if invitation == nil {
+		log.Printf("ERROR: Registration attempt without an invitation: %s", userDto.Email)
+		http.Error(w, "An invitation is required to register", http.StatusUnauthorized)
+		return
 	}
 
-	createdUser, err := db.CreateUser(r.Context(), &user)
+	user := newUser(userDto.FirstName, userDto.LastName, userDto.Email, userDto.Username, hashedPassword)
+
+	createdUser, err := db.RedeemInvitation(r.Context(), int(invitation.ID), &user)
 	if err != nil {
 		log.Printf("ERROR: Failed to create user in database - Email: %s, Username: %s: %v",
 			userDto.Email, userDto.Username, err)
@@ -65,19 +65,53 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Following an emailed invite link proves the address
+	if err := db.MarkEmailVerified(r.Context(), int(createdUser.ID)); err != nil {
+		log.Printf("ERROR: Failed to mark email verified for user %d: %v", createdUser.ID, err)
+	}
+
 	log.Printf("INFO: Successfully registered new user - ID: %d, Email: %s, Username: %s",
 		createdUser.ID, createdUser.Email, createdUser.Username)
 
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(createdUser)
+	json.NewEncoder(w).Encode(models.NewSelfUser(createdUser))
 }
 
-func Login(w http.ResponseWriter, r *http.Request) {
-	enableCors(&w)
+// findRegistrationInvitation returns the invitation a registration is redeeming from its signed invite link.
+// Knowing an invited address isn't enough to take the invitation, so without a token there is none.
+func findRegistrationInvitation(r *http.Request, userDto models.UserDTO) (*models.Invitation, error) {
+	if userDto.InviteToken == "" {
+		return nil, nil
+	}
+
+	invitation, err := invitationFromToken(r, userDto.InviteToken)
+	if err != nil {
+		return nil, err
+	}
+	if invitation.Email != strings.ToLower(strings.TrimSpace(userDto.Email)) {
+		return nil, fmt.Errorf("invitation %d was sent to a different email", invitation.ID)
+	}
+	return invitation, nil
+}
+
+// newUser normalizes the details of a new account the same way for every sign up path. Casing is kept as
+// entered, the database compares usernames and emails case-insensitively.
+func newUser(firstName, lastName, email, username string, passwordHash []byte) models.User {
+	return models.User{
+		FirstName:    utils.NormalizeName(firstName),
+		LastName:     utils.NormalizeName(lastName),
+		Email:        strings.TrimSpace(email),
+		Username:     strings.TrimSpace(username),
+		PasswordHash: passwordHash,
+	}
+}
 
+func Login(w http.ResponseWriter, r *http.Request) {
 	var credentials struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
+		// Keep the tokens in HttpOnly cookies instead of returning them, for browser clients
+		UseCookies bool `json:"use_cookies"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
@@ -86,42 +120,187 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := db.GetUserByUsername(r.Context(), strings.ToLower(credentials.Username))
+	if credentials.UseCookies && !utils.SessionCookiesEnabled() {
+		log.Printf("ERROR: Cookie login requested for %s but cookie sessions are disabled", credentials.Username)
+		http.Error(w, "Cookie sessions are not enabled", http.StatusBadRequest)
+		return
+	}
+
+	if !checkIPThrottle(w, r) {
+		return
+	}
+
+	user, err := db.GetUserByUsername(r.Context(), credentials.Username)
 	if err != nil {
+		utils.RecordIPLoginFailure(helpers.GetClientIP(r))
 		log.Printf("ERROR: Failed to find user during login - Username: %s: %v", credentials.Username, err)
 		http.Error(w, "User not found", http.StatusUnauthorized)
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(credentials.Password)); err != nil {
+	if !checkAccountThrottle(w, r, user) {
+		return
+	}
+
+	match, err := utils.VerifyPassword(user.PasswordHash, credentials.Password)
+	if err != nil {
+		// Counted as a failed attempt, otherwise input that makes verification error would be a free guess
+		log.Printf("ERROR: Failed to verify password for user %s: %v", user.Username, err)
+		match = false
+	}
+
+	if !match {
 		log.Printf("ERROR: Invalid password attempt for user %s from IP %s",
-			credentials.Username, r.RemoteAddr)
+			credentials.Username, helpers.GetClientIP(r))
+		recordFailedLogin(r, user)
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	// Create the JWT token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": user.Username,
-		"role":     user.Role,
-		"exp":      time.Now().Add(time.Hour * 504).Unix(),
-	})
+	if utils.PasswordNeedsRehash(user.PasswordHash) {
+		upgradePasswordHash(r.Context(), user, credentials.Password)
+	}
+
+	principal, err := utils.LoadPrincipal(r.Context(), int(user.ID))
+	if err != nil {
+		log.Printf("ERROR: Failed to load principal for user %s: %v", user.Username, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !checkCanSignIn(w, principal) {
+		return
+	}
+
+	completeLogin(w, r, user, principal, credentials.UseCookies, false)
+}
+
+func RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	// Cookie sessions send an empty body
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		log.Printf("ERROR: Failed to decode refresh request body: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fromCookie := false
+	if payload.RefreshToken == "" {
+		payload.RefreshToken = utils.CookieValue(r, utils.RefreshCookieName)
+		fromCookie = true
+	}
 
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	sessionID, err := utils.ParseRefreshToken(payload.RefreshToken)
 	if err != nil {
-		log.Printf("ERROR: Failed to generate JWT token for user %s: %v",
-			user.Username, err)
+		log.Printf("ERROR: Malformed refresh token from IP %s: %v", r.RemoteAddr, err)
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	if fromCookie && !utils.ValidCSRFToken(r, sessionID) {
+		log.Printf("ERROR: Missing or invalid CSRF token on cookie refresh for session %s", sessionID)
+		http.Error(w, "invalid CSRF token", http.StatusForbidden)
+		return
+	}
+
+	session, err := db.GetSessionByID(r.Context(), sessionID)
+	if err != nil {
+		log.Printf("ERROR: Failed to find session %s for refresh: %v", sessionID, err)
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		log.Printf("ERROR: Refresh attempted on inactive session %s for user %d", session.ID, session.UserID)
+		http.Error(w, "Session has expired or been revoked", http.StatusUnauthorized)
+		return
+	}
+
+	presentedHash := helpers.HashToken(payload.RefreshToken)
+	if subtle.ConstantTimeCompare([]byte(presentedHash), []byte(session.RefreshTokenHash)) != 1 {
+		// An old refresh token being replayed means it was likely stolen, so kill the whole session
+		log.Printf("ERROR: Refresh token reuse detected for session %s, user %d - revoking session", session.ID, session.UserID)
+		if err := db.RevokeSession(r.Context(), session.ID); err != nil {
+			log.Printf("ERROR: Failed to revoke session %s after token reuse: %v", session.ID, err)
+		}
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := db.GetUserByID(r.Context(), int(session.UserID))
+	if err != nil {
+		log.Printf("ERROR: Failed to find user %d for session %s: %v", session.UserID, session.ID, err)
+		http.Error(w, "User not found", http.StatusUnauthorized)
+		return
+	}
+
+	refreshToken, err := utils.GenerateRefreshToken(session.ID)
+	if err != nil {
+		log.Printf("ERROR: Failed to generate refresh token for session %s: %v", session.ID, err)
 		http.Error(w, "Error generating token", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("INFO: Successful login - User: %s, ID: %d", user.Username, user.ID)
+	err = db.RotateSessionRefreshToken(r.Context(), session.ID, presentedHash, helpers.HashToken(refreshToken), time.Now().Add(utils.RefreshTokenTTL))
+	if err != nil {
+		log.Printf("ERROR: Failed to rotate refresh token for session %s: %v", session.ID, err)
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"token": tokenString,
-	})
+	accessToken, err := utils.GenerateAccessToken(user, session.ID)
+	if err != nil {
+		log.Printf("ERROR: Failed to generate JWT token for user %s: %v", user.Username, err)
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	tokens := &tokenResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(utils.AccessTokenTTL.Seconds()),
+		sessionID:    session.ID,
+	}
+
+	if err := writeSessionTokens(w, tokens, fromCookie); err != nil {
+		log.Printf("ERROR: Failed to send refreshed tokens for session %s: %v", session.ID, err)
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("INFO: Refreshed session %s for user %d", session.ID, user.ID)
+}
+
+func Logout(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	sessionID := r.Context().Value("session_id").(string)
+
+	if err := db.RevokeSession(r.Context(), sessionID); err != nil {
+		log.Printf("ERROR: Failed to revoke session %s for user %d: %v", sessionID, userID, err)
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+
+	utils.ClearSessionCookies(w)
+	log.Printf("INFO: User %d logged out of session %s", userID, sessionID)
+	w.WriteHeader(http.StatusOK)
+}
+
+func LogoutAllDevices(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+
+	if err := db.RevokeAllSessionsForUser(r.Context(), userID); err != nil {
+		log.Printf("ERROR: Failed to revoke all sessions for user %d: %v", userID, err)
+		http.Error(w, "Failed to log out of all devices", http.StatusInternalServerError)
+		return
+	}
+
+	utils.ClearSessionCookies(w)
+	log.Printf("INFO: User %d logged out of all devices", userID)
+	w.WriteHeader(http.StatusOK)
 }
 
 func GeneratePasswordResetCode(w http.ResponseWriter, r *http.Request) {
@@ -135,17 +314,23 @@ func GeneratePasswordResetCode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resetCode, err := db.GeneratePasswordResetCode(r.Context(), email.Email)
+	resetCode, err := db.GeneratePasswordResetCode(r.Context(), strings.ToLower(email.Email))
+	if errors.Is(err, db.ErrNoUserForEmail) {
+		// Respond the same as a real request so this endpoint can't be used to discover accounts
+		log.Printf("INFO: Password reset requested for unknown email %s", email.Email)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
 	if err != nil {
 		log.Printf("ERROR: Failed to generate password reset code for email %s: %v", email.Email, err)
 		http.Error(w, "Failed to generate password reset code", http.StatusInternalServerError)
 		return
 	}
 
-	emailBody := fmt.Sprintf(`Here is your password reset code, if you did not request this please contact an Admin: %s`, resetCode)
+	emailBody := fmt.Sprintf(`Here is your password reset code, it expires in 15 minutes. If you did not request this please contact an Admin: %s`, resetCode)
 	utils.NotifyUser(email.Email, "Password Reset Code", emailBody)
 
-	log.Printf("INFO: Password reset code generated for email %s, %s", email.Email, resetCode)
+	log.Printf("INFO: Password reset code generated for email %s", email.Email)
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -161,14 +346,14 @@ func VerifyPasswordResetCode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := db.VerifyPasswordResetCode(r.Context(), code.Code, code.Email)
+	err := db.VerifyPasswordResetCode(r.Context(), code.Code, strings.ToLower(code.Email))
 	if err != nil {
-		log.Printf("ERROR: Failed to verify password reset code %s: %v", code.Code, err)
-		http.Error(w, "Failed to verify password reset code", http.StatusInternalServerError)
+		log.Printf("ERROR: Failed to verify password reset code for email %s: %v", code.Email, err)
+		http.Error(w, "Failed to verify password reset code", passwordResetErrorStatus(err))
 		return
 	}
 
-	log.Printf("INFO: Password reset code %s successfully verified", code.Code)
+	log.Printf("INFO: Password reset code successfully verified for email %s", code.Email)
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -185,25 +370,323 @@ func ResetPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var v utils.Validator
+	v.Password("password", reset.Password)
+	if !v.Valid() {
+		log.Printf("ERROR: Password reset for email %s rejected, new password failed validation", reset.Email)
+		utils.WriteValidationErrors(w, v.Errors)
+		return
+	}
+
 	// Hash new password and commence with update
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(reset.Password), bcrypt.DefaultCost)
+	hashedPassword, err := utils.HashPassword(reset.Password)
 	if err != nil {
 		log.Printf("ERROR: Failed to hash password for user %s: %v", reset.Email, err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	err = db.ResetPassword(r.Context(), reset.Email, reset.Code, hashedPassword)
+	userID, err := db.ResetPassword(r.Context(), strings.ToLower(reset.Email), reset.Code, hashedPassword)
 	if err != nil {
-		log.Printf("ERROR: Failed to reset password for code %s: %v", reset.Code, err)
-		http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		log.Printf("ERROR: Failed to reset password for email %s: %v", reset.Email, err)
+		http.Error(w, "Failed to reset password", passwordResetErrorStatus(err))
 		return
 	}
 
-	log.Printf("INFO: Password successfully reset for code %s", reset.Code)
+	// Anyone holding the old password may have active sessions, so end them all
+	if err := db.RevokeAllSessionsForUser(r.Context(), userID); err != nil {
+		log.Printf("ERROR: Failed to revoke sessions for user %d after password reset: %v", userID, err)
+	}
+	utils.InvalidatePrincipal(userID)
+
+	log.Printf("INFO: Password successfully reset for user %d", userID)
 	w.WriteHeader(http.StatusOK)
 }
 
-func enableCors(w *http.ResponseWriter) {
-	(*w).Header().Set("Access-Control-Allow-Origin", "*")
+// passwordResetErrorStatus maps reset code failures to the status code the client should see
+func passwordResetErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, db.ErrTooManyResetAttempts):
+		return http.StatusTooManyRequests
+	case errors.Is(err, db.ErrInvalidResetCode), errors.Is(err, db.ErrExpiredResetCode):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+type tokenResponse struct {
+	// Left empty for cookie sessions, which get a CSRF token instead
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	CSRFToken    string `json:"csrf_token,omitempty"`
+	ExpiresIn    int    `json:"expires_in"`
+
+	// Set when the account must enroll in 2FA before it can use anything other than the enrollment endpoints
+	TwoFactorEnrollmentRequired bool `json:"two_factor_enrollment_required,omitempty"`
+
+	sessionID string
+}
+
+// checkCanSignIn writes an error and returns false if the account isn't allowed to start a new session
+func checkCanSignIn(w http.ResponseWriter, principal *models.Principal) bool {
+	if principal.Disabled {
+		log.Printf("ERROR: Sign in attempt for disabled account %s", principal.Username)
+		http.Error(w, "Account is disabled", http.StatusForbidden)
+		return false
+	}
+
+	if principal.PasswordResetRequired {
+		log.Printf("ERROR: Sign in attempt for account %s that must reset its password", principal.Username)
+		http.Error(w, "Password reset required", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// completeLogin finishes a sign-in whose first factor was accepted, either with a second factor challenge or tokens.
+// multiFactor skips the challenge when the first factor already counts as two, such as a user-verified passkey.
+func completeLogin(w http.ResponseWriter, r *http.Request, user *models.User, principal *models.Principal, useCookies, multiFactor bool) {
+	if principal.TwoFactorEnabled && !multiFactor {
+		challenge, err := beginTwoFactorChallenge(r.Context(), int(user.ID))
+		if err != nil {
+			log.Printf("ERROR: Failed to create two-factor challenge for user %s: %v", user.Username, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("INFO: First factor accepted, awaiting second factor - User: %s, ID: %d", user.Username, user.ID)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(challenge)
+		return
+	}
+
+	settings, err := utils.LoadSettings(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to load settings: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	clearFailedLogins(r.Context(), user)
+
+	tokens, err := startSession(r, user)
+	if err != nil {
+		log.Printf("ERROR: Failed to start session for user %s: %v", user.Username, err)
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+	tokens.TwoFactorEnrollmentRequired = principal.RequiresTwoFactor(settings)
+
+	if err := writeSessionTokens(w, tokens, useCookies); err != nil {
+		log.Printf("ERROR: Failed to send tokens to user %s: %v", user.Username, err)
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("INFO: Successful login - User: %s, ID: %d", user.Username, user.ID)
+}
+
+// startSession records a new server-side session for the user and issues its access and refresh tokens
+func startSession(r *http.Request, user *models.User) (*tokenResponse, error) {
+	sessionID, err := helpers.GenerateRandomString(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate session ID: %w", err)
+	}
+
+	refreshToken, err := utils.GenerateRefreshToken(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	session := models.Session{
+		ID:               sessionID,
+		UserID:           user.ID,
+		RefreshTokenHash: helpers.HashToken(refreshToken),
+		UserAgent:        r.UserAgent(),
+		IP:               helpers.GetClientIP(r),
+		ExpiresAt:        time.Now().Add(utils.RefreshTokenTTL),
+	}
+
+	if _, err := db.CreateSession(r.Context(), &session); err != nil {
+		return nil, err
+	}
+
+	accessToken, err := utils.GenerateAccessToken(user, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	}
+
+	return &tokenResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(utils.AccessTokenTTL.Seconds()),
+		sessionID:    sessionID,
+	}, nil
+}
+
+// writeSessionTokens sends the tokens in the response body, or for cookie sessions moves them into HttpOnly cookies
+func writeSessionTokens(w http.ResponseWriter, tokens *tokenResponse, useCookies bool) error {
+	if useCookies {
+		csrfToken, err := utils.SetSessionCookies(w, tokens.sessionID, tokens.Token, tokens.RefreshToken)
+		if err != nil {
+			return err
+		}
+		tokens.Token, tokens.RefreshToken, tokens.CSRFToken = "", "", csrfToken
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(tokens)
+}
+
+// upgradePasswordHash rehashes the password under the current policy, failures are logged and the old hash kept
+func upgradePasswordHash(ctx context.Context, user *models.User, password string) {
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		log.Printf("ERROR: Failed to rehash password for user %s: %v", user.Username, err)
+		return
+	}
+
+	if err := db.UpgradePasswordHash(ctx, int(user.ID), user.PasswordHash, hashedPassword); err != nil {
+		log.Printf("ERROR: Failed to store upgraded password hash for user %s: %v", user.Username, err)
+		return
+	}
+
+	log.Printf("INFO: Upgraded password hash for user %s", user.Username)
+}
+
+// checkNotLockedOut writes an error and returns false if the account is locked after repeated failed logins
+func checkNotLockedOut(w http.ResponseWriter, r *http.Request, user *models.User) bool {
+	lockout, err := db.GetLoginLockout(r.Context(), int(user.ID))
+	if err != nil {
+		log.Printf("ERROR: Failed to get login lockout state for user %s: %v", user.Username, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+
+	if lockout.IsLocked() {
+		log.Printf("ERROR: Sign in attempt for locked account %s", user.Username)
+		writeRetryAfter(w, time.Until(*lockout.LockedUntil))
+		http.Error(w, "Account is temporarily locked", http.StatusLocked)
+		return false
+	}
+
+	return true
+}
+
+// checkIPThrottle writes an error and returns false if the client's IP must wait before another login attempt
+func checkIPThrottle(w http.ResponseWriter, r *http.Request) bool {
+	ip := helpers.GetClientIP(r)
+	if wait := utils.IPLoginWait(ip); wait > 0 {
+		log.Printf("ERROR: Login throttled for IP %s, retry in %v", ip, wait)
+		writeRetryAfter(w, wait)
+		http.Error(w, "Too many login attempts, please try again later", http.StatusTooManyRequests)
+		return false
+	}
+
+	return true
+}
+
+// checkAccountThrottle writes an error and returns false if the account is locked, or must back off after recent
+// failed logins. Every check of a password or second factor goes through it before verifying anything.
+func checkAccountThrottle(w http.ResponseWriter, r *http.Request, user *models.User) bool {
+	lockout, err := db.GetLoginLockout(r.Context(), int(user.ID))
+	if err != nil {
+		log.Printf("ERROR: Failed to get login lockout state for user %s: %v", user.Username, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+
+	if lockout.IsLocked() {
+		log.Printf("ERROR: Login attempt for locked account %s from IP %s", user.Username, helpers.GetClientIP(r))
+		writeRetryAfter(w, time.Until(*lockout.LockedUntil))
+		http.Error(w, "Account is temporarily locked", http.StatusLocked)
+		return false
+	}
+
+	if lockout.LastFailedLoginAt != nil {
+		if wait := utils.LoginBackoff(lockout.FailedAttempts, *lockout.LastFailedLoginAt, utils.AccountBackoffThreshold); wait > 0 {
+			log.Printf("ERROR: Login throttled for user %s, retry in %v", user.Username, wait)
+			writeRetryAfter(w, wait)
+			http.Error(w, "Too many login attempts, please try again later", http.StatusTooManyRequests)
+			return false
+		}
+	}
+
+	return true
+}
+
+// recordFailedLogin counts a wrong password or second factor against the IP and the account, telling the owner when
+// it locks the account
+func recordFailedLogin(r *http.Request, user *models.User) {
+	utils.RecordIPLoginFailure(helpers.GetClientIP(r))
+
+	locked, err := db.RecordFailedLogin(r.Context(), int(user.ID), utils.MaxAccountLoginFailures, time.Now().Add(utils.AccountLockoutDuration))
+	if err != nil {
+		log.Printf("ERROR: Failed to record failed login for user %s: %v", user.Username, err)
+		return
+	}
+
+	if locked {
+		log.Printf("INFO: Account %s locked after repeated failed logins", user.Username)
+		emailBody := fmt.Sprintf(`Your account has been locked for %d minutes after too many failed login attempts. If this wasn't you, please contact an Admin.`,
+			int(utils.AccountLockoutDuration.Minutes()))
+		go utils.NotifyUser(user.Email, "Account Locked", emailBody)
+	}
+}
+
+// clearFailedLogins resets the account's failure count once a sign in has passed every factor. A correct password
+// alone doesn't, or it would hand out a fresh budget of second factor guesses.
+func clearFailedLogins(ctx context.Context, user *models.User) {
+	if err := db.ClearFailedLogins(ctx, int(user.ID)); err != nil {
+		log.Printf("ERROR: Failed to clear failed logins for user %s: %v", user.Username, err)
+	}
+}
+
+// verifyCurrentPassword re-checks a signed in user's password before a sensitive change, throttled and counted like
+// Login so a stolen session can't be used to guess it. It writes the error response when it returns false.
+func verifyCurrentPassword(w http.ResponseWriter, r *http.Request, user *models.User, password string) bool {
+	if !checkIPThrottle(w, r) || !checkAccountThrottle(w, r, user) {
+		return false
+	}
+
+	match, err := utils.VerifyPassword(user.PasswordHash, password)
+	if err != nil {
+		log.Printf("ERROR: Failed to verify current password for user %d: %v", user.ID, err)
+		match = false
+	}
+
+	if !match {
+		log.Printf("ERROR: Incorrect current password for user %d from IP %s", user.ID, helpers.GetClientIP(r))
+		recordFailedLogin(r, user)
+		http.Error(w, "Current password is incorrect", http.StatusUnauthorized)
+		return false
+	}
+
+	return true
+}
+
+// verifyCurrentSecondFactor re-checks a signed in user's TOTP or recovery code, counted the same way as
+// verifyCurrentPassword. It writes the error response when it returns false.
+func verifyCurrentSecondFactor(w http.ResponseWriter, r *http.Request, user *models.User, code, recoveryCode string) bool {
+	ok, err := verifySecondFactor(r.Context(), int(user.ID), code, recoveryCode)
+	if err != nil {
+		log.Printf("ERROR: Failed to verify second factor for user %d: %v", user.ID, err)
+	}
+
+	if !ok {
+		log.Printf("ERROR: Invalid second factor for user %d from IP %s", user.ID, helpers.GetClientIP(r))
+		recordFailedLogin(r, user)
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return false
+	}
+
+	return true
+}
+
+// writeRetryAfter tells the client how many seconds to wait before retrying
+func writeRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
 }
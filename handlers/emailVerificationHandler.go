@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"nest/db"
+	"nest/utils"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	emailVerificationTTL     = 48 * time.Hour
+	emailRevertTTL           = 7 * 24 * time.Hour
+	emailVerificationPurpose = "email-verification"
+	emailRevertPurpose       = "email-revert"
+)
+
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("ERROR: Failed to decode email verification request: %v", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	userID, email, err := parseEmailToken(emailVerificationPurpose, payload.Token)
+	if err != nil {
+		log.Printf("ERROR: Invalid email verification token: %v", err)
+		http.Error(w, "Invalid or expired link", http.StatusBadRequest)
+		return
+	}
+
+	previousEmail, err := db.ConfirmEmail(r.Context(), userID, email)
+	if err != nil {
+		log.Printf("ERROR: Failed to confirm email %s for user %d: %v", email, userID, err)
+		http.Error(w, "Invalid or expired link", http.StatusBadRequest)
+		return
+	}
+
+	if previousEmail != "" {
+		revertToken, err := newEmailRevertToken(r.Context(), userID, previousEmail, email)
+		if err != nil {
+			log.Printf("ERROR: Failed to create email revert link for user %d: %v", userID, err)
+		} else {
+			link := fmt.Sprintf("%s/email/revert?token=%s", utils.AppURL, url.QueryEscape(revertToken))
+			emailBody := fmt.Sprintf(`The email address on your account was changed to %s.
+
+If you did not make this change, use this link within 7 days to switch back to this address and sign out all devices: %s`,
+				email,
+				link)
+			go utils.NotifyUser(previousEmail, "Your Email Was Changed", emailBody)
+		}
+	}
+
+	log.Printf("INFO: Email %s verified for user %d", email, userID)
+	w.WriteHeader(http.StatusOK)
+}
+
+func RevertEmailChange(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("ERROR: Failed to decode email revert request: %v", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	subject, err := utils.ParseSignedToken(emailRevertPurpose, payload.Token)
+	if err != nil {
+		log.Printf("ERROR: Invalid email revert token: %v", err)
+		http.Error(w, "Invalid or expired link", http.StatusBadRequest)
+		return
+	}
+	revertID, err := strconv.Atoi(subject)
+	if err != nil {
+		log.Printf("ERROR: Invalid email revert ID in token: %v", err)
+		http.Error(w, "Invalid or expired link", http.StatusBadRequest)
+		return
+	}
+
+	userID, email, err := db.RevertEmail(r.Context(), revertID)
+	if errors.Is(err, db.ErrInvalidEmailRevert) {
+		log.Printf("ERROR: Email revert %d is used, expired or out of date: %v", revertID, err)
+		http.Error(w, "Invalid or expired link", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, db.ErrEmailTaken) {
+		log.Printf("ERROR: Email revert %d refused, the previous address now belongs to another account", revertID)
+		http.Error(w, "The previous email address is now used by another account", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to apply email revert %d: %v", revertID, err)
+		http.Error(w, "Failed to revert email", http.StatusInternalServerError)
+		return
+	}
+
+	// Whoever changed the address may still be signed in
+	if err := db.RevokeAllSessionsForUser(r.Context(), userID); err != nil {
+		log.Printf("ERROR: Failed to revoke sessions for user %d after email revert: %v", userID, err)
+	}
+
+	log.Printf("INFO: Email for user %d reverted to %s", userID, email)
+	w.WriteHeader(http.StatusOK)
+}
+
+func ResendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+
+	user, err := db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to find user %d: %v", userID, err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	email := user.Email
+	if user.PendingEmail != nil {
+		email = *user.PendingEmail
+	} else if user.EmailVerifiedAt != nil {
+		log.Printf("ERROR: User %d requested verification for an already verified email", userID)
+		http.Error(w, "Email is already verified", http.StatusConflict)
+		return
+	}
+
+	if err := sendEmailVerification(userID, email); err != nil {
+		log.Printf("ERROR: Failed to send email verification to user %d: %v", userID, err)
+		http.Error(w, "Failed to send verification email", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("INFO: Email verification resent to user %d", userID)
+	w.WriteHeader(http.StatusOK)
+}
+
+// requestEmailChange parks the new address as pending and emails it a verification link
+func requestEmailChange(ctx context.Context, userID int, email string) error {
+	email = strings.TrimSpace(email)
+
+	taken, err := db.IsEmailTaken(ctx, email)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return db.ErrEmailTaken
+	}
+
+	if err := db.SetPendingEmail(ctx, userID, email); err != nil {
+		return err
+	}
+
+	return sendEmailVerification(userID, email)
+}
+
+// newEmailRevertToken stores a single-use revert link for an email change and signs a token naming it
+func newEmailRevertToken(ctx context.Context, userID int, previousEmail, changedTo string) (string, error) {
+	revertID, err := db.CreateEmailRevert(ctx, userID, previousEmail, changedTo, time.Now().Add(emailRevertTTL))
+	if err != nil {
+		return "", err
+	}
+
+	return utils.GenerateSignedToken(emailRevertPurpose, strconv.Itoa(revertID), emailRevertTTL)
+}
+
+func sendEmailVerification(userID int, email string) error {
+	token, err := utils.GenerateSignedToken(emailVerificationPurpose, emailTokenSubject(userID, email), emailVerificationTTL)
+	if err != nil {
+		return fmt.Errorf("failed to sign email verification token: %w", err)
+	}
+
+	link := fmt.Sprintf("%s/email/verify?token=%s", utils.AppURL, url.QueryEscape(token))
+	emailBody := fmt.Sprintf(`Please confirm this email address for your account by opening this link within 48 hours: %s
+
+If you did not request this, you can ignore this email.`, link)
+	go utils.NotifyUser(email, "Confirm Your Email", emailBody)
+
+	return nil
+}
+
+// Email tokens are bound to both the user and the exact address so a link can't confirm a different one
+func emailTokenSubject(userID int, email string) string {
+	return fmt.Sprintf("%d:%s", userID, email)
+}
+
+func parseEmailToken(purpose, token string) (int, string, error) {
+	subject, err := utils.ParseSignedToken(purpose, token)
+	if err != nil {
+		return 0, "", err
+	}
+
+	idStr, email, ok := strings.Cut(subject, ":")
+	if !ok {
+		return 0, "", errors.New("malformed token subject")
+	}
+
+	userID, err := strconv.Atoi(idStr)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid user ID in token: %w", err)
+	}
+
+	return userID, email, nil
+}
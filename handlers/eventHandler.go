@@ -23,13 +23,6 @@ func GetEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !utils.IsEventCreatorOrGroupMemberOrSA(r, eventID) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to access Event %d", reqUser, eventID)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
-		return
-	}
-
 	event, err := db.GetEventByID(r.Context(), eventID)
 	if err != nil {
 		log.Printf("ERROR: Failed to find event with ID %d: %v", eventID, err)
@@ -38,7 +31,7 @@ func GetEvent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("INFO: Event %d successfully retrieved by user %d", eventID, r.Context().Value("user_id").(int))
-	json.NewEncoder(w).Encode(event)
+	json.NewEncoder(w).Encode(models.EventView(event, utils.EventViewFor(r, event)))
 }
 
 func CreateEvent(w http.ResponseWriter, r *http.Request) {
@@ -50,13 +43,13 @@ func CreateEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := utils.ValidateNewEvent(eventDTO); err != nil {
-		log.Printf("ERROR: Event validation failed: %v", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if errs := utils.ValidateNewEvent(eventDTO); len(errs) > 0 {
+		log.Printf("ERROR: Event validation failed: %v", errs)
+		utils.WriteValidationErrors(w, errs)
 		return
 	}
 
-	if !utils.IsGroupMemberOrSA(r, int(eventDTO.GroupID)) {
+	if !utils.Authorize(r, utils.ActionGroupEventsCreate, int(eventDTO.GroupID)) {
 		reqUser := r.Context().Value("user_id").(int)
 		log.Printf("ERROR: Access denied - User %d attempted to create event in group %d", reqUser, eventDTO.GroupID)
 		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
@@ -118,7 +111,7 @@ You can view it here: %s`,
 	log.Printf("INFO: New event created - ID: %d, Name: %s, Group: %d, Creator: %d",
 		createdEvent.ID, createdEvent.Name, createdEvent.GroupID, createdEvent.CreatedByID)
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(createdEvent)
+	json.NewEncoder(w).Encode(models.NewMemberEvent(createdEvent))
 }
 
 func ReactToEvent(w http.ResponseWriter, r *http.Request) {
@@ -130,21 +123,14 @@ func ReactToEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	event, err := db.GetEventByID(r.Context(), userReaction.EventID)
-	if err != nil {
-		log.Printf("ERROR: Failed to get event from reaction request: %v", err)
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
-		return
-	}
-
 	reqUser := r.Context().Value("user_id").(int)
-	if !utils.IsGroupMemberOrSA(r, int(event.GroupID)) {
+	if !utils.Authorize(r, utils.ActionEventReact, userReaction.EventID) {
 		log.Printf("ERROR: Access denied - User %d attempted to react to event %d", reqUser, userReaction.EventID)
 		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
 		return
 	}
 
-	err = db.ReactToEvent(r.Context(), reqUser, userReaction.EventID, &userReaction.Reaction)
+	err := db.ReactToEvent(r.Context(), reqUser, userReaction.EventID, &userReaction.Reaction)
 	if err != nil {
 		log.Printf("ERROR: Failed to react to event %d: %v", userReaction.EventID, err)
 		http.Error(w, "Failed to react to event", http.StatusInternalServerError)
@@ -165,21 +151,14 @@ func UnreactToEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	event, err := db.GetEventByID(r.Context(), userReaction.EventID)
-	if err != nil {
-		log.Printf("ERROR: Failed to get event from reaction request: %v", err)
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
-		return
-	}
-
 	reqUser := r.Context().Value("user_id").(int)
-	if !utils.IsGroupMemberOrSA(r, int(event.GroupID)) {
+	if !utils.Authorize(r, utils.ActionEventReact, userReaction.EventID) {
 		log.Printf("ERROR: Access denied - User %d attempted to unreact to event %d", reqUser, userReaction.EventID)
 		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
 		return
 	}
 
-	err = db.UnreactToEvent(r.Context(), reqUser, userReaction.EventID, &userReaction.Reaction)
+	err := db.UnreactToEvent(r.Context(), reqUser, userReaction.EventID, &userReaction.Reaction)
 	if err != nil {
 		log.Printf("ERROR: Failed to unreact to event %d: %v", userReaction.EventID, err)
 		http.Error(w, "Failed to unreact to event", http.StatusInternalServerError)
@@ -194,19 +173,12 @@ func UnreactToEvent(w http.ResponseWriter, r *http.Request) {
 func GetReactionsByEvent(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	eventID, err := strconv.Atoi(idStr)
-	userID := r.Context().Value("user_id").(int)
 	if err != nil {
 		log.Printf("ERROR: Invalid event ID format: %s: %v", idStr, err)
 		http.Error(w, "Invalid ID", http.StatusBadRequest)
 		return
 	}
 
-	if !utils.IsSelfOrSA(r, userID) {
-		log.Printf("ERROR: Access denied - User %d attempted to access event reactions for event %d", userID, eventID)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
-		return
-	}
-
 	reactions, err := db.GetReactionsByEvent(r.Context(), eventID)
 	if err != nil {
 		log.Printf("ERROR: Failed to retrieve reactions for event %d: %v", eventID, err)
@@ -227,13 +199,6 @@ func DeleteEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !utils.IsEventCreatorOrGroupAdminOrSA(r, eventID) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to delete Event %d", reqUser, eventID)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
-		return
-	}
-
 	// Get event details before deletion for logging
 	event, err := db.GetEventByID(r.Context(), eventID)
 	if err != nil {
@@ -284,6 +249,14 @@ You can view it here: %s`,
 		utils.NotifyAllUsersInGroup(int(event.GroupID), "Event Deleted", emailBody)
 	}
 
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditEventDelete,
+		TargetType: utils.AuditTargetEvent,
+		TargetID:   eventID,
+		GroupID:    int(event.GroupID),
+		Before:     event,
+	})
+
 	log.Printf("INFO: Event deleted - ID: %d, Name: %s, Group: %d",
 		event.ID, event.Name, event.GroupID)
 	w.WriteHeader(http.StatusOK)
@@ -298,13 +271,6 @@ func GetAllEventsForUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !utils.IsSelfOrSA(r, userID) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to access events for User %d", reqUser, userID)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
-		return
-	}
-
 	events, err := db.GetAllEventsByUser(r.Context(), userID)
 	if err != nil {
 		log.Printf("ERROR: Failed to retrieve events for user %d: %v", userID, err)
@@ -312,8 +278,13 @@ func GetAllEventsForUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	views := make([]interface{}, 0, len(events))
+	for i := range events {
+		views = append(views, models.EventView(&events[i], utils.EventViewFor(r, &events[i])))
+	}
+
 	log.Printf("INFO: Successfully retrieved events for user %d", userID)
-	json.NewEncoder(w).Encode(events)
+	json.NewEncoder(w).Encode(views)
 }
 
 func GetAllEventsForGroup(w http.ResponseWriter, r *http.Request) {
@@ -332,13 +303,6 @@ func GetAllEventsForGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !utils.IsGroupMemberOrSA(r, groupID) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to access events for Group %d", reqUser, groupID)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
-		return
-	}
-
 	events, err := db.GetAllEventsByGroup(r.Context(), groupID)
 	if err != nil {
 		log.Printf("ERROR: Failed to retrieve events for group %d: %v", groupID, err)
@@ -346,8 +310,14 @@ func GetAllEventsForGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	view := utils.GroupViewFor(r, groupID)
+	views := make([]interface{}, 0, len(events))
+	for i := range events {
+		views = append(views, models.EventView(&events[i], view))
+	}
+
 	log.Printf("INFO: Successfully retrieved events for group %d", groupID)
-	json.NewEncoder(w).Encode(events)
+	json.NewEncoder(w).Encode(views)
 }
 
 func UpdateEventName(w http.ResponseWriter, r *http.Request) {
@@ -362,17 +332,24 @@ func UpdateEventName(w http.ResponseWriter, r *http.Request) {
 	var payload struct {
 		EventName string `json:"event_name"`
 	}
-	err = json.NewDecoder(r.Body).Decode(&payload)
-	if err != nil || payload.EventName == "" {
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		log.Printf("ERROR: Invalid request payload for event name update: %v", err)
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
 
-	if !utils.IsEventCreatorOrGroupAdminOrSA(r, eventID) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to update Event %d", reqUser, eventID)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
+	before, err := db.GetEventByID(r.Context(), eventID)
+	if err != nil {
+		log.Printf("ERROR: Failed to find event with ID %d: %v", eventID, err)
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+
+	var v utils.Validator
+	v.Text("event_name", payload.EventName, true, utils.MaxEventNameLength)
+	if !v.Valid() {
+		log.Printf("ERROR: Event name update for event %d failed validation: %v", eventID, v.Errors)
+		utils.WriteValidationErrors(w, v.Errors)
 		return
 	}
 
@@ -383,6 +360,8 @@ func UpdateEventName(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordEventUpdate(r, before)
+
 	log.Printf("INFO: Event name updated for event %d", eventID)
 	w.WriteHeader(http.StatusOK)
 }
@@ -399,17 +378,24 @@ func UpdateEventDescription(w http.ResponseWriter, r *http.Request) {
 	var payload struct {
 		EventDescription string `json:"event_description"`
 	}
-	err = json.NewDecoder(r.Body).Decode(&payload)
-	if err != nil || payload.EventDescription == "" {
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		log.Printf("ERROR: Invalid request payload for event description update: %v", err)
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
 
-	if !utils.IsEventCreatorOrGroupAdminOrSA(r, eventID) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to update Event %d", reqUser, eventID)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
+	before, err := db.GetEventByID(r.Context(), eventID)
+	if err != nil {
+		log.Printf("ERROR: Failed to find event with ID %d: %v", eventID, err)
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+
+	var v utils.Validator
+	v.Text("event_description", payload.EventDescription, true, utils.MaxEventDescriptionLength)
+	if !v.Valid() {
+		log.Printf("ERROR: Event description update for event %d failed validation: %v", eventID, v.Errors)
+		utils.WriteValidationErrors(w, v.Errors)
 		return
 	}
 
@@ -420,6 +406,8 @@ func UpdateEventDescription(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordEventUpdate(r, before)
+
 	log.Printf("INFO: Event description updated for event %d", eventID)
 	w.WriteHeader(http.StatusOK)
 }
@@ -436,17 +424,24 @@ func UpdateEventStartTime(w http.ResponseWriter, r *http.Request) {
 	var payload struct {
 		EventStartTime time.Time `json:"event_start_time"`
 	}
-	err = json.NewDecoder(r.Body).Decode(&payload)
-	if err != nil || payload.EventStartTime.IsZero() {
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		log.Printf("ERROR: Invalid request payload for event start time update: %v", err)
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
 
-	if !utils.IsEventCreatorOrGroupAdminOrSA(r, eventID) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to update Event %d", reqUser, eventID)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
+	before, err := db.GetEventByID(r.Context(), eventID)
+	if err != nil {
+		log.Printf("ERROR: Failed to find event with ID %d: %v", eventID, err)
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+
+	var v utils.Validator
+	v.TimeRange("event_start_time", payload.EventStartTime, "event_start_time", before.EndTime)
+	if !v.Valid() {
+		log.Printf("ERROR: Event start time update for event %d failed validation: %v", eventID, v.Errors)
+		utils.WriteValidationErrors(w, v.Errors)
 		return
 	}
 
@@ -457,6 +452,8 @@ func UpdateEventStartTime(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordEventUpdate(r, before)
+
 	log.Printf("INFO: Event start time updated for event %d", eventID)
 	w.WriteHeader(http.StatusOK)
 }
@@ -473,17 +470,24 @@ func UpdateEventEndTime(w http.ResponseWriter, r *http.Request) {
 	var payload struct {
 		EventEndTime time.Time `json:"event_end_time"`
 	}
-	err = json.NewDecoder(r.Body).Decode(&payload)
-	if err != nil || payload.EventEndTime.IsZero() {
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		log.Printf("ERROR: Invalid request payload for event end time update: %v", err)
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
 
-	if !utils.IsEventCreatorOrGroupAdminOrSA(r, eventID) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to update Event %d", reqUser, eventID)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
+	before, err := db.GetEventByID(r.Context(), eventID)
+	if err != nil {
+		log.Printf("ERROR: Failed to find event with ID %d: %v", eventID, err)
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+
+	var v utils.Validator
+	v.TimeRange("event_end_time", before.StartTime, "event_end_time", payload.EventEndTime)
+	if !v.Valid() {
+		log.Printf("ERROR: Event end time update for event %d failed validation: %v", eventID, v.Errors)
+		utils.WriteValidationErrors(w, v.Errors)
 		return
 	}
 
@@ -494,6 +498,8 @@ func UpdateEventEndTime(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordEventUpdate(r, before)
+
 	log.Printf("INFO: Event end time updated for event %d", eventID)
 	w.WriteHeader(http.StatusOK)
 }
@@ -507,13 +513,6 @@ func UpdateEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !utils.IsEventCreatorOrGroupAdminOrSA(r, id) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to update Event %d", reqUser, id)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
-		return
-	}
-
 	var updates map[string]interface{}
 	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
 		log.Printf("ERROR: Failed to decode update request for event %d: %v", id, err)
@@ -521,41 +520,18 @@ func UpdateEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if startTimeStr, ok := updates["start_time"].(string); ok {
-		startTime, err := time.Parse(time.RFC3339, startTimeStr)
-		if err != nil {
-			log.Printf("ERROR: Invalid start_time format for event %d: %v", id, err)
-			http.Error(w, "Invalid start_time format", http.StatusBadRequest)
-			return
-		}
-		updates["start_time"] = startTime
-	}
-
-	if endTimeStr, ok := updates["end_time"].(string); ok {
-		endTime, err := time.Parse(time.RFC3339, endTimeStr)
-		if err != nil {
-			log.Printf("ERROR: Invalid end_time format for event %d: %v", id, err)
-			http.Error(w, "Invalid end_time format", http.StatusBadRequest)
-			return
-		}
-		updates["end_time"] = endTime
-	}
-
-	// Validate that only allowed fields are being updated
-	allowedFields := map[string]bool{
-		"name":        true,
-		"description": true,
-		"start_time":  true,
-		"end_time":    true,
-		"location":    true,
+	before, err := db.GetEventByID(r.Context(), id)
+	if err != nil {
+		log.Printf("ERROR: Failed to find event with ID %d: %v", id, err)
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
 	}
 
-	for field := range updates {
-		if !allowedFields[field] {
-			log.Printf("ERROR: Attempt to update invalid field '%s' for event %d", field, id)
-			http.Error(w, "Invalid field in update request", http.StatusBadRequest)
-			return
-		}
+	// Also turns the times into time.Time for db.UpdateEvent
+	if errs := utils.ValidateEventUpdate(before, updates); len(errs) > 0 {
+		log.Printf("ERROR: Update for event %d failed validation: %v", id, errs)
+		utils.WriteValidationErrors(w, errs)
+		return
 	}
 
 	err = db.UpdateEvent(r.Context(), id, updates)
@@ -565,6 +541,8 @@ func UpdateEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordEventUpdate(r, before)
+
 	log.Printf("INFO: Successfully updated fields for event %d: %v", id, updates)
 	w.WriteHeader(http.StatusOK)
 }
@@ -578,13 +556,6 @@ func GetEventAttendance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !utils.IsEventCreatorOrGroupMemberOrSA(r, eventID) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to access attendance for Event %d", reqUser, eventID)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
-		return
-	}
-
 	attendance, err := db.GetEventAttendance(r.Context(), eventID)
 	if err != nil {
 		log.Printf("ERROR: Failed to get attendance for event %d: %v", eventID, err)
@@ -605,16 +576,25 @@ func UpdateEventAttendance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !utils.IsEventCreatorOrGroupMemberOrSA(r, attendanceData.EventID) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to update attendance for Event %d", reqUser, attendanceData.EventID)
+	reqUser := r.Context().Value("user_id").(int)
+	action := utils.ActionEventAttendanceUpdate
+	if attendanceData.UserID != reqUser {
+		action = utils.ActionEventAttendanceManage
+	}
+
+	if !utils.Authorize(r, action, attendanceData.EventID) {
+		log.Printf("ERROR: Access denied - User %d attempted to update attendance for User %d on Event %d", reqUser, attendanceData.UserID, attendanceData.EventID)
 		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
 		return
 	}
 
+	var v utils.Validator
 	if attendanceData.Status != "going" && attendanceData.Status != "not-going" && attendanceData.Status != "" {
+		v.Add("status", utils.ValidationInvalid, "Must be going, not-going or empty")
+	}
+	if !v.Valid() {
 		log.Printf("ERROR: Invalid attendance status: %s", attendanceData.Status)
-		http.Error(w, "Invalid attendance status", http.StatusBadRequest)
+		utils.WriteValidationErrors(w, v.Errors)
 		return
 	}
 
@@ -629,3 +609,20 @@ func UpdateEventAttendance(w http.ResponseWriter, r *http.Request) {
 		attendanceData.EventID, attendanceData.UserID, attendanceData.Status)
 	w.WriteHeader(http.StatusOK)
 }
+
+// recordEventUpdate audits an event change with snapshots from before and after the update
+func recordEventUpdate(r *http.Request, before *models.Event) {
+	after, err := db.GetEventByID(r.Context(), int(before.ID))
+	if err != nil {
+		log.Printf("ERROR: Failed to reload event %d for audit: %v", before.ID, err)
+	}
+
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditEventUpdate,
+		TargetType: utils.AuditTargetEvent,
+		TargetID:   int(before.ID),
+		GroupID:    int(before.GroupID),
+		Before:     before,
+		After:      after,
+	})
+}
@@ -22,13 +22,6 @@ func GetGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !utils.IsGroupMemberOrSA(r, id) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to access Group %d", reqUser, id)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
-		return
-	}
-
 	group, err := db.GetGroupByID(r.Context(), id)
 	if err != nil {
 		log.Printf("ERROR: Failed to find group with ID %d: %v", id, err)
@@ -37,7 +30,7 @@ func GetGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("INFO: Group %d successfully retrieved by user %d", id, r.Context().Value("user_id").(int))
-	json.NewEncoder(w).Encode(group)
+	json.NewEncoder(w).Encode(models.GroupView(group, utils.GroupViewFor(r, id)))
 }
 
 func CreateGroup(w http.ResponseWriter, r *http.Request) {
@@ -49,9 +42,16 @@ func CreateGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := utils.ValidateNewGroup(groupDTO); err != nil {
-		log.Printf("ERROR: Group validation failed: %v", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if errs := utils.ValidateNewGroup(groupDTO); len(errs) > 0 {
+		log.Printf("ERROR: Group validation failed: %v", errs)
+		utils.WriteValidationErrors(w, errs)
+		return
+	}
+
+	// A token limited to specific groups could never use a new group
+	if utils.IsGroupScopedToken(r) {
+		log.Printf("ERROR: Access denied - Group-scoped token attempted to create a group")
+		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
 		return
 	}
 
@@ -82,11 +82,20 @@ func CreateGroup(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to create group", http.StatusInternalServerError)
 		return
 	}
+	utils.InvalidatePrincipal(int(createdGroup.CreatedByID))
+
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditGroupCreate,
+		TargetType: utils.AuditTargetGroup,
+		TargetID:   int(createdGroup.ID),
+		GroupID:    int(createdGroup.ID),
+		After:      createdGroup,
+	})
 
 	log.Printf("INFO: New group created - ID: %d, Name: %s, Creator: %d",
 		createdGroup.ID, createdGroup.Name, createdGroup.CreatedByID)
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(createdGroup)
+	json.NewEncoder(w).Encode(models.NewAdminGroup(createdGroup))
 }
 
 func DeleteGroup(w http.ResponseWriter, r *http.Request) {
@@ -98,13 +107,6 @@ func DeleteGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !utils.IsGroupAdminOrSA(r, groupID) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to delete Group %d", reqUser, groupID)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
-		return
-	}
-
 	// Get group details before deletion for logging
 	group, err := db.GetGroupByID(r.Context(), groupID)
 	if err != nil {
@@ -120,6 +122,14 @@ func DeleteGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditGroupDelete,
+		TargetType: utils.AuditTargetGroup,
+		TargetID:   groupID,
+		GroupID:    groupID,
+		Before:     group,
+	})
+
 	log.Printf("INFO: Group deleted - ID: %d, Name: %s", group.ID, group.Name)
 	w.WriteHeader(http.StatusOK)
 }
@@ -141,13 +151,6 @@ func AddUserToGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !utils.IsGroupAdminOrSA(r, groupID) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to add members to Group %d", reqUser, groupID)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
-		return
-	}
-
 	var payload struct {
 		RoleInGroup models.Role `json:"role_in_group"`
 	}
@@ -165,6 +168,15 @@ func AddUserToGroup(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to add user to group", http.StatusInternalServerError)
 		return
 	}
+	utils.InvalidatePrincipal(userID)
+
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditGroupMemberAdd,
+		TargetType: utils.AuditTargetUser,
+		TargetID:   userID,
+		GroupID:    groupID,
+		After:      map[string]interface{}{"role_in_group": payload.RoleInGroup},
+	})
 
 	log.Printf("INFO: User %d added to group %d with role %s", userID, groupID, payload.RoleInGroup)
 	w.WriteHeader(http.StatusOK)
@@ -187,19 +199,20 @@ func RemoveUserFromGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !utils.IsGroupAdminOrSA(r, groupID) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to remove members from Group %d", reqUser, groupID)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
-		return
-	}
-
 	err = db.RemoveGroupMember(r.Context(), userID, groupID)
 	if err != nil {
 		log.Printf("ERROR: Failed to remove user %d from group %d: %v", userID, groupID, err)
 		http.Error(w, "Failed to remove user from group", http.StatusInternalServerError)
 		return
 	}
+	utils.InvalidatePrincipal(userID)
+
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditGroupMemberRemove,
+		TargetType: utils.AuditTargetUser,
+		TargetID:   userID,
+		GroupID:    groupID,
+	})
 
 	log.Printf("INFO: User %d removed from group %d", userID, groupID)
 	w.WriteHeader(http.StatusOK)
@@ -217,18 +230,20 @@ func LeaveGroup(w http.ResponseWriter, r *http.Request) {
 	// Id of the user making the request
 	userID := r.Context().Value("user_id").(int)
 
-	if !utils.IsGroupMemberOrSA(r, groupID) {
-		log.Printf("ERROR: Access denied - User %d attempted to leave Group %d they're not a member of", userID, groupID)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
-		return
-	}
-
 	err = db.RemoveGroupMember(r.Context(), userID, groupID)
 	if err != nil {
 		log.Printf("ERROR: Failed to remove user %d from group %d: %v", userID, groupID, err)
 		http.Error(w, "Failed to leave group", http.StatusInternalServerError)
 		return
 	}
+	utils.InvalidatePrincipal(userID)
+
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditGroupLeave,
+		TargetType: utils.AuditTargetUser,
+		TargetID:   userID,
+		GroupID:    groupID,
+	})
 
 	log.Printf("INFO: User %d left group %d", userID, groupID)
 	w.WriteHeader(http.StatusOK)
@@ -243,14 +258,7 @@ func GetAllMembersInGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !utils.IsGroupMemberOrSA(r, groupID) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to view members of Group %d", reqUser, groupID)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
-		return
-	}
-
-	members, err := db.GetAllMembersForGroup(r.Context(), groupID)
+	members, err := db.GetAllMembersForGroup(r.Context(), groupID, utils.ViewerFor(r))
 	if err != nil {
 		log.Printf("ERROR: Failed to retrieve members for group %d: %v", groupID, err)
 		http.Error(w, "Failed to get group members", http.StatusInternalServerError)
@@ -258,7 +266,7 @@ func GetAllMembersInGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("INFO: Retrieved %d members for group %d", len(members), groupID)
-	json.NewEncoder(w).Encode(members)
+	json.NewEncoder(w).Encode(memberViews(r, groupID, members))
 }
 
 func GetAllNonMembersInGroup(w http.ResponseWriter, r *http.Request) {
@@ -270,14 +278,7 @@ func GetAllNonMembersInGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !utils.IsGroupAdminOrSA(r, groupID) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to view non-members of Group %d", reqUser, groupID)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
-		return
-	}
-
-	nonMembers, err := db.GetAllNonMembersForGroup(r.Context(), groupID)
+	nonMembers, err := db.GetAllNonMembersForGroup(r.Context(), groupID, utils.ViewerFor(r))
 	if err != nil {
 		log.Printf("ERROR: Failed to retrieve non-members for group %d: %v", groupID, err)
 		http.Error(w, "Failed to get non-members", http.StatusInternalServerError)
@@ -285,7 +286,7 @@ func GetAllNonMembersInGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("INFO: Retrieved %d non-members for group %d", len(nonMembers), groupID)
-	json.NewEncoder(w).Encode(nonMembers)
+	json.NewEncoder(w).Encode(memberViews(r, groupID, nonMembers))
 }
 
 func GetAllNonAdminMembersInGroup(w http.ResponseWriter, r *http.Request) {
@@ -297,14 +298,7 @@ func GetAllNonAdminMembersInGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !utils.IsGroupAdminOrSA(r, groupID) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to view non-admin members of Group %d", reqUser, groupID)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
-		return
-	}
-
-	nonAdmins, err := db.GetAllNonAdminMembersForGroup(r.Context(), groupID)
+	nonAdmins, err := db.GetAllNonAdminMembersForGroup(r.Context(), groupID, utils.ViewerFor(r))
 	if err != nil {
 		log.Printf("ERROR: Failed to retrieve non-admin members for group %d: %v", groupID, err)
 		http.Error(w, "Failed to get non-admin members", http.StatusInternalServerError)
@@ -312,7 +306,7 @@ func GetAllNonAdminMembersInGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("INFO: Retrieved %d non-admin members for group %d", len(nonAdmins), groupID)
-	json.NewEncoder(w).Encode(nonAdmins)
+	json.NewEncoder(w).Encode(memberViews(r, groupID, nonAdmins))
 }
 
 func GetAllAdminMembersInGroup(w http.ResponseWriter, r *http.Request) {
@@ -324,14 +318,7 @@ func GetAllAdminMembersInGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !utils.IsGroupMemberOrSA(r, groupID) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to view admin members of Group %d", reqUser, groupID)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
-		return
-	}
-
-	admins, err := db.GetAllAdminMembersForGroup(r.Context(), groupID)
+	admins, err := db.GetAllAdminMembersForGroup(r.Context(), groupID, utils.ViewerFor(r))
 	if err != nil {
 		log.Printf("ERROR: Failed to retrieve admin members for group %d: %v", groupID, err)
 		http.Error(w, "Failed to get admin members", http.StatusInternalServerError)
@@ -339,7 +326,7 @@ func GetAllAdminMembersInGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("INFO: Retrieved %d admin members for group %d", len(admins), groupID)
-	json.NewEncoder(w).Encode(admins)
+	json.NewEncoder(w).Encode(memberViews(r, groupID, admins))
 }
 
 func GetAllGroups(w http.ResponseWriter, r *http.Request) {
@@ -350,8 +337,13 @@ func GetAllGroups(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	views := make([]models.AdminGroup, 0, len(groups))
+	for i := range groups {
+		views = append(views, models.NewAdminGroup(&groups[i]))
+	}
+
 	log.Printf("INFO: Retrieved all %d groups", len(groups))
-	json.NewEncoder(w).Encode(groups)
+	json.NewEncoder(w).Encode(views)
 }
 
 func GetAllGroupsForUser(w http.ResponseWriter, r *http.Request) {
@@ -363,13 +355,6 @@ func GetAllGroupsForUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !utils.IsSelfOrSA(r, userID) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to view groups for User %d", reqUser, userID)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
-		return
-	}
-
 	groups, err := db.GetAllGroupsForUser(r.Context(), userID)
 	if err != nil {
 		log.Printf("ERROR: Failed to retrieve groups for user %d: %v", userID, err)
@@ -377,8 +362,13 @@ func GetAllGroupsForUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	views := make([]interface{}, 0, len(groups))
+	for i := range groups {
+		views = append(views, models.GroupView(&groups[i], utils.GroupViewFor(r, int(groups[i].ID))))
+	}
+
 	log.Printf("INFO: Retrieved %d groups for user %d", len(groups), userID)
-	json.NewEncoder(w).Encode(groups)
+	json.NewEncoder(w).Encode(views)
 }
 
 func UpdateGroupName(w http.ResponseWriter, r *http.Request) {
@@ -390,23 +380,30 @@ func UpdateGroupName(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !utils.IsGroupAdminOrSA(r, groupID) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to update name of Group %d", reqUser, groupID)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
-		return
-	}
-
 	var payload struct {
 		GroupName string `json:"group_name"`
 	}
-	err = json.NewDecoder(r.Body).Decode(&payload)
-	if err != nil || payload.GroupName == "" {
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		log.Printf("ERROR: Invalid group name update request for group %d: %v", groupID, err)
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
 
+	var v utils.Validator
+	v.Text("group_name", payload.GroupName, true, utils.MaxGroupNameLength)
+	if !v.Valid() {
+		log.Printf("ERROR: Group name update for group %d failed validation: %v", groupID, v.Errors)
+		utils.WriteValidationErrors(w, v.Errors)
+		return
+	}
+
+	group, err := db.GetGroupByID(r.Context(), groupID)
+	if err != nil {
+		log.Printf("ERROR: Failed to find group with ID %d: %v", groupID, err)
+		http.Error(w, "Group not found", http.StatusNotFound)
+		return
+	}
+
 	err = db.UpdateGroupName(r.Context(), groupID, payload.GroupName)
 	if err != nil {
 		log.Printf("ERROR: Failed to update name for group %d: %v", groupID, err)
@@ -414,6 +411,15 @@ func UpdateGroupName(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditGroupUpdate,
+		TargetType: utils.AuditTargetGroup,
+		TargetID:   groupID,
+		GroupID:    groupID,
+		Before:     map[string]interface{}{"name": group.Name},
+		After:      map[string]interface{}{"name": payload.GroupName},
+	})
+
 	log.Printf("INFO: Group %d name updated to '%s'", groupID, payload.GroupName)
 	w.WriteHeader(http.StatusOK)
 }
@@ -427,13 +433,6 @@ func UpdateGroupDoSendEmails(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !utils.IsGroupAdminOrSA(r, groupID) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to update do_send_emails of Group %d", reqUser, groupID)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
-		return
-	}
-
 	var payload struct {
 		DoSendEmails bool `json:"do_send_emails"`
 	}
@@ -444,6 +443,13 @@ func UpdateGroupDoSendEmails(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	group, err := db.GetGroupByID(r.Context(), groupID)
+	if err != nil {
+		log.Printf("ERROR: Failed to find group with ID %d: %v", groupID, err)
+		http.Error(w, "Group not found", http.StatusNotFound)
+		return
+	}
+
 	err = db.UpdateGroupDoSendEmails(r.Context(), groupID, payload.DoSendEmails)
 	if err != nil {
 		log.Printf("ERROR: Failed to update do_send_emails for group %d: %v", groupID, err)
@@ -451,6 +457,15 @@ func UpdateGroupDoSendEmails(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditGroupUpdate,
+		TargetType: utils.AuditTargetGroup,
+		TargetID:   groupID,
+		GroupID:    groupID,
+		Before:     map[string]interface{}{"do_send_emails": group.DoSendEmails},
+		After:      map[string]interface{}{"do_send_emails": payload.DoSendEmails},
+	})
+
 	log.Printf("INFO: Group %d do_send_emails updated to '%t'", groupID, payload.DoSendEmails)
 	w.WriteHeader(http.StatusOK)
 }
@@ -478,6 +493,16 @@ func AddGroupAdmin(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to add group admin", http.StatusInternalServerError)
 		return
 	}
+	utils.InvalidatePrincipal(userID)
+
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditGroupAdminAdd,
+		TargetType: utils.AuditTargetUser,
+		TargetID:   userID,
+		GroupID:    groupID,
+		Before:     map[string]interface{}{"role_in_group": models.Member},
+		After:      map[string]interface{}{"role_in_group": models.GroupAdmin},
+	})
 
 	log.Printf("INFO: User %d added as admin to group %d", userID, groupID)
 	w.WriteHeader(http.StatusOK)
@@ -506,6 +531,16 @@ func RemoveGroupAdmin(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to remove group admin", http.StatusInternalServerError)
 		return
 	}
+	utils.InvalidatePrincipal(userID)
+
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditGroupAdminRemove,
+		TargetType: utils.AuditTargetUser,
+		TargetID:   userID,
+		GroupID:    groupID,
+		Before:     map[string]interface{}{"role_in_group": models.GroupAdmin},
+		After:      map[string]interface{}{"role_in_group": models.Member},
+	})
 
 	log.Printf("INFO: User %d removed as admin from group %d", userID, groupID)
 	w.WriteHeader(http.StatusOK)
@@ -527,6 +562,12 @@ func JoinGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	userID := r.Context().Value("user_id").(int)
+	if !utils.TokenAllowsGroup(r, int(group.ID)) {
+		log.Printf("ERROR: Access denied - User %d attempted to join group %d with a token outside its scope", userID, group.ID)
+		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
+		return
+	}
+
 	err = db.AddGroupMember(r.Context(), userID, int(group.ID), models.Member)
 	if err != nil {
 		log.Printf("ERROR: Failed to add user %d to group %d via code: %v", userID, group.ID, err)
@@ -534,6 +575,33 @@ func JoinGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditGroupJoin,
+		TargetType: utils.AuditTargetUser,
+		TargetID:   userID,
+		GroupID:    int(group.ID),
+	})
+
 	log.Printf("INFO: User %d joined group %d using code", userID, group.ID)
 	w.WriteHeader(http.StatusOK)
 }
+
+// memberViews projects a group's users for the caller. The users come from privacy-aware queries, so
+// any email or last name their owner hides from the caller is already blank.
+func memberViews(r *http.Request, groupID int, users []models.User) []interface{} {
+	callerID := r.Context().Value("user_id").(int)
+	groupView := utils.GroupViewFor(r, groupID)
+
+	views := make([]interface{}, 0, len(users))
+	for i := range users {
+		switch {
+		case int(users[i].ID) == callerID:
+			views = append(views, models.UserView(&users[i], models.ViewSelf))
+		case groupView == models.ViewAdmin:
+			views = append(views, models.UserView(&users[i], models.ViewAdmin))
+		default:
+			views = append(views, models.NewMemberUser(&users[i]))
+		}
+	}
+	return views
+}
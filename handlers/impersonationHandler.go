@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"nest/db"
+	"nest/helpers"
+	"nest/models"
+	"nest/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// StartImpersonation issues a short-lived token that lets an SA see the API as another user
+func StartImpersonation(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	targetID, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("ERROR: Invalid user ID format: %s: %v", idStr, err)
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var payload struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("ERROR: Failed to decode impersonation request: %v", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	reason := strings.TrimSpace(payload.Reason)
+	if reason == "" {
+		http.Error(w, "A reason is required", http.StatusBadRequest)
+		return
+	}
+
+	reqUser := r.Context().Value("user_id").(int)
+	if targetID == reqUser {
+		http.Error(w, "You cannot impersonate yourself", http.StatusBadRequest)
+		return
+	}
+
+	target, err := db.GetUserByID(r.Context(), targetID)
+	if err != nil {
+		log.Printf("ERROR: Failed to find user with ID %d: %v", targetID, err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// Acting as another SA would hand out their deployment-wide powers
+	if target.Role == models.SuperAdmin {
+		log.Printf("ERROR: Access denied - User %d attempted to impersonate super admin %d", reqUser, targetID)
+		http.Error(w, "Super admins cannot be impersonated", http.StatusForbidden)
+		return
+	}
+
+	sessionID, err := helpers.GenerateRandomString(32)
+	if err != nil {
+		log.Printf("ERROR: Failed to generate impersonation session ID: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// The session is only there so the token can be revoked, it never gets a usable refresh token
+	unusableSecret, err := helpers.GenerateRandomString(48)
+	if err != nil {
+		log.Printf("ERROR: Failed to generate impersonation session secret: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	session := models.Session{
+		ID:               sessionID,
+		UserID:           target.ID,
+		RefreshTokenHash: helpers.HashToken(unusableSecret),
+		UserAgent:        r.UserAgent(),
+		IP:               helpers.GetClientIP(r),
+		ExpiresAt:        time.Now().Add(utils.ImpersonationTTL),
+	}
+	if _, err := db.CreateSession(r.Context(), &session); err != nil {
+		log.Printf("ERROR: Failed to create impersonation session for user %d: %v", targetID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	token, err := utils.GenerateImpersonationToken(target, reqUser, sessionID)
+	if err != nil {
+		log.Printf("ERROR: Failed to sign impersonation token for user %d: %v", targetID, err)
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditImpersonationStart,
+		TargetType: utils.AuditTargetUser,
+		TargetID:   targetID,
+		Metadata:   map[string]string{"reason": reason, "session_id": sessionID},
+	})
+
+	log.Printf("INFO: User %d started impersonating user %d: %s", reqUser, targetID, reason)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Token     string `json:"token"`
+		ExpiresIn int    `json:"expires_in"`
+		UserID    int64  `json:"user_id"`
+		Username  string `json:"username"`
+	}{
+		Token:     token,
+		ExpiresIn: int(utils.ImpersonationTTL.Seconds()),
+		UserID:    target.ID,
+		Username:  target.Username,
+	})
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"nest/db"
+	"nest/models"
+	"nest/utils"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	invitationTTL          = 7 * 24 * time.Hour
+	invitationTokenPurpose = "invitation"
+)
+
+func CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	var invitationDTO models.InvitationDTO
+	if err := json.NewDecoder(r.Body).Decode(&invitationDTO); err != nil {
+		log.Printf("ERROR: Failed to decode invitation request: %v", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	reqUser := r.Context().Value("user_id").(int)
+	email := strings.ToLower(strings.TrimSpace(invitationDTO.Email))
+
+	var v utils.Validator
+	v.Email("email", email)
+	if !v.Valid() {
+		log.Printf("ERROR: Invitation rejected, invalid email %s", invitationDTO.Email)
+		utils.WriteValidationErrors(w, v.Errors)
+		return
+	}
+
+	// Only SAs can invite people without a group, group admins can invite into their own group
+	if (invitationDTO.GroupID == nil && !utils.IsSA(r)) || (invitationDTO.GroupID != nil && !utils.Authorize(r, utils.ActionGroupInvitationsManage, int(*invitationDTO.GroupID))) {
+		log.Printf("ERROR: Access denied - User %d attempted to create an invitation for %s", reqUser, email)
+		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
+		return
+	}
+
+	taken, err := db.IsEmailTaken(r.Context(), email)
+	if err != nil {
+		log.Printf("ERROR: Failed to check email %s for invitation: %v", email, err)
+		http.Error(w, "Failed to create invitation", http.StatusInternalServerError)
+		return
+	}
+	if taken {
+		log.Printf("ERROR: Invitation rejected, email %s is already registered", email)
+		http.Error(w, "A user with that email already exists", http.StatusConflict)
+		return
+	}
+
+	invitedBy := int64(reqUser)
+	invitation := models.Invitation{
+		Email:       email,
+		GroupID:     invitationDTO.GroupID,
+		InvitedByID: &invitedBy,
+		ExpiresAt:   time.Now().Add(invitationTTL),
+	}
+
+	createdInvitation, err := db.CreateInvitation(r.Context(), &invitation)
+	if err != nil {
+		log.Printf("ERROR: Failed to create invitation for %s: %v", email, err)
+		http.Error(w, "Failed to create invitation", http.StatusInternalServerError)
+		return
+	}
+
+	token, err := utils.GenerateSignedToken(invitationTokenPurpose, strconv.FormatInt(createdInvitation.ID, 10), invitationTTL)
+	if err != nil {
+		log.Printf("ERROR: Failed to sign invitation %d: %v", createdInvitation.ID, err)
+		http.Error(w, "Failed to create invitation", http.StatusInternalServerError)
+		return
+	}
+
+	groupText := ""
+	if createdInvitation.GroupID != nil {
+		group, err := db.GetGroupByID(r.Context(), int(*createdInvitation.GroupID))
+		if err != nil {
+			log.Printf("ERROR: Failed to get group %d for invitation email: %v", *createdInvitation.GroupID, err)
+		} else {
+			groupText = fmt.Sprintf(" and join the group %s", group.Name)
+		}
+	}
+
+	link := fmt.Sprintf("%s/register?invite=%s", utils.AppURL, url.QueryEscape(token))
+	emailBody := fmt.Sprintf(`You've been invited to create an account%s.
+
+Register here: %s
+
+This link expires on %s.`,
+		groupText,
+		link,
+		createdInvitation.ExpiresAt.Format("Monday, January 2, 2006"))
+	go utils.NotifyUser(email, "You're Invited", emailBody)
+
+	log.Printf("INFO: Invitation %d created for %s by user %d", createdInvitation.ID, email, reqUser)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(createdInvitation)
+}
+
+func GetAllInvitations(w http.ResponseWriter, r *http.Request) {
+	invitations, err := db.GetAllInvitations(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve invitations: %v", err)
+		http.Error(w, "Failed to get invitations", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("INFO: Retrieved all %d invitations", len(invitations))
+	json.NewEncoder(w).Encode(invitations)
+}
+
+func GetInvitationsForGroup(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	groupID, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("ERROR: Invalid group ID format: %s: %v", idStr, err)
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	invitations, err := db.GetInvitationsForGroup(r.Context(), groupID)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve invitations for group %d: %v", groupID, err)
+		http.Error(w, "Failed to get invitations", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("INFO: Retrieved %d invitations for group %d", len(invitations), groupID)
+	json.NewEncoder(w).Encode(invitations)
+}
+
+func RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	invitationID, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("ERROR: Invalid invitation ID format: %s: %v", idStr, err)
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	invitation, err := db.GetInvitationByID(r.Context(), invitationID)
+	if err != nil {
+		log.Printf("ERROR: Failed to find invitation %d: %v", invitationID, err)
+		http.Error(w, "Invitation not found", http.StatusNotFound)
+		return
+	}
+
+	reqUser := r.Context().Value("user_id").(int)
+	if (invitation.GroupID == nil && !utils.IsSA(r)) || (invitation.GroupID != nil && !utils.Authorize(r, utils.ActionGroupInvitationsManage, int(*invitation.GroupID))) {
+		log.Printf("ERROR: Access denied - User %d attempted to revoke invitation %d", reqUser, invitationID)
+		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
+		return
+	}
+
+	err = db.RevokeInvitation(r.Context(), invitationID)
+	if err != nil {
+		log.Printf("ERROR: Failed to revoke invitation %d: %v", invitationID, err)
+		http.Error(w, "Failed to revoke invitation", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("INFO: Invitation %d revoked by user %d", invitationID, reqUser)
+	w.WriteHeader(http.StatusOK)
+}
+
+// LookupInvitation lets the registration form show who an invitation link is for before the user signs up
+func LookupInvitation(w http.ResponseWriter, r *http.Request) {
+	invitation, err := invitationFromToken(r, r.URL.Query().Get("token"))
+	if err != nil {
+		log.Printf("ERROR: Invalid invitation lookup: %v", err)
+		http.Error(w, "Invalid or expired invitation", http.StatusNotFound)
+		return
+	}
+
+	response := struct {
+		Email     string    `json:"email"`
+		GroupName string    `json:"group_name,omitempty"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}{
+		Email:     invitation.Email,
+		ExpiresAt: invitation.ExpiresAt,
+	}
+
+	if invitation.GroupID != nil {
+		group, err := db.GetGroupByID(r.Context(), int(*invitation.GroupID))
+		if err == nil {
+			response.GroupName = group.Name
+		}
+	}
+
+	log.Printf("INFO: Invitation %d looked up", invitation.ID)
+	json.NewEncoder(w).Encode(response)
+}
+
+// invitationFromToken verifies a signed invitation token and returns the invitation if it can still be redeemed
+func invitationFromToken(r *http.Request, token string) (*models.Invitation, error) {
+	subject, err := utils.ParseSignedToken(invitationTokenPurpose, token)
+	if err != nil {
+		return nil, err
+	}
+
+	invitationID, err := strconv.Atoi(subject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid invitation ID: %w", err)
+	}
+
+	invitation, err := db.GetInvitationByID(r.Context(), invitationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !invitation.IsPending() {
+		return nil, fmt.Errorf("invitation %d is no longer pending", invitation.ID)
+	}
+
+	return invitation, nil
+}
@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"encoding/json"
+	"nest/utils"
+	"net/http"
+)
+
+// GetJWKS publishes the public keys other services can use to verify tokens issued by this API
+func GetJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(utils.PublicJWKS())
+}
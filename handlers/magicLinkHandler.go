@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"nest/db"
+	"nest/helpers"
+	"nest/utils"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	magicLinkTTL          = 15 * time.Minute
+	magicLinkTokenPurpose = "magic-link"
+)
+
+// RequestMagicLink emails a single-use login link, responding the same whether or not the email has an account
+func RequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("ERROR: Failed to decode magic link request: %v", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if !magicLinkLoginEnabled(w, r) {
+		return
+	}
+
+	ip := helpers.GetClientIP(r)
+	if wait := utils.IPLoginWait(ip); wait > 0 {
+		log.Printf("ERROR: Magic link request throttled for IP %s, retry in %v", ip, wait)
+		writeRetryAfter(w, wait)
+		http.Error(w, "Too many login attempts, please try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(payload.Email))
+	expiresAt := time.Now().Add(magicLinkTTL)
+
+	linkID, userID, err := db.CreateMagicLink(r.Context(), email, expiresAt)
+	if errors.Is(err, db.ErrNoUserForEmail) {
+		utils.RecordIPLoginFailure(ip)
+		log.Printf("INFO: Magic link requested for unknown email %s", email)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if errors.Is(err, db.ErrMagicLinkCooldown) {
+		log.Printf("INFO: Magic link for %s not sent, one was sent recently", email)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to create magic link for %s: %v", email, err)
+		http.Error(w, "Failed to send login link", http.StatusInternalServerError)
+		return
+	}
+
+	principal, err := utils.LoadPrincipal(r.Context(), userID)
+	if err != nil || principal.Disabled {
+		log.Printf("INFO: Magic link for %s not sent, the account can't sign in", email)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	token, err := utils.GenerateSignedToken(magicLinkTokenPurpose, strconv.Itoa(linkID), magicLinkTTL)
+	if err != nil {
+		log.Printf("ERROR: Failed to sign magic link %d: %v", linkID, err)
+		http.Error(w, "Failed to send login link", http.StatusInternalServerError)
+		return
+	}
+
+	link := fmt.Sprintf("%s/login/magic?token=%s", utils.AppURL, url.QueryEscape(token))
+	emailBody := fmt.Sprintf(`Use this link to sign in, it expires in %d minutes and can only be used once: %s
+
+If you did not request this, you can ignore this email.`, int(magicLinkTTL.Minutes()), link)
+	go utils.NotifyUser(email, "Your Sign In Link", emailBody)
+
+	log.Printf("INFO: Magic link %d sent to user %d", linkID, userID)
+	w.WriteHeader(http.StatusOK)
+}
+
+// VerifyMagicLink exchanges a magic link token for the same response Login gives
+func VerifyMagicLink(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Token      string `json:"token"`
+		UseCookies bool   `json:"use_cookies"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("ERROR: Failed to decode magic link login: %v", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if !magicLinkLoginEnabled(w, r) {
+		return
+	}
+
+	if payload.UseCookies && !utils.SessionCookiesEnabled() {
+		log.Printf("ERROR: Cookie magic link login requested but cookie sessions are disabled")
+		http.Error(w, "Cookie sessions are not enabled", http.StatusBadRequest)
+		return
+	}
+
+	subject, err := utils.ParseSignedToken(magicLinkTokenPurpose, payload.Token)
+	if err != nil {
+		log.Printf("ERROR: Invalid magic link token: %v", err)
+		http.Error(w, "Invalid or expired link", http.StatusUnauthorized)
+		return
+	}
+
+	linkID, err := strconv.Atoi(subject)
+	if err != nil {
+		log.Printf("ERROR: Invalid magic link ID %q: %v", subject, err)
+		http.Error(w, "Invalid or expired link", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := db.ConsumeMagicLink(r.Context(), linkID)
+	if err != nil {
+		log.Printf("ERROR: Failed to consume magic link %d: %v", linkID, err)
+		http.Error(w, "Invalid or expired link", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to find user %d for magic link login: %v", userID, err)
+		http.Error(w, "User not found", http.StatusUnauthorized)
+		return
+	}
+
+	if !checkNotLockedOut(w, r, user) {
+		return
+	}
+
+	principal, err := utils.LoadPrincipal(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load principal for user %s: %v", user.Username, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !checkCanSignIn(w, principal) {
+		return
+	}
+
+	log.Printf("INFO: Magic link %d accepted for user %s", linkID, user.Username)
+	completeLogin(w, r, user, principal, payload.UseCookies, false)
+}
+
+// magicLinkLoginEnabled writes an error and returns false when SAs have turned magic link login off
+func magicLinkLoginEnabled(w http.ResponseWriter, r *http.Request) bool {
+	settings, err := utils.LoadSettings(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to load settings: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+
+	if !settings.MagicLinkLogin {
+		log.Printf("ERROR: Magic link login attempted while disabled")
+		http.Error(w, "Magic link login is not enabled", http.StatusNotFound)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"nest/db"
+	"nest/helpers"
+	"nest/models"
+	"nest/utils"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const oidcLoginStateTTL = 10 * time.Minute
+
+var (
+	errNoLinkedAccount     = errors.New("no account is linked to this identity")
+	usernameDisallowedChar = regexp.MustCompile(`[^a-z0-9._]`)
+)
+
+// Account lookups behind identity linking, tests swap them out to resolve identities without a database
+var (
+	getUserIdentity             = db.GetUserIdentity
+	touchUserIdentity           = db.TouchUserIdentity
+	createUserIdentity          = db.CreateUserIdentity
+	getUserByID                 = db.GetUserByID
+	getUserByVerifiedEmail      = db.GetUserByVerifiedEmail
+	getPendingInvitationByEmail = db.GetPendingInvitationByEmail
+)
+
+func GetOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(utils.OIDCProviderSummaries())
+}
+
+// StartOIDCLogin begins an authorization code flow with PKCE and returns the provider URL to send the browser to
+func StartOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	providerID := chi.URLParam(r, "provider")
+	provider, ok := utils.GetOIDCProvider(providerID)
+	if !ok {
+		log.Printf("ERROR: OIDC login requested for unknown provider %s", providerID)
+		http.Error(w, "Unknown identity provider", http.StatusNotFound)
+		return
+	}
+
+	var values [3]string
+	for i := range values {
+		value, err := helpers.GenerateRandomString(32)
+		if err != nil {
+			log.Printf("ERROR: Failed to generate OIDC login state: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		values[i] = value
+	}
+	state, nonce, codeVerifier := values[0], values[1], values[2]
+
+	loginState := models.OIDCLoginState{
+		StateHash:    helpers.HashToken(state),
+		Provider:     providerID,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().Add(oidcLoginStateTTL),
+	}
+	if err := db.CreateOIDCLoginState(r.Context(), &loginState); err != nil {
+		log.Printf("ERROR: Failed to store OIDC login state for provider %s: %v", providerID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	authorizationURL, err := provider.AuthorizationURL(r.Context(), state, nonce, codeVerifier)
+	if err != nil {
+		log.Printf("ERROR: Failed to build authorization URL for provider %s: %v", providerID, err)
+		http.Error(w, "Identity provider is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	log.Printf("INFO: OIDC login started with provider %s", providerID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"authorization_url": authorizationURL,
+		"state":             state,
+	})
+}
+
+// CompleteOIDCLogin redeems the code the provider redirected back with and signs in the linked account
+func CompleteOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	providerID := chi.URLParam(r, "provider")
+	provider, ok := utils.GetOIDCProvider(providerID)
+	if !ok {
+		log.Printf("ERROR: OIDC callback for unknown provider %s", providerID)
+		http.Error(w, "Unknown identity provider", http.StatusNotFound)
+		return
+	}
+
+	var payload struct {
+		State      string `json:"state"`
+		Code       string `json:"code"`
+		UseCookies bool   `json:"use_cookies"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("ERROR: Failed to decode OIDC callback: %v", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if payload.UseCookies && !utils.SessionCookiesEnabled() {
+		log.Printf("ERROR: Cookie OIDC login requested but cookie sessions are disabled")
+		http.Error(w, "Cookie sessions are not enabled", http.StatusBadRequest)
+		return
+	}
+
+	loginState, err := db.ConsumeOIDCLoginState(r.Context(), helpers.HashToken(payload.State), providerID)
+	if err != nil {
+		log.Printf("ERROR: Invalid OIDC login state for provider %s: %v", providerID, err)
+		http.Error(w, "Invalid or expired login attempt", http.StatusUnauthorized)
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), payload.Code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		log.Printf("ERROR: OIDC code exchange with provider %s failed: %v", providerID, err)
+		http.Error(w, "Sign in with the identity provider failed", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := userForOIDCIdentity(r, providerID, identity)
+	if err != nil {
+		log.Printf("ERROR: Failed to resolve account for %s identity %s: %v", providerID, identity.Subject, err)
+		if errors.Is(err, errNoLinkedAccount) {
+			http.Error(w, "No account is linked to this identity", http.StatusForbidden)
+		} else {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if !checkNotLockedOut(w, r, user) {
+		return
+	}
+
+	principal, err := utils.LoadPrincipal(r.Context(), int(user.ID))
+	if err != nil {
+		log.Printf("ERROR: Failed to load principal for user %s: %v", user.Username, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !checkCanSignIn(w, principal) {
+		return
+	}
+
+	log.Printf("INFO: OIDC identity from %s accepted for user %s", providerID, user.Username)
+	completeLogin(w, r, user, principal, payload.UseCookies, false)
+}
+
+// userForOIDCIdentity finds the account linked to the identity, linking an account with the same verified email
+// or creating one for invited and allowlisted emails the first time the identity signs in
+func userForOIDCIdentity(r *http.Request, providerID string, identity *models.OIDCIdentity) (*models.User, error) {
+	email := strings.ToLower(strings.TrimSpace(identity.Email))
+
+	linked, err := getUserIdentity(r.Context(), providerID, identity.Subject)
+	if err == nil {
+		if err := touchUserIdentity(r.Context(), linked.ID, email); err != nil {
+			log.Printf("ERROR: Failed to record use of identity %d: %v", linked.ID, err)
+		}
+		return getUserByID(r.Context(), int(linked.UserID))
+	}
+
+	// Without a verified email there is nothing to tie the identity to
+	if !identity.EmailVerified || !utils.ValidateEmail(email) {
+		return nil, errNoLinkedAccount
+	}
+
+	user, err := getUserByVerifiedEmail(r.Context(), email)
+	if err != nil {
+		user, err = createUserForOIDCIdentity(r, identity, email)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = createUserIdentity(r.Context(), &models.UserIdentity{
+		UserID:   user.ID,
+		Provider: providerID,
+		Subject:  identity.Subject,
+		Email:    email,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("INFO: Linked %s identity %s to user %d", providerID, identity.Subject, user.ID)
+	return user, nil
+}
+
+// createUserForOIDCIdentity registers an account under the same rules as Register, which needs an invitation. The
+// provider has verified the email, which proves ownership the way following the invite link does, so a pending
+// invitation for it can be redeemed.
+func createUserForOIDCIdentity(r *http.Request, identity *models.OIDCIdentity, email string) (*models.User, error) {
+	invitation, err := getPendingInvitationByEmail(r.Context(), email)
+	if errors.Is(err, db.ErrInvitationNotFound) {
+		return nil, errNoLinkedAccount
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up invitation: %w", err)
+	}
+
+	if !utils.ValidateName(identity.GivenName) || !utils.ValidateName(identity.FamilyName) {
+		return nil, fmt.Errorf("%w: the provider did not share a usable name", errNoLinkedAccount)
+	}
+
+	username, err := usernameForOIDCIdentity(r, identity, email)
+	if err != nil {
+		return nil, err
+	}
+
+	// The account has no password until the user sets one through a password reset
+	unusablePassword, err := helpers.GenerateRandomString(48)
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := utils.HashPassword(unusablePassword)
+	if err != nil {
+		return nil, err
+	}
+
+	user := newUser(identity.GivenName, identity.FamilyName, email, username, hashedPassword)
+
+	createdUser, err := db.RedeemInvitation(r.Context(), int(invitation.ID), &user)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.MarkEmailVerified(r.Context(), int(createdUser.ID)); err != nil {
+		log.Printf("ERROR: Failed to mark email verified for user %d: %v", createdUser.ID, err)
+	}
+
+	log.Printf("INFO: Registered user %d from an OIDC identity - Email: %s, Username: %s", createdUser.ID, createdUser.Email, createdUser.Username)
+	return createdUser, nil
+}
+
+// usernameForOIDCIdentity picks a free username from the provider's suggestion or the email, adding a number if taken
+func usernameForOIDCIdentity(r *http.Request, identity *models.OIDCIdentity, email string) (string, error) {
+	base := identity.PreferredUsername
+	if base == "" || strings.Contains(base, "@") {
+		base, _, _ = strings.Cut(email, "@")
+	}
+
+	base = usernameDisallowedChar.ReplaceAllString(strings.ToLower(base), "")
+	base = strings.TrimLeft(base, "0123456789._")
+	if len(base) < 3 {
+		base = "user" + base
+	}
+	if len(base) > 26 {
+		base = base[:26]
+	}
+
+	for i := 1; i < 100; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = fmt.Sprintf("%s%d", base, i)
+		}
+		if utils.ValidateUsername(r, candidate) {
+			return candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("no free username for %s", base)
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"nest/db"
+	"nest/models"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testAccounts stands in for the users and user_identities tables
+type testAccounts struct {
+	users      []*models.User
+	identities []*models.UserIdentity
+}
+
+func useTestAccounts(t *testing.T, users ...*models.User) *testAccounts {
+	t.Helper()
+
+	accounts := &testAccounts{users: users}
+
+	previousGetIdentity, previousTouch, previousCreate := getUserIdentity, touchUserIdentity, createUserIdentity
+	previousGetUser, previousGetByEmail, previousInvitation := getUserByID, getUserByVerifiedEmail, getPendingInvitationByEmail
+	t.Cleanup(func() {
+		getUserIdentity, touchUserIdentity, createUserIdentity = previousGetIdentity, previousTouch, previousCreate
+		getUserByID, getUserByVerifiedEmail, getPendingInvitationByEmail = previousGetUser, previousGetByEmail, previousInvitation
+	})
+
+	getUserIdentity = func(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+		for _, identity := range accounts.identities {
+			if identity.Provider == provider && identity.Subject == subject {
+				return identity, nil
+			}
+		}
+		return nil, errors.New("identity not found")
+	}
+	touchUserIdentity = func(ctx context.Context, identityID int64, email string) error {
+		for _, identity := range accounts.identities {
+			if identity.ID == identityID {
+				identity.Email = email
+			}
+		}
+		return nil
+	}
+	createUserIdentity = func(ctx context.Context, identity *models.UserIdentity) (*models.UserIdentity, error) {
+		identity.ID = int64(len(accounts.identities) + 1)
+		accounts.identities = append(accounts.identities, identity)
+		return identity, nil
+	}
+	getUserByID = func(ctx context.Context, id int) (*models.User, error) {
+		for _, user := range accounts.users {
+			if int(user.ID) == id {
+				return user, nil
+			}
+		}
+		return nil, errors.New("user not found")
+	}
+	// Like the database, the lookup ignores case and only matches addresses the account has verified
+	getUserByVerifiedEmail = func(ctx context.Context, email string) (*models.User, error) {
+		for _, user := range accounts.users {
+			if strings.EqualFold(user.Email, email) && user.EmailVerifiedAt != nil {
+				return user, nil
+			}
+		}
+		return nil, errors.New("user not found")
+	}
+	getPendingInvitationByEmail = func(ctx context.Context, email string) (*models.Invitation, error) {
+		return nil, db.ErrInvitationNotFound
+	}
+
+	return accounts
+}
+
+func TestUserForOIDCIdentity(t *testing.T) {
+	verifiedAt := time.Now()
+	ada := &models.User{ID: 1, Username: "ada", Email: "Ada.Lovelace@example.com", EmailVerifiedAt: &verifiedAt}
+	grace := &models.User{ID: 2, Username: "grace", Email: "grace@example.com"}
+
+	tests := []struct {
+		name      string
+		linked    []*models.UserIdentity
+		identity  models.OIDCIdentity
+		wantUser  *models.User
+		wantLinks int
+	}{
+		{
+			name:      "linked identity signs in to its account",
+			linked:    []*models.UserIdentity{{ID: 1, UserID: 2, Provider: "stand-in", Subject: "subject-1"}},
+			identity:  models.OIDCIdentity{Subject: "subject-1", Email: "someone@else.example"},
+			wantUser:  grace,
+			wantLinks: 1,
+		},
+		{
+			name:      "verified email links the account with that address",
+			identity:  models.OIDCIdentity{Subject: "subject-1", Email: " ADA.lovelace@Example.com ", EmailVerified: true},
+			wantUser:  ada,
+			wantLinks: 1,
+		},
+		{
+			name:     "unverified email is not linked",
+			identity: models.OIDCIdentity{Subject: "subject-1", Email: "ada.lovelace@example.com"},
+		},
+		{
+			name:     "verified email the account itself hasn't verified is not linked",
+			identity: models.OIDCIdentity{Subject: "subject-1", Email: "grace@example.com", EmailVerified: true},
+		},
+		{
+			name:     "invalid email is not linked",
+			identity: models.OIDCIdentity{Subject: "subject-1", Email: "ada.lovelace", EmailVerified: true},
+		},
+		{
+			name:     "same subject at another provider is not reused",
+			linked:   []*models.UserIdentity{{ID: 1, UserID: 2, Provider: "another-provider", Subject: "subject-1"}},
+			identity: models.OIDCIdentity{Subject: "subject-1"},
+			// The existing link stays the only one
+			wantLinks: 1,
+		},
+		{
+			name:     "verified email without an account or invitation is refused",
+			identity: models.OIDCIdentity{Subject: "subject-1", Email: "stranger@example.com", EmailVerified: true, GivenName: "Alan", FamilyName: "Turing"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			accounts := useTestAccounts(t, ada, grace)
+			accounts.identities = append(accounts.identities, test.linked...)
+
+			user, err := userForOIDCIdentity(httptest.NewRequest("GET", "/", nil), "stand-in", &test.identity)
+
+			if test.wantUser == nil {
+				if !errors.Is(err, errNoLinkedAccount) {
+					t.Fatalf("got user %v, error %v, want errNoLinkedAccount", user, err)
+				}
+			} else if err != nil || user != test.wantUser {
+				t.Fatalf("got user %v, error %v, want %s", user, err, test.wantUser.Username)
+			}
+
+			if len(accounts.identities) != test.wantLinks {
+				t.Fatalf("%d identities linked, want %d", len(accounts.identities), test.wantLinks)
+			}
+		})
+	}
+}
+
+func TestUserForOIDCIdentityRecordsNormalizedEmail(t *testing.T) {
+	verifiedAt := time.Now()
+	ada := &models.User{ID: 1, Username: "ada", Email: "ada@example.com", EmailVerifiedAt: &verifiedAt}
+	accounts := useTestAccounts(t, ada)
+
+	identity := models.OIDCIdentity{Subject: "subject-1", Email: " Ada@Example.com", EmailVerified: true}
+	if _, err := userForOIDCIdentity(httptest.NewRequest("GET", "/", nil), "stand-in", &identity); err != nil {
+		t.Fatalf("linking failed: %v", err)
+	}
+
+	link := accounts.identities[0]
+	if link.UserID != ada.ID || link.Provider != "stand-in" || link.Subject != "subject-1" || link.Email != "ada@example.com" {
+		t.Fatalf("link = %+v", *link)
+	}
+
+	// Later sign ins follow the link rather than the email, and keep the recorded address current
+	identity.Email = "ada@new.example"
+	identity.EmailVerified = false
+	user, err := userForOIDCIdentity(httptest.NewRequest("GET", "/", nil), "stand-in", &identity)
+	if err != nil || user != ada {
+		t.Fatalf("got user %v, error %v, want ada", user, err)
+	}
+	if len(accounts.identities) != 1 || link.Email != "ada@new.example" {
+		t.Fatalf("identities = %d, recorded email %q", len(accounts.identities), link.Email)
+	}
+}
+
+func TestUserForOIDCIdentityFailsClosedOnInvitationLookupError(t *testing.T) {
+	accounts := useTestAccounts(t)
+	getPendingInvitationByEmail = func(ctx context.Context, email string) (*models.Invitation, error) {
+		return nil, errors.New("connection refused")
+	}
+
+	identity := models.OIDCIdentity{Subject: "subject-1", Email: "stranger@example.com", EmailVerified: true, GivenName: "Alan", FamilyName: "Turing"}
+	user, err := userForOIDCIdentity(httptest.NewRequest("GET", "/", nil), "stand-in", &identity)
+	if err == nil || errors.Is(err, errNoLinkedAccount) {
+		t.Fatalf("got user %v, error %v, want an internal error", user, err)
+	}
+	if len(accounts.identities) != 0 {
+		t.Fatalf("%d identities linked, want none", len(accounts.identities))
+	}
+}
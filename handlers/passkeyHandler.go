@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"nest/db"
+	"nest/helpers"
+	"nest/models"
+	"nest/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	passkeyChallengeTTL    = 5 * time.Minute
+	passkeyRegisterPurpose = "registration"
+	passkeyLoginPurpose    = "login"
+	maxPasskeyNameLength   = 100
+)
+
+// BeginPasskeyRegistration asks for the current password, and the second factor when two-factor is on, before
+// issuing a challenge. A passkey that verifies the user skips two-factor at sign in, so a stolen session alone
+// must not be able to add one.
+func BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+
+	var payload struct {
+		CurrentPassword string `json:"current_password"`
+		Code            string `json:"code"`
+		RecoveryCode    string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("ERROR: Failed to decode passkey registration request for user %d: %v", userID, err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	user, err := db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to find user %d: %v", userID, err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if !verifyCurrentPassword(w, r, user, payload.CurrentPassword) {
+		return
+	}
+
+	principal, err := utils.LoadPrincipal(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load principal for user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if principal.TwoFactorEnabled && !verifyCurrentSecondFactor(w, r, user, payload.Code, payload.RecoveryCode) {
+		return
+	}
+
+	existing, err := db.GetWebAuthnCredentialsForUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to get passkeys for user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	challenge, err := newPasskeyChallenge(r, userID, passkeyRegisterPurpose)
+	if err != nil {
+		log.Printf("ERROR: Failed to create passkey registration challenge for user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Stop the same authenticator from being registered twice
+	exclude := make([]models.WebAuthnCredentialDescriptor, 0, len(existing))
+	for _, credential := range existing {
+		exclude = append(exclude, models.WebAuthnCredentialDescriptor{Type: "public-key", ID: credential.CredentialID})
+	}
+
+	options := models.WebAuthnCreationOptions{
+		Challenge:    challenge,
+		RelyingParty: utils.WebAuthnRelyingParty(),
+		User: models.WebAuthnUserEntity{
+			ID:          passkeyUserHandle(userID),
+			Name:        user.Username,
+			DisplayName: strings.TrimSpace(user.FirstName + " " + user.LastName),
+		},
+		PublicKeyCredParams: utils.WebAuthnCredentialParameters(),
+		Timeout:             int(passkeyChallengeTTL.Milliseconds()),
+		ExcludeCredentials:  exclude,
+		AuthenticatorSelection: models.WebAuthnAuthenticatorSelection{
+			ResidentKey:      "required",
+			UserVerification: "preferred",
+		},
+		Attestation: "none",
+	}
+
+	log.Printf("INFO: Passkey registration started for user %d", userID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(options)
+}
+
+func FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+
+	var payload struct {
+		Name       string                             `json:"name"`
+		Credential models.WebAuthnAttestationResponse `json:"credential"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("ERROR: Failed to decode passkey registration for user %d: %v", userID, err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(payload.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+	var v utils.Validator
+	v.Text("name", name, false, maxPasskeyNameLength)
+	if !v.Valid() {
+		log.Printf("ERROR: Passkey name too long for user %d", userID)
+		utils.WriteValidationErrors(w, v.Errors)
+		return
+	}
+
+	challenge, err := utils.WebAuthnChallenge(payload.Credential.Response.ClientDataJSON, "webauthn.create")
+	if err != nil {
+		log.Printf("ERROR: Invalid passkey registration client data for user %d: %v", userID, err)
+		http.Error(w, "Invalid passkey", http.StatusBadRequest)
+		return
+	}
+
+	challengeUserID, err := db.ConsumeWebAuthnChallenge(r.Context(), helpers.HashToken(challenge), passkeyRegisterPurpose)
+	if err != nil || challengeUserID != userID {
+		log.Printf("ERROR: Invalid passkey registration challenge for user %d: %v", userID, err)
+		http.Error(w, "Invalid or expired passkey challenge", http.StatusBadRequest)
+		return
+	}
+
+	registration, err := utils.VerifyWebAuthnRegistration(payload.Credential.Response.AttestationObject)
+	if err != nil || !bytes.Equal(registration.CredentialID, payload.Credential.RawID) {
+		log.Printf("ERROR: Passkey registration failed verification for user %d: %v", userID, err)
+		http.Error(w, "Invalid passkey", http.StatusBadRequest)
+		return
+	}
+
+	credential, err := db.CreateWebAuthnCredential(r.Context(), &models.WebAuthnCredential{
+		UserID:       int64(userID),
+		CredentialID: registration.CredentialID,
+		PublicKey:    registration.PublicKey,
+		SignCount:    registration.SignCount,
+		Name:         name,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to store passkey for user %d: %v", userID, err)
+		http.Error(w, "Failed to register passkey", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditUserPasskeyAdd,
+		TargetType: utils.AuditTargetUser,
+		TargetID:   userID,
+		After:      map[string]interface{}{"passkey_id": credential.ID, "name": credential.Name},
+	})
+
+	emailBody := "A passkey named \"" + credential.Name + "\" was added to your account. If this wasn't you, please contact an Admin."
+	if user, err := db.GetUserByID(r.Context(), userID); err == nil {
+		go utils.NotifyUser(user.Email, "Passkey Added", emailBody)
+	}
+
+	log.Printf("INFO: Passkey %d registered for user %d", credential.ID, userID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(credential)
+}
+
+func GetPasskeys(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+
+	credentials, err := db.GetWebAuthnCredentialsForUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to get passkeys for user %d: %v", userID, err)
+		http.Error(w, "Failed to get passkeys", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("INFO: Retrieved %d passkeys for user %d", len(credentials), userID)
+	json.NewEncoder(w).Encode(credentials)
+}
+
+func DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+
+	idStr := chi.URLParam(r, "id")
+	credentialID, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("ERROR: Invalid passkey ID format: %s: %v", idStr, err)
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.DeleteWebAuthnCredential(r.Context(), userID, credentialID); err != nil {
+		log.Printf("ERROR: Failed to delete passkey %d for user %d: %v", credentialID, userID, err)
+		http.Error(w, "Passkey not found", http.StatusNotFound)
+		return
+	}
+
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditUserPasskeyRemove,
+		TargetType: utils.AuditTargetUser,
+		TargetID:   userID,
+		Before:     map[string]interface{}{"passkey_id": credentialID},
+	})
+
+	log.Printf("INFO: Passkey %d deleted by user %d", credentialID, userID)
+	w.WriteHeader(http.StatusOK)
+}
+
+// BeginPasskeyLogin issues a challenge for a discoverable credential, so no username is needed up front
+func BeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	challenge, err := newPasskeyChallenge(r, 0, passkeyLoginPurpose)
+	if err != nil {
+		log.Printf("ERROR: Failed to create passkey login challenge: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	options := models.WebAuthnRequestOptions{
+		Challenge:        challenge,
+		RelyingPartyID:   utils.WebAuthnRelyingParty().ID,
+		Timeout:          int(passkeyChallengeTTL.Milliseconds()),
+		AllowCredentials: []models.WebAuthnCredentialDescriptor{},
+		UserVerification: "preferred",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(options)
+}
+
+// FinishPasskeyLogin verifies a passkey assertion and gives the same response as Login
+func FinishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Credential models.WebAuthnAssertionResponse `json:"credential"`
+		UseCookies bool                             `json:"use_cookies"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("ERROR: Failed to decode passkey login: %v", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if payload.UseCookies && !utils.SessionCookiesEnabled() {
+		log.Printf("ERROR: Cookie passkey login requested but cookie sessions are disabled")
+		http.Error(w, "Cookie sessions are not enabled", http.StatusBadRequest)
+		return
+	}
+
+	response := payload.Credential.Response
+	challenge, err := utils.WebAuthnChallenge(response.ClientDataJSON, "webauthn.get")
+	if err != nil {
+		log.Printf("ERROR: Invalid passkey login client data: %v", err)
+		http.Error(w, "Invalid passkey", http.StatusUnauthorized)
+		return
+	}
+
+	if _, err := db.ConsumeWebAuthnChallenge(r.Context(), helpers.HashToken(challenge), passkeyLoginPurpose); err != nil {
+		log.Printf("ERROR: Invalid passkey login challenge: %v", err)
+		http.Error(w, "Invalid or expired passkey challenge", http.StatusUnauthorized)
+		return
+	}
+
+	credential, err := db.GetWebAuthnCredentialByCredentialID(r.Context(), payload.Credential.RawID)
+	if err != nil {
+		log.Printf("ERROR: Passkey login with unknown credential from IP %s: %v", helpers.GetClientIP(r), err)
+		http.Error(w, "Invalid passkey", http.StatusUnauthorized)
+		return
+	}
+
+	if len(response.UserHandle) > 0 && !bytes.Equal(response.UserHandle, passkeyUserHandle(int(credential.UserID))) {
+		log.Printf("ERROR: Passkey %d presented with a different user handle", credential.ID)
+		http.Error(w, "Invalid passkey", http.StatusUnauthorized)
+		return
+	}
+
+	signCount, userVerified, err := utils.VerifyWebAuthnAssertion(credential, response.ClientDataJSON, response.AuthenticatorData, response.Signature)
+	if err != nil {
+		if errors.Is(err, utils.ErrWebAuthnSignCount) {
+			log.Printf("ERROR: Passkey %d for user %d reused a signature counter, it may have been cloned", credential.ID, credential.UserID)
+		} else {
+			log.Printf("ERROR: Passkey %d for user %d failed verification: %v", credential.ID, credential.UserID, err)
+		}
+		http.Error(w, "Invalid passkey", http.StatusUnauthorized)
+		return
+	}
+
+	if err := db.UpdateWebAuthnSignCount(r.Context(), credential.ID, credential.SignCount, signCount); err != nil {
+		log.Printf("ERROR: Failed to update counter for passkey %d: %v", credential.ID, err)
+		http.Error(w, "Invalid passkey", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := db.GetUserByID(r.Context(), int(credential.UserID))
+	if err != nil {
+		log.Printf("ERROR: Failed to find user %d for passkey login: %v", credential.UserID, err)
+		http.Error(w, "User not found", http.StatusUnauthorized)
+		return
+	}
+
+	if !checkNotLockedOut(w, r, user) {
+		return
+	}
+
+	principal, err := utils.LoadPrincipal(r.Context(), int(user.ID))
+	if err != nil {
+		log.Printf("ERROR: Failed to load principal for user %s: %v", user.Username, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !checkCanSignIn(w, principal) {
+		return
+	}
+
+	log.Printf("INFO: Passkey %d accepted for user %s", credential.ID, user.Username)
+	completeLogin(w, r, user, principal, payload.UseCookies, userVerified)
+}
+
+// newPasskeyChallenge stores a random challenge for the ceremony, only its hash is kept
+func newPasskeyChallenge(r *http.Request, userID int, purpose string) (models.Base64URL, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(challenge)
+	if err := db.CreateWebAuthnChallenge(r.Context(), helpers.HashToken(encoded), userID, purpose, time.Now().Add(passkeyChallengeTTL)); err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// passkeyUserHandle is the opaque user ID stored on the authenticator
+func passkeyUserHandle(userID int) models.Base64URL {
+	return models.Base64URL(strconv.Itoa(userID))
+}
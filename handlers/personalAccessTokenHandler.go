@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"nest/db"
+	"nest/helpers"
+	"nest/models"
+	"nest/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const maxPersonalAccessTokenNameLength = 100
+
+func CreatePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	var tokenDTO models.PersonalAccessTokenDTO
+	if err := json.NewDecoder(r.Body).Decode(&tokenDTO); err != nil {
+		log.Printf("ERROR: Failed to decode personal access token request: %v", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(int)
+	name := strings.TrimSpace(tokenDTO.Name)
+
+	var v utils.Validator
+	v.Text("name", name, true, maxPersonalAccessTokenNameLength)
+	if tokenDTO.ExpiresInDays < 0 {
+		v.Add("expires_in_days", utils.ValidationInvalid, "Must not be negative")
+	}
+	if !v.Valid() {
+		log.Printf("ERROR: Personal access token rejected for user %d: %v", userID, v.Errors)
+		utils.WriteValidationErrors(w, v.Errors)
+		return
+	}
+
+	// A token can only be scoped to groups its owner can already access
+	for _, groupID := range tokenDTO.GroupIDs {
+		if !utils.Authorize(r, utils.ActionGroupRead, int(groupID)) {
+			log.Printf("ERROR: Access denied - User %d attempted to scope a token to Group %d", userID, groupID)
+			http.Error(w, "You do not have access to this resource", http.StatusForbidden)
+			return
+		}
+	}
+
+	plaintext, err := utils.GeneratePersonalAccessToken()
+	if err != nil {
+		log.Printf("ERROR: Failed to generate personal access token for user %d: %v", userID, err)
+		http.Error(w, "Failed to create token", http.StatusInternalServerError)
+		return
+	}
+
+	token := models.PersonalAccessToken{
+		UserID:    int64(userID),
+		Name:      name,
+		TokenHash: helpers.HashToken(plaintext),
+		ReadOnly:  tokenDTO.ReadOnly,
+		GroupIDs:  tokenDTO.GroupIDs,
+	}
+	if tokenDTO.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, tokenDTO.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	createdToken, err := db.CreatePersonalAccessToken(r.Context(), &token)
+	if err != nil {
+		log.Printf("ERROR: Failed to create personal access token for user %d: %v", userID, err)
+		http.Error(w, "Failed to create token", http.StatusInternalServerError)
+		return
+	}
+
+	// The plaintext is only ever shown here
+	response := struct {
+		*models.PersonalAccessToken
+		Token string `json:"token"`
+	}{
+		PersonalAccessToken: createdToken,
+		Token:               plaintext,
+	}
+
+	log.Printf("INFO: Personal access token %d created for user %d", createdToken.ID, userID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func GetPersonalAccessTokens(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+
+	tokens, err := db.GetPersonalAccessTokensForUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve personal access tokens for user %d: %v", userID, err)
+		http.Error(w, "Failed to get tokens", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("INFO: Retrieved %d personal access tokens for user %d", len(tokens), userID)
+	json.NewEncoder(w).Encode(tokens)
+}
+
+func RevokePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	tokenID, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("ERROR: Invalid token ID format: %s: %v", idStr, err)
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(int)
+
+	if err := db.RevokePersonalAccessToken(r.Context(), userID, tokenID); err != nil {
+		log.Printf("ERROR: Failed to revoke personal access token %d for user %d: %v", tokenID, userID, err)
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("INFO: Personal access token %d revoked by user %d", tokenID, userID)
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"nest/db"
+	"nest/helpers"
+	"nest/models"
+	"nest/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 500
+)
+
+// UpdateUserProfile sets the display name, bio and timezone, fields left out keep their value
+func UpdateUserProfile(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	userID, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("ERROR: Invalid user ID format: %s: %v", idStr, err)
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var payload struct {
+		DisplayName *string `json:"display_name"`
+		Bio         *string `json:"bio"`
+		Timezone    *string `json:"timezone"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("ERROR: Failed to decode profile update for user %d: %v", userID, err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	user, err := db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to find user with ID %d: %v", userID, err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	displayName, bio, timezone := user.DisplayName, user.Bio, user.Timezone
+	if payload.DisplayName != nil {
+		displayName = strings.TrimSpace(*payload.DisplayName)
+	}
+	if payload.Bio != nil {
+		bio = strings.TrimSpace(*payload.Bio)
+	}
+	if payload.Timezone != nil {
+		timezone = strings.TrimSpace(*payload.Timezone)
+	}
+
+	var v utils.Validator
+	v.Text("display_name", displayName, false, maxDisplayNameLength)
+	v.Text("bio", bio, false, maxBioLength)
+	// An empty timezone means the client's own is used
+	if timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil || timezone == "Local" {
+			v.Add("timezone", utils.ValidationInvalid, "Must be an IANA name such as America/New_York")
+		}
+	}
+	if !v.Valid() {
+		log.Printf("ERROR: Profile update for user %d failed validation: %v", userID, v.Errors)
+		utils.WriteValidationErrors(w, v.Errors)
+		return
+	}
+
+	if err := db.UpdateUserProfile(r.Context(), userID, displayName, bio, timezone); err != nil {
+		log.Printf("ERROR: Failed to update profile for user %d: %v", userID, err)
+		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		return
+	}
+
+	user.DisplayName, user.Bio, user.Timezone = displayName, bio, timezone
+
+	log.Printf("INFO: Profile updated for user %d", userID)
+	json.NewEncoder(w).Encode(models.UserView(user, utils.UserViewFor(r, userID)))
+}
+
+// GetUserAvatar serves the processed avatar. Its URL changes whenever the avatar does, so clients may keep it for a day.
+func GetUserAvatar(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	userID, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("ERROR: Invalid user ID format: %s: %v", idStr, err)
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	user, err := db.GetUserByID(r.Context(), userID)
+	if err != nil || user.AvatarKey == nil {
+		http.Error(w, "Avatar not found", http.StatusNotFound)
+		return
+	}
+
+	etag := `"` + *user.AvatarKey + `"`
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	data, err := utils.Storage.Get(r.Context(), *user.AvatarKey)
+	if err != nil {
+		log.Printf("ERROR: Failed to read avatar for user %d: %v", userID, err)
+		w.Header().Del("Cache-Control")
+		w.Header().Del("ETag")
+		if errors.Is(err, utils.ErrObjectNotFound) {
+			http.Error(w, "Avatar not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to read avatar", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(data)
+}
+
+// UploadUserAvatar takes a multipart upload in the "avatar" field and stores it resized and re-encoded
+func UploadUserAvatar(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	userID, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("ERROR: Invalid user ID format: %s: %v", idStr, err)
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	// Leave room for the multipart framing around the file
+	r.Body = http.MaxBytesReader(w, r.Body, utils.MaxAvatarUploadSize+1<<20)
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		log.Printf("ERROR: Failed to read avatar upload for user %d: %v", userID, err)
+		http.Error(w, "Upload an image in the avatar field", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	if r.MultipartForm != nil {
+		defer r.MultipartForm.RemoveAll()
+	}
+
+	avatar, err := utils.ProcessAvatar(file)
+	if err != nil {
+		log.Printf("ERROR: Rejected avatar upload for user %d: %v", userID, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	suffix, err := helpers.GenerateRandomString(12)
+	if err != nil {
+		log.Printf("ERROR: Failed to name avatar for user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	key := fmt.Sprintf("avatars/%d-%s.jpg", userID, suffix)
+
+	if err := utils.Storage.Put(r.Context(), key, avatar); err != nil {
+		log.Printf("ERROR: Failed to store avatar for user %d: %v", userID, err)
+		http.Error(w, "Failed to store avatar", http.StatusInternalServerError)
+		return
+	}
+
+	previousKey, err := db.SetUserAvatar(r.Context(), userID, &key)
+	if err != nil {
+		log.Printf("ERROR: Failed to save avatar for user %d: %v", userID, err)
+		utils.Storage.Delete(r.Context(), key)
+		http.Error(w, "Failed to save avatar", http.StatusInternalServerError)
+		return
+	}
+	deleteStoredAvatar(r, userID, previousKey)
+
+	user, err := db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to reload user %d after avatar upload: %v", userID, err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("INFO: Avatar updated for user %d", userID)
+	json.NewEncoder(w).Encode(map[string]string{"avatar_url": user.AvatarURL()})
+}
+
+func DeleteUserAvatar(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	userID, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("ERROR: Invalid user ID format: %s: %v", idStr, err)
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	previousKey, err := db.SetUserAvatar(r.Context(), userID, nil)
+	if err != nil {
+		log.Printf("ERROR: Failed to remove avatar for user %d: %v", userID, err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	deleteStoredAvatar(r, userID, previousKey)
+
+	log.Printf("INFO: Avatar removed for user %d", userID)
+	w.WriteHeader(http.StatusOK)
+}
+
+// deleteStoredAvatar removes an avatar that is no longer referenced, a failure only leaves an orphaned file
+func deleteStoredAvatar(r *http.Request, userID int, key *string) {
+	if key == nil {
+		return
+	}
+	if err := utils.Storage.Delete(r.Context(), *key); err != nil {
+		log.Printf("ERROR: Failed to delete old avatar for user %d: %v", userID, err)
+	}
+}
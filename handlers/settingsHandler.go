@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"nest/db"
+	"nest/utils"
+	"net/http"
+)
+
+func GetSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := db.GetSettings(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to retrieve settings: %v", err)
+		http.Error(w, "Failed to get settings", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("INFO: Settings retrieved by user %d", r.Context().Value("user_id").(int))
+	json.NewEncoder(w).Encode(settings)
+}
+
+func UpdateRequireTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		RequireTwoFactor bool `json:"require_two_factor"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		log.Printf("ERROR: Invalid require_two_factor update request: %v", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	err = db.UpdateRequireTwoFactor(r.Context(), payload.RequireTwoFactor)
+	if err != nil {
+		log.Printf("ERROR: Failed to update require_two_factor: %v", err)
+		http.Error(w, "Failed to update settings", http.StatusInternalServerError)
+		return
+	}
+	utils.InvalidateSettings()
+
+	log.Printf("INFO: require_two_factor updated to '%t' by user %d", payload.RequireTwoFactor, r.Context().Value("user_id").(int))
+	w.WriteHeader(http.StatusOK)
+}
+
+func UpdateMagicLinkLogin(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		MagicLinkLogin bool `json:"magic_link_login"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		log.Printf("ERROR: Invalid magic_link_login update request: %v", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	err = db.UpdateMagicLinkLogin(r.Context(), payload.MagicLinkLogin)
+	if err != nil {
+		log.Printf("ERROR: Failed to update magic_link_login: %v", err)
+		http.Error(w, "Failed to update settings", http.StatusInternalServerError)
+		return
+	}
+	utils.InvalidateSettings()
+
+	log.Printf("INFO: magic_link_login updated to '%t' by user %d", payload.MagicLinkLogin, r.Context().Value("user_id").(int))
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"nest/db"
+	"nest/helpers"
+	"nest/models"
+	"nest/utils"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	twoFactorChallengeTTL         = 5 * time.Minute
+	maxTwoFactorChallengeAttempts = 5
+	recoveryCodeCount             = 10
+)
+
+type twoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	Challenge         string `json:"challenge"`
+	ExpiresIn         int    `json:"expires_in"`
+}
+
+func GetTwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+
+	principal, err := utils.LoadPrincipal(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load principal for user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	settings, err := utils.LoadSettings(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to load settings: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	remaining, err := db.CountRemainingRecoveryCodes(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to count recovery codes for user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("INFO: Two-factor status retrieved for user %d", userID)
+	json.NewEncoder(w).Encode(models.TwoFactorStatus{
+		Enabled:                principal.TwoFactorEnabled,
+		Required:               principal.RequiresTwoFactor(settings),
+		RecoveryCodesRemaining: remaining,
+	})
+}
+
+func BeginTwoFactorEnrollment(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+	username := r.Context().Value("username").(string)
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		log.Printf("ERROR: Failed to generate TOTP secret for user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = db.SetPendingTOTPSecret(r.Context(), userID, secret)
+	if err != nil {
+		log.Printf("ERROR: Failed to start two-factor enrollment for user %d: %v", userID, err)
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	log.Printf("INFO: Two-factor enrollment started for user %d", userID)
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":      secret,
+		"otpauth_url": utils.TOTPProvisioningURI(secret, username),
+	})
+}
+
+func ConfirmTwoFactorEnrollment(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+
+	var payload struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("ERROR: Failed to decode two-factor confirmation for user %d: %v", userID, err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	totp, err := db.GetUserTOTP(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to find pending TOTP secret for user %d: %v", userID, err)
+		http.Error(w, "Two-factor enrollment has not been started", http.StatusBadRequest)
+		return
+	}
+
+	if totp.ConfirmedAt != nil {
+		log.Printf("ERROR: User %d attempted to confirm two-factor authentication twice", userID)
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	step, ok := utils.MatchTOTP(totp.Secret, payload.Code, time.Now())
+	if !ok {
+		log.Printf("ERROR: Invalid code during two-factor confirmation for user %d", userID)
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := db.MarkTOTPStepUsed(r.Context(), userID, step); err != nil {
+		log.Printf("ERROR: Failed to record TOTP use for user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	recoveryCodes, err := issueRecoveryCodes(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to issue recovery codes for user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := db.ConfirmTOTP(r.Context(), userID); err != nil {
+		log.Printf("ERROR: Failed to confirm TOTP for user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	utils.InvalidatePrincipal(userID)
+
+	log.Printf("INFO: Two-factor authentication enabled for user %d", userID)
+	json.NewEncoder(w).Encode(map[string][]string{
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+func DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+
+	var payload struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("ERROR: Failed to decode two-factor disable request for user %d: %v", userID, err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	principal, err := utils.LoadPrincipal(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load principal for user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	settings, err := utils.LoadSettings(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to load settings: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if principal.RequiresTwoFactor(settings) {
+		log.Printf("ERROR: User %d attempted to disable required two-factor authentication", userID)
+		http.Error(w, "Two-factor authentication is required for your account", http.StatusForbidden)
+		return
+	}
+
+	ok, err := verifySecondFactor(r.Context(), userID, payload.Code, payload.RecoveryCode)
+	if err != nil {
+		log.Printf("ERROR: Failed to verify second factor for user %d: %v", userID, err)
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+	if !ok {
+		log.Printf("ERROR: Invalid code while disabling two-factor authentication for user %d", userID)
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.DeleteUserTOTP(r.Context(), userID); err != nil {
+		log.Printf("ERROR: Failed to disable two-factor authentication for user %d: %v", userID, err)
+		http.Error(w, "Failed to disable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	utils.InvalidatePrincipal(userID)
+
+	log.Printf("INFO: Two-factor authentication disabled for user %d", userID)
+	w.WriteHeader(http.StatusOK)
+}
+
+func RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(int)
+
+	var payload struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("ERROR: Failed to decode recovery code request for user %d: %v", userID, err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	ok, err := verifySecondFactor(r.Context(), userID, payload.Code, "")
+	if err != nil || !ok {
+		log.Printf("ERROR: Invalid code while regenerating recovery codes for user %d: %v", userID, err)
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	recoveryCodes, err := issueRecoveryCodes(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to issue recovery codes for user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("INFO: Recovery codes regenerated for user %d", userID)
+	json.NewEncoder(w).Encode(map[string][]string{
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+func VerifyTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Challenge    string `json:"challenge"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+		UseCookies   bool   `json:"use_cookies"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("ERROR: Failed to decode two-factor login request: %v", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if payload.UseCookies && !utils.SessionCookiesEnabled() {
+		log.Printf("ERROR: Cookie two-factor login requested but cookie sessions are disabled")
+		http.Error(w, "Cookie sessions are not enabled", http.StatusBadRequest)
+		return
+	}
+
+	if !checkIPThrottle(w, r) {
+		return
+	}
+
+	challengeHash := helpers.HashToken(payload.Challenge)
+	userID, err := db.SpendTwoFactorChallengeAttempt(r.Context(), challengeHash, maxTwoFactorChallengeAttempts)
+	if err != nil {
+		utils.RecordIPLoginFailure(helpers.GetClientIP(r))
+		log.Printf("ERROR: Unusable two-factor challenge: %v", err)
+		http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to find user %d for two-factor login: %v", userID, err)
+		http.Error(w, "User not found", http.StatusUnauthorized)
+		return
+	}
+
+	// The password doesn't reset the account's failures, so wrong codes across fresh challenges still add up
+	if !checkAccountThrottle(w, r, user) {
+		return
+	}
+
+	ok, err := verifySecondFactor(r.Context(), userID, payload.Code, payload.RecoveryCode)
+	if err != nil || !ok {
+		log.Printf("ERROR: Invalid second factor for user %d from IP %s: %v", userID, helpers.GetClientIP(r), err)
+		recordFailedLogin(r, user)
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	consumed, err := db.ConsumeTwoFactorChallenge(r.Context(), challengeHash)
+	if err != nil || !consumed {
+		log.Printf("ERROR: Failed to consume two-factor challenge for user %d: %v", userID, err)
+		http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		return
+	}
+
+	// The account may have been disabled since the password was accepted
+	principal, err := utils.LoadPrincipal(r.Context(), int(user.ID))
+	if err != nil {
+		log.Printf("ERROR: Failed to load principal for user %s: %v", user.Username, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !checkCanSignIn(w, principal) {
+		return
+	}
+
+	clearFailedLogins(r.Context(), user)
+
+	tokens, err := startSession(r, user)
+	if err != nil {
+		log.Printf("ERROR: Failed to start session for user %s: %v", user.Username, err)
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	if err := writeSessionTokens(w, tokens, payload.UseCookies); err != nil {
+		log.Printf("ERROR: Failed to send tokens to user %s: %v", user.Username, err)
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("INFO: Successful two-factor login - User: %s, ID: %d", user.Username, user.ID)
+}
+
+// beginTwoFactorChallenge records a pending login that must be completed with a second factor
+func beginTwoFactorChallenge(ctx context.Context, userID int) (*twoFactorChallengeResponse, error) {
+	token, err := helpers.GenerateRandomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.CreateTwoFactorChallenge(ctx, userID, helpers.HashToken(token), time.Now().Add(twoFactorChallengeTTL)); err != nil {
+		return nil, err
+	}
+
+	return &twoFactorChallengeResponse{
+		TwoFactorRequired: true,
+		Challenge:         token,
+		ExpiresIn:         int(twoFactorChallengeTTL.Seconds()),
+	}, nil
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery code
+func verifySecondFactor(ctx context.Context, userID int, code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		return db.ConsumeRecoveryCode(ctx, userID, helpers.HashToken(normalizeRecoveryCode(recoveryCode)))
+	}
+
+	totp, err := db.GetUserTOTP(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if totp.ConfirmedAt == nil {
+		return false, nil
+	}
+
+	step, ok := utils.MatchTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	// A code can only be used once, even within its validity window
+	return db.MarkTOTPStepUsed(ctx, userID, step)
+}
+
+// issueRecoveryCodes replaces the user's recovery codes and returns the new plaintext codes
+func issueRecoveryCodes(ctx context.Context, userID int) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := helpers.GenerateRandomString(10)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, helpers.HashToken(code))
+	}
+
+	if err := db.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
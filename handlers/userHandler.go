@@ -1,13 +1,19 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"nest/db"
+	"nest/helpers"
 	"nest/models"
 	"nest/utils"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -21,13 +27,6 @@ func GetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !utils.IsSelfOrSA(r, id) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to access User %d's data", reqUser, id)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
-		return
-	}
-
 	user, err := db.GetUserByID(r.Context(), id)
 	if err != nil {
 		log.Printf("ERROR: Failed to find user with ID %d: %v", id, err)
@@ -36,7 +35,7 @@ func GetUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("INFO: User %d's data successfully retrieved", id)
-	json.NewEncoder(w).Encode(user)
+	json.NewEncoder(w).Encode(models.UserView(user, utils.UserViewFor(r, id)))
 }
 
 func GetUserInfo(w http.ResponseWriter, r *http.Request) {
@@ -48,21 +47,15 @@ func GetUserInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := db.GetUserByID(r.Context(), id)
+	user, err := db.GetVisibleUser(r.Context(), id, utils.ViewerFor(r))
 	if err != nil {
 		log.Printf("ERROR: Failed to find user with ID %d: %v", id, err)
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
 
-	userInfo := models.UserInfo{
-		FirstName: user.FirstName,
-		LastName:  user.LastName,
-		Username:  user.Username,
-	}
-
 	log.Printf("INFO: Basic info retrieved for user %d (%s)", id, user.Username)
-	json.NewEncoder(w).Encode(userInfo)
+	json.NewEncoder(w).Encode(models.NewPublicUser(user))
 }
 
 func DeleteUser(w http.ResponseWriter, r *http.Request) {
@@ -74,37 +67,241 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !utils.IsSelfOrSA(r, userID) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to delete User %d", reqUser, userID)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
+	before, err := db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to find user with ID %d: %v", userID, err)
+		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
 
-	err = db.DeleteUser(r.Context(), userID)
+	purgeAt := time.Now().Add(utils.AccountDeletionGracePeriod)
+	err = db.ScheduleUserDeletion(r.Context(), userID, purgeAt)
+	if errors.Is(err, db.ErrDeletionAlreadyScheduled) || errors.Is(err, db.ErrLastSuperAdmin) {
+		log.Printf("ERROR: Refused to schedule deletion of user %d: %v", userID, err)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
-		log.Printf("ERROR: Failed to delete user %d: %v", userID, err)
+		log.Printf("ERROR: Failed to schedule deletion of user %d: %v", userID, err)
 		http.Error(w, "User not found or could not be deleted", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("INFO: User %d successfully deleted", userID)
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditUserDelete,
+		TargetType: utils.AuditTargetUser,
+		TargetID:   userID,
+		Before:     userAuditSnapshot(before),
+		Metadata:   map[string]interface{}{"purge_at": purgeAt},
+	})
+
+	emailBody := fmt.Sprintf("Your account is scheduled to be deleted on %s. Until then you can sign in and cancel the deletion at %s. After that date your personal data will be removed for good.",
+		purgeAt.Format("January 2, 2006"), utils.AppURL)
+	go utils.NotifyUser(before.Email, "Your Account Will Be Deleted", emailBody)
+
+	log.Printf("INFO: User %d scheduled for deletion at %s", userID, purgeAt.Format(time.RFC3339))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]time.Time{"deletion_scheduled_at": purgeAt})
+}
+
+// CancelUserDeletion keeps an account that is still within its deletion grace period
+func CancelUserDeletion(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	userID, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("ERROR: Invalid user ID format: %s: %v", idStr, err)
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	err = db.CancelUserDeletion(r.Context(), userID)
+	if errors.Is(err, db.ErrNoDeletionScheduled) {
+		log.Printf("ERROR: No deletion to cancel for user %d", userID)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to cancel deletion of user %d: %v", userID, err)
+		http.Error(w, "Failed to cancel deletion", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditUserDeleteCancel,
+		TargetType: utils.AuditTargetUser,
+		TargetID:   userID,
+	})
+
+	log.Printf("INFO: Deletion of user %d cancelled", userID)
 	w.WriteHeader(http.StatusOK)
 }
 
-func UpdateUserEmail(w http.ResponseWriter, r *http.Request) {
+// ExportUserData returns a JSON archive of the user's profile and everything they have added
+func ExportUserData(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
-	id, err := strconv.Atoi(idStr)
+	userID, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("ERROR: Invalid user ID format: %s: %v", idStr, err)
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	user, err := db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to find user with ID %d: %v", userID, err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	export, err := loadAccountExport(r.Context(), user)
+	if err != nil {
+		log.Printf("ERROR: Failed to export data for user %d: %v", userID, err)
+		http.Error(w, "Failed to export data", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("INFO: Exported data for user %d", userID)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-export.json"`, user.Username))
+	json.NewEncoder(w).Encode(export)
+}
+
+func GetPrivacySettings(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	userID, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("ERROR: Invalid user ID format: %s: %v", idStr, err)
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	settings, err := db.GetPrivacySettings(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to get privacy settings for user %d: %v", userID, err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(settings)
+}
+
+// UpdatePrivacySettings changes who can see the user's email and last name, fields left out keep their setting
+func UpdatePrivacySettings(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	userID, err := strconv.Atoi(idStr)
 	if err != nil {
 		log.Printf("ERROR: Invalid user ID format: %s: %v", idStr, err)
 		http.Error(w, "Invalid ID", http.StatusBadRequest)
 		return
 	}
 
-	if !utils.IsSelfOrSA(r, id) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to update User %d's email", reqUser, id)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
+	var payload struct {
+		EmailVisibility    *models.Visibility `json:"email_visibility"`
+		LastNameVisibility *models.Visibility `json:"last_name_visibility"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("ERROR: Failed to decode privacy settings for user %d: %v", userID, err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	before, err := db.GetPrivacySettings(r.Context(), userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to get privacy settings for user %d: %v", userID, err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	after := *before
+	if payload.EmailVisibility != nil {
+		after.EmailVisibility = *payload.EmailVisibility
+	}
+	if payload.LastNameVisibility != nil {
+		after.LastNameVisibility = *payload.LastNameVisibility
+	}
+
+	var v utils.Validator
+	if !after.EmailVisibility.IsValid() {
+		v.Add("email_visibility", utils.ValidationInvalid, "Must be group_members, group_admins or nobody")
+	}
+	if !after.LastNameVisibility.IsValid() {
+		v.Add("last_name_visibility", utils.ValidationInvalid, "Must be group_members, group_admins or nobody")
+	}
+	if !v.Valid() {
+		log.Printf("ERROR: Invalid privacy settings for user %d: %+v", userID, after)
+		utils.WriteValidationErrors(w, v.Errors)
+		return
+	}
+
+	if err := db.UpdatePrivacySettings(r.Context(), userID, &after); err != nil {
+		log.Printf("ERROR: Failed to update privacy settings for user %d: %v", userID, err)
+		http.Error(w, "Failed to update privacy settings", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditUserPrivacyChange,
+		TargetType: utils.AuditTargetUser,
+		TargetID:   userID,
+		Before:     before,
+		After:      after,
+	})
+
+	log.Printf("INFO: Privacy settings updated for user %d", userID)
+	json.NewEncoder(w).Encode(after)
+}
+
+func loadAccountExport(ctx context.Context, user *models.User) (*models.AccountExport, error) {
+	userID := int(user.ID)
+	export := models.AccountExport{
+		ExportedAt: time.Now().UTC(),
+		Profile: models.AccountProfile{
+			ID:                  user.ID,
+			FirstName:           user.FirstName,
+			LastName:            user.LastName,
+			Username:            user.Username,
+			Email:               user.Email,
+			Role:                user.Role,
+			CreatedAt:           user.CreatedAt,
+			EmailVerifiedAt:     user.EmailVerifiedAt,
+			PendingEmail:        user.PendingEmail,
+			DisplayName:         user.DisplayName,
+			Bio:                 user.Bio,
+			Timezone:            user.Timezone,
+			DeletionScheduledAt: user.DeletionScheduledAt,
+		},
+		Events: []models.Event{},
+	}
+
+	var err error
+	if export.Privacy, err = db.GetPrivacySettings(ctx, userID); err != nil {
+		return nil, err
+	}
+	if export.Memberships, err = db.GetGroupMembershipsForUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	events, err := db.GetAllEventsByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	export.Events = append(export.Events, events...)
+	if export.Attendance, err = db.GetAttendanceForUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	if export.Reactions, err = db.GetReactionsByUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	return &export, nil
+}
+
+func UpdateUserEmail(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("ERROR: Invalid user ID format: %s: %v", idStr, err)
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
 		return
 	}
 
@@ -118,18 +315,39 @@ func UpdateUserEmail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = db.UpdateUserEmail(r.Context(), id, emailUpdate.Email)
+	var v utils.Validator
+	v.Email("email", emailUpdate.Email)
+	if !v.Valid() {
+		log.Printf("ERROR: Invalid email in update request for user %d: %s", id, emailUpdate.Email)
+		utils.WriteValidationErrors(w, v.Errors)
+		return
+	}
+
+	err = requestEmailChange(r.Context(), id, emailUpdate.Email)
+	if errors.Is(err, db.ErrEmailTaken) {
+		log.Printf("ERROR: User %d attempted to change email to one already in use: %s", id, emailUpdate.Email)
+		http.Error(w, "Email is already in use", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		log.Printf("ERROR: Failed to update email for user %d: %v", id, err)
 		http.Error(w, "Failed to update email", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("INFO: Email successfully updated for user %d to %s", id, emailUpdate.Email)
-	w.WriteHeader(http.StatusOK)
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditUserEmailChange,
+		TargetType: utils.AuditTargetUser,
+		TargetID:   id,
+		After:      map[string]interface{}{"pending_email": emailUpdate.Email},
+	})
+
+	// The new address isn't used until it has been verified
+	log.Printf("INFO: Email change to %s pending verification for user %d", emailUpdate.Email, id)
+	w.WriteHeader(http.StatusAccepted)
 }
 
-func UpdateUserFirstName(w http.ResponseWriter, r *http.Request) {
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -138,10 +356,76 @@ func UpdateUserFirstName(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !utils.IsSelfOrSA(r, id) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to update User %d's first name", reqUser, id)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
+	var passwordUpdate struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&passwordUpdate); err != nil {
+		log.Printf("ERROR: Failed to decode password change request for user %d: %v", id, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := db.GetUserByID(r.Context(), id)
+	if err != nil {
+		log.Printf("ERROR: Failed to find user with ID %d: %v", id, err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if !verifyCurrentPassword(w, r, user, passwordUpdate.CurrentPassword) {
+		return
+	}
+
+	var v utils.Validator
+	v.Password("new_password", passwordUpdate.NewPassword)
+	if !v.Valid() {
+		log.Printf("ERROR: Password change for user %d rejected, new password failed validation", id)
+		utils.WriteValidationErrors(w, v.Errors)
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(passwordUpdate.NewPassword)
+	if err != nil {
+		log.Printf("ERROR: Failed to hash password for user %d: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = db.UpdateUserPassword(r.Context(), id, hashedPassword)
+	if err != nil {
+		log.Printf("ERROR: Failed to update password for user %d: %v", id, err)
+		http.Error(w, "Failed to update password", http.StatusInternalServerError)
+		return
+	}
+
+	sessionID := r.Context().Value("session_id").(string)
+	if err := db.RevokeOtherSessionsForUser(r.Context(), id, sessionID); err != nil {
+		log.Printf("ERROR: Failed to revoke other sessions for user %d after password change: %v", id, err)
+	}
+
+	if user.EmailVerifiedAt != nil {
+		emailBody := fmt.Sprintf(`The password for your account (%s) was just changed and all other devices were signed out. If you did not do this, reset your password and contact an Admin.`, user.Username)
+		go utils.NotifyUser(user.Email, "Your Password Was Changed", emailBody)
+	}
+
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditUserPasswordChange,
+		TargetType: utils.AuditTargetUser,
+		TargetID:   id,
+	})
+
+	log.Printf("INFO: Password successfully changed for user %d", id)
+	w.WriteHeader(http.StatusOK)
+}
+
+func UpdateUserFirstName(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("ERROR: Invalid user ID format: %s: %v", idStr, err)
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
 		return
 	}
 
@@ -155,6 +439,22 @@ func UpdateUserFirstName(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var v utils.Validator
+	v.Name("first_name", firstNameUpdate.FirstName)
+	if !v.Valid() {
+		log.Printf("ERROR: First name update for user %d failed validation: %v", id, v.Errors)
+		utils.WriteValidationErrors(w, v.Errors)
+		return
+	}
+	firstNameUpdate.FirstName = utils.NormalizeName(firstNameUpdate.FirstName)
+
+	before, err := db.GetUserByID(r.Context(), id)
+	if err != nil {
+		log.Printf("ERROR: Failed to find user with ID %d: %v", id, err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
 	err = db.UpdateUserFirstName(r.Context(), id, firstNameUpdate.FirstName)
 	if err != nil {
 		log.Printf("ERROR: Failed to update first name for user %d: %v", id, err)
@@ -162,6 +462,8 @@ func UpdateUserFirstName(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordUserUpdate(r, before)
+
 	log.Printf("INFO: First name successfully updated for user %d to %s", id, firstNameUpdate.FirstName)
 	w.WriteHeader(http.StatusOK)
 }
@@ -175,13 +477,6 @@ func UpdateUserLastName(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !utils.IsSelfOrSA(r, id) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to update User %d's last name", reqUser, id)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
-		return
-	}
-
 	var lastNameUpdate struct {
 		LastName string `json:"last_name"`
 	}
@@ -192,6 +487,22 @@ func UpdateUserLastName(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var v utils.Validator
+	v.Name("last_name", lastNameUpdate.LastName)
+	if !v.Valid() {
+		log.Printf("ERROR: Last name update for user %d failed validation: %v", id, v.Errors)
+		utils.WriteValidationErrors(w, v.Errors)
+		return
+	}
+	lastNameUpdate.LastName = utils.NormalizeName(lastNameUpdate.LastName)
+
+	before, err := db.GetUserByID(r.Context(), id)
+	if err != nil {
+		log.Printf("ERROR: Failed to find user with ID %d: %v", id, err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
 	err = db.UpdateUserLastName(r.Context(), id, lastNameUpdate.LastName)
 	if err != nil {
 		log.Printf("ERROR: Failed to update last name for user %d: %v", id, err)
@@ -199,6 +510,8 @@ func UpdateUserLastName(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordUserUpdate(r, before)
+
 	log.Printf("INFO: Last name successfully updated for user %d to %s", id, lastNameUpdate.LastName)
 	w.WriteHeader(http.StatusOK)
 }
@@ -212,13 +525,6 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !utils.IsSelfOrSA(r, id) {
-		reqUser := r.Context().Value("user_id").(int)
-		log.Printf("ERROR: Access denied - User %d attempted to update User %d", reqUser, id)
-		http.Error(w, "You do not have access to this resource", http.StatusForbidden)
-		return
-	}
-
 	var updates map[string]interface{}
 	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
 		log.Printf("ERROR: Failed to decode update request for user %d: %v", id, err)
@@ -226,29 +532,357 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate that only allowed fields are being updated
-	allowedFields := map[string]bool{
-		"first_name": true,
-		"last_name":  true,
-		"email":      true,
-		"username":   true,
+	if errs := utils.ValidateUserUpdate(r, id, updates); len(errs) > 0 {
+		log.Printf("ERROR: Update for user %d failed validation: %v", id, errs)
+		utils.WriteValidationErrors(w, errs)
+		return
+	}
+
+	for _, field := range []string{"first_name", "last_name"} {
+		if name, ok := updates[field].(string); ok {
+			updates[field] = utils.NormalizeName(name)
+		}
 	}
 
-	for field := range updates {
-		if !allowedFields[field] {
-			log.Printf("ERROR: Attempt to update invalid field '%s' for user %d", field, id)
-			http.Error(w, "Invalid field in update request", http.StatusBadRequest)
+	// Email changes go through verification rather than being applied directly
+	newEmail, hasEmail := updates["email"]
+	delete(updates, "email")
+
+	if hasEmail {
+		email := newEmail.(string)
+		err = requestEmailChange(r.Context(), id, email)
+		if errors.Is(err, db.ErrEmailTaken) {
+			log.Printf("ERROR: User %d attempted to change email to one already in use: %s", id, email)
+			http.Error(w, "Email is already in use", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("ERROR: Failed to update email for user %d: %v", id, err)
+			http.Error(w, "Failed to update user", http.StatusInternalServerError)
 			return
 		}
+
+		utils.RecordAudit(r, utils.AuditEntry{
+			Action:     utils.AuditUserEmailChange,
+			TargetType: utils.AuditTargetUser,
+			TargetID:   id,
+			After:      map[string]interface{}{"pending_email": email},
+		})
 	}
 
-	err = db.UpdateUser(r.Context(), id, updates)
+	if len(updates) > 0 {
+		before, err := db.GetUserByID(r.Context(), id)
+		if err != nil {
+			log.Printf("ERROR: Failed to find user with ID %d: %v", id, err)
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		err = db.UpdateUser(r.Context(), id, updates)
+		if err != nil {
+			log.Printf("ERROR: Failed to update user %d: %v", id, err)
+			http.Error(w, "Failed to update user", http.StatusInternalServerError)
+			return
+		}
+
+		recordUserUpdate(r, before)
+	}
+
+	log.Printf("INFO: Successfully updated fields for user %d: %v", id, updates)
+	if hasEmail {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func GetLockedUsers(w http.ResponseWriter, r *http.Request) {
+	lockouts, err := db.GetLockedUsers(r.Context())
 	if err != nil {
-		log.Printf("ERROR: Failed to update user %d: %v", id, err)
-		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		log.Printf("ERROR: Failed to retrieve locked users: %v", err)
+		http.Error(w, "Failed to get locked users", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("INFO: Successfully updated fields for user %d: %v", id, updates)
+	log.Printf("INFO: Retrieved %d locked users", len(lockouts))
+	json.NewEncoder(w).Encode(lockouts)
+}
+
+func UnlockUser(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("ERROR: Invalid user ID format: %s: %v", idStr, err)
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	err = db.ClearFailedLogins(r.Context(), id)
+	if err != nil {
+		log.Printf("ERROR: Failed to unlock user %d: %v", id, err)
+		http.Error(w, "Failed to unlock user", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditUserUnlock,
+		TargetType: utils.AuditTargetUser,
+		TargetID:   id,
+	})
+
+	log.Printf("INFO: User %d unlocked by user %d", id, r.Context().Value("user_id").(int))
 	w.WriteHeader(http.StatusOK)
 }
+
+const (
+	defaultUserPageSize = 25
+	maxUserPageSize     = 100
+)
+
+func SearchUsers(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := helpers.GetPagination(r, defaultUserPageSize, maxUserPageSize)
+	if err != nil {
+		log.Printf("ERROR: Invalid pagination for user search: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	search := strings.TrimSpace(r.URL.Query().Get("search"))
+
+	users, total, err := db.SearchUsers(r.Context(), search, limit, offset)
+	if err != nil {
+		log.Printf("ERROR: Failed to search users for '%s': %v", search, err)
+		http.Error(w, "Failed to get users", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("INFO: Retrieved %d of %d users for search '%s'", len(users), total, search)
+	json.NewEncoder(w).Encode(models.UserPage{
+		Users:  users,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+func UpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("ERROR: Invalid user ID format: %s: %v", idStr, err)
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var roleUpdate struct {
+		Role models.Role `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&roleUpdate); err != nil {
+		log.Printf("ERROR: Failed to decode role update for user %d: %v", id, err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	// Group admin is a per-group role and is managed through the group endpoints
+	var v utils.Validator
+	if roleUpdate.Role != models.Member && roleUpdate.Role != models.SuperAdmin {
+		v.Add("role", utils.ValidationInvalid, "Must be member or super_admin")
+	}
+	if !v.Valid() {
+		log.Printf("ERROR: Invalid role '%s' for user %d", roleUpdate.Role, id)
+		utils.WriteValidationErrors(w, v.Errors)
+		return
+	}
+
+	reqUser := r.Context().Value("user_id").(int)
+	if id == reqUser {
+		log.Printf("ERROR: User %d attempted to change their own role", reqUser)
+		http.Error(w, "You cannot change your own role", http.StatusBadRequest)
+		return
+	}
+
+	before, err := db.GetUserByID(r.Context(), id)
+	if err != nil {
+		log.Printf("ERROR: Failed to find user with ID %d: %v", id, err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	err = db.SetUserRole(r.Context(), id, roleUpdate.Role)
+	if errors.Is(err, db.ErrLastSuperAdmin) {
+		log.Printf("ERROR: Refused to demote user %d, they are the last super admin", id)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to set role for user %d: %v", id, err)
+		http.Error(w, "Failed to update role", http.StatusInternalServerError)
+		return
+	}
+	utils.InvalidatePrincipal(id)
+
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditUserRoleChange,
+		TargetType: utils.AuditTargetUser,
+		TargetID:   id,
+		Before:     map[string]interface{}{"role": before.Role},
+		After:      map[string]interface{}{"role": roleUpdate.Role},
+	})
+
+	log.Printf("INFO: User %d role set to %s by user %d", id, roleUpdate.Role, reqUser)
+	w.WriteHeader(http.StatusOK)
+}
+
+func DisableUser(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("ERROR: Invalid user ID format: %s: %v", idStr, err)
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	reqUser := r.Context().Value("user_id").(int)
+	if id == reqUser {
+		log.Printf("ERROR: User %d attempted to disable their own account", reqUser)
+		http.Error(w, "You cannot disable your own account", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.SetUserDisabled(r.Context(), id, true); err != nil {
+		log.Printf("ERROR: Failed to disable user %d: %v", id, err)
+		http.Error(w, "Failed to disable user", http.StatusInternalServerError)
+		return
+	}
+	utils.InvalidatePrincipal(id)
+
+	if err := db.RevokeAllSessionsForUser(r.Context(), id); err != nil {
+		log.Printf("ERROR: Failed to revoke sessions for disabled user %d: %v", id, err)
+	}
+
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditUserDisable,
+		TargetType: utils.AuditTargetUser,
+		TargetID:   id,
+		Before:     map[string]interface{}{"disabled": false},
+		After:      map[string]interface{}{"disabled": true},
+	})
+
+	log.Printf("INFO: User %d disabled by user %d", id, reqUser)
+	w.WriteHeader(http.StatusOK)
+}
+
+func EnableUser(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("ERROR: Invalid user ID format: %s: %v", idStr, err)
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.SetUserDisabled(r.Context(), id, false); err != nil {
+		log.Printf("ERROR: Failed to enable user %d: %v", id, err)
+		http.Error(w, "Failed to enable user", http.StatusInternalServerError)
+		return
+	}
+	utils.InvalidatePrincipal(id)
+
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditUserEnable,
+		TargetType: utils.AuditTargetUser,
+		TargetID:   id,
+		Before:     map[string]interface{}{"disabled": true},
+		After:      map[string]interface{}{"disabled": false},
+	})
+
+	log.Printf("INFO: User %d re-enabled by user %d", id, r.Context().Value("user_id").(int))
+	w.WriteHeader(http.StatusOK)
+}
+
+// ForcePasswordReset signs the user out everywhere and emails a reset code they must use before signing in again
+func ForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("ERROR: Invalid user ID format: %s: %v", idStr, err)
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	user, err := db.GetUserByID(r.Context(), id)
+	if err != nil {
+		log.Printf("ERROR: Failed to find user with ID %d: %v", id, err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// Without a verified email the user would have no way to complete the reset
+	if user.EmailVerifiedAt == nil {
+		log.Printf("ERROR: Cannot force password reset for user %d, email is not verified", id)
+		http.Error(w, "User does not have a verified email", http.StatusConflict)
+		return
+	}
+
+	resetCode, err := db.GeneratePasswordResetCode(r.Context(), user.Email)
+	if err != nil {
+		log.Printf("ERROR: Failed to generate password reset code for user %d: %v", id, err)
+		http.Error(w, "Failed to force password reset", http.StatusInternalServerError)
+		return
+	}
+
+	if err := db.SetPasswordResetRequired(r.Context(), id); err != nil {
+		log.Printf("ERROR: Failed to require password reset for user %d: %v", id, err)
+		http.Error(w, "Failed to force password reset", http.StatusInternalServerError)
+		return
+	}
+	utils.InvalidatePrincipal(id)
+
+	if err := db.RevokeAllSessionsForUser(r.Context(), id); err != nil {
+		log.Printf("ERROR: Failed to revoke sessions for user %d after forced password reset: %v", id, err)
+	}
+
+	emailBody := fmt.Sprintf(`An Admin has required you to reset your password before signing in again. Here is your password reset code, it expires in 15 minutes: %s`, resetCode)
+	go utils.NotifyUser(user.Email, "Password Reset Required", emailBody)
+
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditUserForcePasswordReset,
+		TargetType: utils.AuditTargetUser,
+		TargetID:   id,
+	})
+
+	log.Printf("INFO: Password reset forced for user %d by user %d", id, r.Context().Value("user_id").(int))
+	w.WriteHeader(http.StatusOK)
+}
+
+// userAuditSnapshot is the part of a user worth keeping in the audit log, never the password hash
+func userAuditSnapshot(user *models.User) map[string]interface{} {
+	if user == nil {
+		return nil
+	}
+
+	return map[string]interface{}{
+		"id":         user.ID,
+		"username":   user.Username,
+		"email":      user.Email,
+		"first_name": user.FirstName,
+		"last_name":  user.LastName,
+		"role":       user.Role,
+	}
+}
+
+// recordUserUpdate audits a profile change with snapshots from before and after the update
+func recordUserUpdate(r *http.Request, before *models.User) {
+	after, err := db.GetUserByID(r.Context(), int(before.ID))
+	if err != nil {
+		log.Printf("ERROR: Failed to reload user %d for audit: %v", before.ID, err)
+	}
+
+	utils.RecordAudit(r, utils.AuditEntry{
+		Action:     utils.AuditUserUpdate,
+		TargetType: utils.AuditTargetUser,
+		TargetID:   int(before.ID),
+		Before:     userAuditSnapshot(before),
+		After:      userAuditSnapshot(after),
+	})
+}
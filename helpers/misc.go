@@ -2,6 +2,8 @@ package helpers
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"math/big"
 )
 
@@ -19,3 +21,9 @@ func GenerateRandomString(length int) (string, error) {
 	}
 	return string(bytes), nil
 }
+
+// HashToken returns the hex encoded SHA-256 digest of a token so it can be stored and compared without keeping the plaintext.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,107 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var trustedProxies []netip.Prefix
+
+// InitTrustedProxies reads TRUSTED_PROXIES, a comma separated list of IPs or CIDR ranges whose X-Forwarded-For
+// header is believed. With none configured the header is ignored, so a deployment behind a reverse proxy on the
+// same host needs TRUSTED_PROXIES=127.0.0.1,::1 to see real client addresses.
+func InitTrustedProxies() error {
+	trustedProxies = nil
+
+	for _, entry := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+			}
+			addr = addr.Unmap()
+			trustedProxies = append(trustedProxies, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		trustedProxies = append(trustedProxies, prefix.Masked())
+	}
+
+	return nil
+}
+
+func isTrustedProxy(addr netip.Addr) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetClientIP returns the address the request came from. X-Forwarded-For is only read when the connection comes
+// from a trusted proxy, and then from the right, since each proxy appends the address it saw and anything to the
+// left of the last trusted hop could have been made up by the client.
+func GetClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	client, err := netip.ParseAddr(host)
+	if err != nil || !isTrustedProxy(client.Unmap()) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = hop.Unmap()
+		if !isTrustedProxy(client) {
+			break
+		}
+	}
+
+	return client.String()
+}
+
+// GetPagination reads the limit and offset query parameters, applying the default and capping the limit
+func GetPagination(r *http.Request, defaultLimit, maxLimit int) (int, int, error) {
+	limit, offset := defaultLimit, 0
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 {
+			return 0, 0, errors.New("invalid limit")
+		}
+		limit = min(parsed, maxLimit)
+	}
+
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		parsed, err := strconv.Atoi(offsetStr)
+		if err != nil || parsed < 0 {
+			return 0, 0, errors.New("invalid offset")
+		}
+		offset = parsed
+	}
+
+	return limit, offset, nil
+}
@@ -0,0 +1,53 @@
+package helpers
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetClientIP(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "127.0.0.1, 10.0.0.0/8")
+	if err := InitTrustedProxies(); err != nil {
+		t.Fatalf("failed to read trusted proxies: %v", err)
+	}
+	t.Cleanup(func() { trustedProxies = nil })
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		wantClientIP string
+	}{
+		{"direct connection", "203.0.113.7:5123", nil, "203.0.113.7"},
+		{"header from an untrusted peer is ignored", "203.0.113.7:5123", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy without a header", "127.0.0.1:5123", nil, "127.0.0.1"},
+		{"trusted proxy", "127.0.0.1:5123", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"client supplied hops left of the real one", "127.0.0.1:5123", []string{"1.1.1.1, 2.2.2.2, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of trusted proxies", "127.0.0.1:5123", []string{"198.51.100.1, 10.1.2.3"}, "198.51.100.1"},
+		{"repeated headers", "127.0.0.1:5123", []string{"1.1.1.1", "198.51.100.1, 10.1.2.3"}, "198.51.100.1"},
+		{"garbage stops the walk", "127.0.0.1:5123", []string{"198.51.100.1, not-an-ip, 10.1.2.3"}, "10.1.2.3"},
+		{"IPv4-mapped proxy address", "[::ffff:127.0.0.1]:5123", []string{"198.51.100.1"}, "198.51.100.1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = test.remoteAddr
+			for _, value := range test.forwardedFor {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+
+			if got := GetClientIP(r); got != test.wantClientIP {
+				t.Errorf("GetClientIP() = %q, want %q", got, test.wantClientIP)
+			}
+		})
+	}
+}
+
+func TestInitTrustedProxiesRejectsInvalidEntries(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "127.0.0.1,proxy.internal")
+	if err := InitTrustedProxies(); err == nil {
+		t.Error("an invalid trusted proxy was accepted")
+	}
+	t.Cleanup(func() { trustedProxies = nil })
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"nest/db"
+	"nest/helpers"
 	"nest/models"
 	"nest/routes"
 	"nest/utils"
@@ -34,6 +35,34 @@ func main() {
 		log.Println("Log file attached...")
 	}
 
+	if err := utils.InitKeyRing(); err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
+	}
+
+	if err := utils.InitPasswordHasher(); err != nil {
+		log.Fatalf("Invalid password hashing parameters: %v", err)
+	}
+
+	if err := utils.InitSessionCookies(); err != nil {
+		log.Fatalf("Invalid session cookie settings: %v", err)
+	}
+
+	if err := utils.InitOIDCProviders(); err != nil {
+		log.Fatalf("Failed to load OIDC providers: %v", err)
+	}
+
+	if err := utils.InitWebAuthn(); err != nil {
+		log.Fatalf("Invalid WebAuthn settings: %v", err)
+	}
+
+	if err := utils.InitStorage(); err != nil {
+		log.Fatalf("Failed to set up file storage: %v", err)
+	}
+
+	if err := helpers.InitTrustedProxies(); err != nil {
+		log.Fatalf("Invalid trusted proxy settings: %v", err)
+	}
+
 	dbUser := os.Getenv("DB_USER")
 	dbPassword := os.Getenv("DB_PASSWORD")
 	dbHost := os.Getenv("DB_HOST")
@@ -118,6 +147,16 @@ func main() {
 		log.Println("Event notifications scheduled successfully...")
 	}
 
+	_, err = s.Every(1).Hour().Do(func() {
+		utils.PurgeScheduledDeletions(context.Background())
+	})
+
+	if err != nil {
+		log.Printf("Error scheduling account deletion purge: %v", err)
+	} else {
+		log.Println("Account deletion purge scheduled successfully...")
+	}
+
 	s.StartAsync()
 
 	log.Println("Server is running on port 5000...")
@@ -3,28 +3,36 @@ package middleware
 import (
 	"context"
 	"fmt"
+	"log"
+	"nest/db"
+	"nest/helpers"
+	"nest/models"
+	"nest/utils"
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v4"
 )
 
-// ParseTokenFromRequest extracts and validates JWT token from request, returning claims if valid
+// ParseTokenFromRequest extracts and validates a JWT or personal access token from request, returning claims if valid.
+// Without an Authorization header it falls back to the session cookie, which only ever holds a session JWT.
 func ParseTokenFromRequest(r *http.Request) (jwt.MapClaims, error) {
 	tokenString := r.Header.Get("Authorization")
+	if tokenString != "" {
+		tokenString = strings.TrimPrefix(tokenString, "Bearer ")
+
+		if utils.IsPersonalAccessToken(tokenString) {
+			return parsePersonalAccessToken(r, tokenString)
+		}
+	} else {
+		tokenString = utils.CookieValue(r, utils.SessionCookieName)
+	}
+
 	if tokenString == "" {
 		return nil, fmt.Errorf("missing token")
 	}
 
-	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
-
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("invalid signing method")
-		}
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
+	token, err := jwt.Parse(tokenString, utils.JWTKeyfunc)
 
 	if err != nil || !token.Valid {
 		return nil, fmt.Errorf("invalid token")
@@ -37,6 +45,29 @@ func ParseTokenFromRequest(r *http.Request) (jwt.MapClaims, error) {
 	return nil, fmt.Errorf("invalid token claims")
 }
 
+// parsePersonalAccessToken looks up a personal access token and presents it as claims, with its scope under "scope"
+func parsePersonalAccessToken(r *http.Request, tokenString string) (jwt.MapClaims, error) {
+	token, err := db.GetPersonalAccessTokenByHash(r.Context(), helpers.HashToken(tokenString))
+	if err != nil || !token.IsActive() {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	claims := jwt.MapClaims{
+		"user_id": float64(token.UserID),
+		"scope": &models.TokenScope{
+			TokenID:  token.ID,
+			ReadOnly: token.ReadOnly,
+			GroupIDs: token.GroupIDs,
+		},
+	}
+
+	if principal, err := utils.LoadPrincipal(r.Context(), int(token.UserID)); err == nil {
+		claims["username"] = principal.Username
+	}
+
+	return claims, nil
+}
+
 func JWTAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		claims, err := ParseTokenFromRequest(r)
@@ -45,15 +76,122 @@ func JWTAuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		username := claims["username"].(string)
-		role := claims["role"].(string)
+		scope, isPersonalAccessToken := claims["scope"].(*models.TokenScope)
+		sessionID, _ := claims["sid"].(string)
+
+		if isPersonalAccessToken {
+			if scope.ReadOnly && !isReadOnlyMethod(r.Method) {
+				http.Error(w, "token is read-only", http.StatusForbidden)
+				return
+			}
+
+			if err := db.TouchPersonalAccessToken(r.Context(), scope.TokenID); err != nil {
+				log.Printf("ERROR: Failed to record use of token %d: %v", scope.TokenID, err)
+			}
+		} else {
+			if sessionID == "" {
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+				return
+			}
+
+			active, err := db.IsSessionActive(r.Context(), sessionID)
+			if err != nil {
+				log.Printf("ERROR: Failed to check session %s: %v", sessionID, err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if !active {
+				http.Error(w, "session has been revoked", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		// Impersonation tokens stay valid only while the acting SA still is one
+		impersonatorID, isImpersonating := utils.ImpersonatorFromClaims(claims)
+		if isImpersonating {
+			actor, err := utils.LoadPrincipal(r.Context(), impersonatorID)
+			if err != nil || actor.Disabled || actor.Role != models.SuperAdmin {
+				http.Error(w, "impersonation is no longer allowed", http.StatusUnauthorized)
+				return
+			}
+		}
+
 		userID := int(claims["user_id"].(float64))
 
-		ctx := context.WithValue(r.Context(), "username", username)
-		ctx = context.WithValue(ctx, "role", role)
+		// Resolve the role from the database rather than trusting the token, so demotions apply immediately
+		principal, err := utils.LoadPrincipal(r.Context(), userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to load principal for user %d: %v", userID, err)
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		if principal.Disabled {
+			http.Error(w, "account is disabled", http.StatusForbidden)
+			return
+		}
+		if principal.PasswordResetRequired {
+			http.Error(w, "password reset required", http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), "username", principal.Username)
+		ctx = context.WithValue(ctx, "role", string(principal.Role))
 		ctx = context.WithValue(ctx, "user_id", userID)
+		if isPersonalAccessToken {
+			ctx = context.WithValue(ctx, "token_scope", scope)
+		} else {
+			ctx = context.WithValue(ctx, "session_id", sessionID)
+		}
+		if isImpersonating {
+			ctx = context.WithValue(ctx, "impersonator_id", impersonatorID)
+		}
 
 		r = r.WithContext(ctx)
 		next.ServeHTTP(w, r)
 	})
 }
+
+// SessionOnlyMiddleware rejects personal access tokens on routes that manage the account's own credentials
+func SessionOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value("session_id").(string); !ok {
+			http.Error(w, "This action requires signing in", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CSRFMiddleware requires the double-submitted CSRF token on state-changing requests authenticated by the session cookie
+func CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Bearer tokens aren't sent automatically by browsers, so only cookie requests can be forged
+		if isReadOnlyMethod(r.Method) || r.Header.Get("Authorization") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		sessionID, _ := r.Context().Value("session_id").(string)
+		if !utils.ValidCSRFToken(r, sessionID) {
+			log.Printf("ERROR: Missing or invalid CSRF token for %s %s", r.Method, r.URL.Path)
+			http.Error(w, "invalid CSRF token", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isReadOnlyMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// NoImpersonationMiddleware refuses destructive and credential-changing actions while an SA is acting as another user
+func NoImpersonationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value("impersonator_id").(int); ok {
+			http.Error(w, "This action is not allowed while impersonating", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
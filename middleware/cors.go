@@ -1,16 +1,24 @@
 package middleware
 
 import (
+	"nest/utils"
 	"net/http"
 )
 
 func CORSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Cookie sessions need the exact origin echoed back, a wildcard can't carry credentials
+		if origin := r.Header.Get("Origin"); utils.IsAllowedOrigin(origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		}
+		w.Header().Add("Vary", "Origin")
+
 		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
-		//w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, "+utils.CSRFHeaderName)
 		w.Header().Set("Access-Control-Max-Age", "300") // 5 minutes
 
 		// Handle preflight requests
@@ -1,9 +1,17 @@
 package middleware
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"log"
+	"nest/helpers"
+	"nest/models"
+	"nest/utils"
 	"net/http"
 	"time"
+
+	"github.com/golang-jwt/jwt/v4"
 )
 
 // LoggingMiddleware handles request logging with detailed information
@@ -29,6 +37,12 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 			if u, ok := claims["username"].(string); ok {
 				username = u
 			}
+
+			// Tag and audit every request made while an SA is acting as someone else
+			if impersonatorID, ok := utils.ImpersonatorFromClaims(claims); ok {
+				username = fmt.Sprintf("%s (impersonated by user %d)", username, impersonatorID)
+				go auditImpersonatedRequest(claims, impersonatorID, r, rw.statusCode)
+			}
 		} else if user, ok := r.Context().Value("username").(string); ok {
 			username = user
 		}
@@ -43,12 +57,35 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 			r.Proto,
 			rw.statusCode,
 			duration,
-			getClientIP(r),
+			helpers.GetClientIP(r),
 			r.UserAgent(),
 		)
 	})
 }
 
+func auditImpersonatedRequest(claims jwt.MapClaims, impersonatorID int, r *http.Request, status int) {
+	userID, _ := claims["user_id"].(float64)
+	actorID := int64(userID)
+	impersonator := int64(impersonatorID)
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+		"status": status,
+	})
+
+	utils.WriteAuditEvent(context.Background(), &models.AuditEvent{
+		ActorID:        &actorID,
+		ImpersonatorID: &impersonator,
+		Action:         utils.AuditImpersonationRequest,
+		TargetType:     utils.AuditTargetUser,
+		TargetID:       &actorID,
+		Metadata:       metadata,
+		IP:             helpers.GetClientIP(r),
+		UserAgent:      r.UserAgent(),
+	})
+}
+
 // responseWriter is a custom ResponseWriter that captures the status code
 type responseWriter struct {
 	http.ResponseWriter
@@ -59,14 +96,3 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
-
-// getClientIP extracts the client IP address from the request
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header first (for proxied requests)
-	forwarded := r.Header.Get("X-Forwarded-For")
-	if forwarded != "" {
-		return forwarded
-	}
-	// Fall back to RemoteAddr
-	return r.RemoteAddr
-}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"log"
+	"nest/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// PolicyMiddleware authorizes the action against the resource named by the route's {id} parameter
+func PolicyMiddleware(action utils.Action) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			idStr := chi.URLParam(r, "id")
+			id, err := strconv.Atoi(idStr)
+			if err != nil {
+				log.Printf("ERROR: Invalid ID format: %s: %v", idStr, err)
+				http.Error(w, "Invalid ID", http.StatusBadRequest)
+				return
+			}
+
+			if !utils.Authorize(r, action, id) {
+				reqUser := r.Context().Value("user_id").(int)
+				log.Printf("ERROR: Access denied - User %d attempted %s on %d", reqUser, action, id)
+				http.Error(w, "You do not have access to this resource", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
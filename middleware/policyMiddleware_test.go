@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+	"nest/models"
+	"nest/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// User actions resolve without the database, so they exercise the middleware end to end
+func TestPolicyMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		userID     int
+		role       models.Role
+		id         string
+		wantStatus int
+	}{
+		{"self", 1, models.Member, "1", http.StatusOK},
+		{"other member", 2, models.Member, "1", http.StatusForbidden},
+		{"super admin", 3, models.SuperAdmin, "1", http.StatusOK},
+		{"invalid id", 1, models.Member, "abc", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reached := false
+			handler := PolicyMiddleware(utils.ActionUserUpdate)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reached = true
+			}))
+
+			routeContext := chi.NewRouteContext()
+			routeContext.URLParams.Add("id", test.id)
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, routeContext)
+			ctx = context.WithValue(ctx, "user_id", test.userID)
+			ctx = context.WithValue(ctx, "role", string(test.role))
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPatch, "/user/"+test.id, nil).WithContext(ctx))
+
+			if recorder.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, test.wantStatus)
+			}
+			if reached != (test.wantStatus == http.StatusOK) {
+				t.Errorf("handler reached = %v", reached)
+			}
+		})
+	}
+}
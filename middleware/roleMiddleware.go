@@ -13,6 +13,11 @@ func RoleMiddleware(requiredRole models.Role) func(http.Handler) http.Handler {
 				http.Error(w, "Insufficient permissions", http.StatusForbidden)
 				return
 			}
+			// Tokens limited to specific groups can't reach deployment-wide endpoints
+			if scope, ok := r.Context().Value("token_scope").(*models.TokenScope); ok && len(scope.GroupIDs) > 0 {
+				http.Error(w, "Insufficient permissions", http.StatusForbidden)
+				return
+			}
 			next.ServeHTTP(w, r)
 		})
 	}
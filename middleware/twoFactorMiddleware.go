@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"log"
+	"nest/utils"
+	"net/http"
+)
+
+// TwoFactorEnrollmentMiddleware blocks privileged accounts that have not enrolled in 2FA while the deployment requires it
+func TwoFactorEnrollmentMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int)
+
+		principal, err := utils.LoadPrincipal(r.Context(), userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to load principal for user %d: %v", userID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		settings, err := utils.LoadSettings(r.Context())
+		if err != nil {
+			log.Printf("ERROR: Failed to load settings: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if principal.RequiresTwoFactor(settings) && !principal.TwoFactorEnabled {
+			http.Error(w, "Two-factor authentication enrollment required", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+type GroupMembership struct {
+	GroupID   int64  `json:"group_id"`
+	GroupName string `json:"group_name"`
+	Role      string `json:"role_in_group"`
+}
+
+// AccountProfile is the account as the user sees it, without credentials
+type AccountProfile struct {
+	ID                  int64      `json:"id"`
+	FirstName           string     `json:"first_name"`
+	LastName            string     `json:"last_name"`
+	Username            string     `json:"username"`
+	Email               string     `json:"email"`
+	Role                Role       `json:"role"`
+	CreatedAt           time.Time  `json:"created_at"`
+	EmailVerifiedAt     *time.Time `json:"email_verified_at"`
+	PendingEmail        *string    `json:"pending_email"`
+	DisplayName         string     `json:"display_name"`
+	Bio                 string     `json:"bio"`
+	Timezone            string     `json:"timezone"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at"`
+}
+
+// AccountExport is everything a user can download about their own account
+type AccountExport struct {
+	ExportedAt  time.Time         `json:"exported_at"`
+	Profile     AccountProfile    `json:"profile"`
+	Privacy     *PrivacySettings  `json:"privacy"`
+	Memberships []GroupMembership `json:"memberships"`
+	Events      []Event           `json:"events"`
+	Attendance  []EventAttendance `json:"attendance"`
+	Reactions   []UserReaction    `json:"reactions"`
+}
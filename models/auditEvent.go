@@ -0,0 +1,40 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type AuditEvent struct {
+	ID             int64           `json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	ActorID        *int64          `json:"actor_id"`
+	ImpersonatorID *int64          `json:"impersonator_id"`
+	Action         string          `json:"action"`
+	TargetType     string          `json:"target_type"`
+	TargetID       *int64          `json:"target_id"`
+	GroupID        *int64          `json:"group_id"`
+	Before         json.RawMessage `json:"before"`
+	After          json.RawMessage `json:"after"`
+	Metadata       json.RawMessage `json:"metadata"`
+	IP             string          `json:"ip"`
+	UserAgent      string          `json:"user_agent"`
+}
+
+// AuditFilter narrows an audit log query, unset fields match everything
+type AuditFilter struct {
+	ActorID    *int
+	Action     string
+	TargetType string
+	TargetID   *int
+	GroupID    *int
+	Since      *time.Time
+	Until      *time.Time
+}
+
+type AuditEventPage struct {
+	Events []AuditEvent `json:"events"`
+	Total  int          `json:"total"`
+	Limit  int          `json:"limit"`
+	Offset int          `json:"offset"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// PublicEvent is when and where an event happens
+type PublicEvent struct {
+	ID        int64     `json:"id"`
+	GroupID   int64     `json:"group_id"`
+	Name      string    `json:"name"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	Location  string    `json:"location"`
+}
+
+// MemberEvent is the event as members of its group and admins see it
+type MemberEvent struct {
+	PublicEvent
+	Description string    `json:"description"`
+	CreatedByID int64     `json:"created_by_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func NewPublicEvent(event *Event) PublicEvent {
+	return PublicEvent{
+		ID:        event.ID,
+		GroupID:   event.GroupID,
+		Name:      event.Name,
+		StartTime: event.StartTime,
+		EndTime:   event.EndTime,
+		Location:  event.Location,
+	}
+}
+
+func NewMemberEvent(event *Event) MemberEvent {
+	return MemberEvent{
+		PublicEvent: NewPublicEvent(event),
+		Description: event.Description,
+		CreatedByID: event.CreatedByID,
+		CreatedAt:   event.CreatedAt,
+	}
+}
+
+// EventView projects the event for a caller with the given view, events have nothing only admins may see
+func EventView(event *Event, view View) interface{} {
+	if view == ViewPublic {
+		return NewPublicEvent(event)
+	}
+	return NewMemberEvent(event)
+}
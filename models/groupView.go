@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// PublicGroup is what anyone may see about a group, for example when looking up an invitation
+type PublicGroup struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// MemberGroup is the group as its members see it
+type MemberGroup struct {
+	PublicGroup
+	CreatedByID  int64     `json:"created_by_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	DoSendEmails bool      `json:"do_send_emails"`
+}
+
+// AdminGroup adds the join code, which lets anyone holding it join the group
+type AdminGroup struct {
+	MemberGroup
+	Code string `json:"code"`
+}
+
+func NewPublicGroup(group *Group) PublicGroup {
+	return PublicGroup{ID: group.ID, Name: group.Name}
+}
+
+func NewMemberGroup(group *Group) MemberGroup {
+	return MemberGroup{
+		PublicGroup:  NewPublicGroup(group),
+		CreatedByID:  group.CreatedByID,
+		CreatedAt:    group.CreatedAt,
+		DoSendEmails: group.DoSendEmails,
+	}
+}
+
+func NewAdminGroup(group *Group) AdminGroup {
+	return AdminGroup{MemberGroup: NewMemberGroup(group), Code: group.Code}
+}
+
+// GroupView projects the group for a caller with the given view
+func GroupView(group *Group, view View) interface{} {
+	switch view {
+	case ViewSelf:
+		return NewMemberGroup(group)
+	case ViewAdmin:
+		return NewAdminGroup(group)
+	default:
+		return NewPublicGroup(group)
+	}
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+type Invitation struct {
+	ID             int64      `json:"id"`
+	Email          string     `json:"email"`
+	GroupID        *int64     `json:"group_id"`
+	InvitedByID    *int64     `json:"invited_by_id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at"`
+	AcceptedUserID *int64     `json:"accepted_user_id"`
+	RevokedAt      *time.Time `json:"revoked_at"`
+}
+
+// IsPending reports whether the invitation can still be redeemed
+func (i *Invitation) IsPending() bool {
+	return i.AcceptedAt == nil && i.RevokedAt == nil && time.Now().Before(i.ExpiresAt)
+}
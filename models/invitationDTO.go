@@ -0,0 +1,6 @@
+package models
+
+type InvitationDTO struct {
+	Email   string `json:"email"`
+	GroupID *int64 `json:"group_id"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+type LoginLockout struct {
+	UserID            int64      `json:"user_id"`
+	Username          string     `json:"username"`
+	Email             string     `json:"email"`
+	FailedAttempts    int        `json:"failed_attempts"`
+	LastFailedLoginAt *time.Time `json:"last_failed_login_at"`
+	LockedUntil       *time.Time `json:"locked_until"`
+}
+
+// IsLocked reports whether the account is currently locked out
+func (l *LoginLockout) IsLocked() bool {
+	return l.LockedUntil != nil && time.Now().Before(*l.LockedUntil)
+}
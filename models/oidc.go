@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// OIDCProviderConfig is one entry in the identity provider registry
+type OIDCProviderConfig struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes"`
+	// Defaults to the web UI's callback page for the provider
+	RedirectURL string `json:"redirect_url"`
+}
+
+// OIDCProviderSummary is what clients see of a provider, to render a sign in button
+type OIDCProviderSummary struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// OIDCIdentity holds the verified claims from a provider's ID token
+type OIDCIdentity struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	GivenName         string
+	FamilyName        string
+	PreferredUsername string
+}
+
+type OIDCLoginState struct {
+	ID           int64
+	StateHash    string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+	ConsumedAt   *time.Time
+}
+
+// UserIdentity links an account to a subject at an external identity provider
+type UserIdentity struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"-"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+type PersonalAccessToken struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	TokenHash  string     `json:"-"`
+	ReadOnly   bool       `json:"read_only"`
+	GroupIDs   []int64    `json:"group_ids"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// IsActive reports whether the token can still be used to authenticate
+func (t *PersonalAccessToken) IsActive() bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || time.Now().Before(*t.ExpiresAt))
+}
+
+// TokenScope limits what a request authenticated with a personal access token may do
+type TokenScope struct {
+	TokenID  int64
+	ReadOnly bool
+	// Empty means every group the user can access
+	GroupIDs []int64
+}
+
+// AllowsGroup reports whether the scope covers the group
+func (s *TokenScope) AllowsGroup(groupID int64) bool {
+	if s == nil || len(s.GroupIDs) == 0 {
+		return true
+	}
+
+	for _, id := range s.GroupIDs {
+		if id == groupID {
+			return true
+		}
+	}
+	return false
+}
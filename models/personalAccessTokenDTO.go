@@ -0,0 +1,8 @@
+package models
+
+type PersonalAccessTokenDTO struct {
+	Name          string  `json:"name"`
+	ReadOnly      bool    `json:"read_only"`
+	GroupIDs      []int64 `json:"group_ids"`
+	ExpiresInDays int     `json:"expires_in_days"`
+}
@@ -0,0 +1,18 @@
+package models
+
+// Principal is the live view of an authenticated user used for authorization decisions
+type Principal struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+	Role     Role   `json:"role"`
+	Disabled bool   `json:"disabled"`
+	// Set by an SA, the user can't sign in until they reset their password
+	PasswordResetRequired bool `json:"password_reset_required"`
+	IsGroupAdmin          bool `json:"is_group_admin"`
+	TwoFactorEnabled      bool `json:"two_factor_enabled"`
+}
+
+// RequiresTwoFactor reports whether the account must have 2FA when the deployment requires it for privileged users
+func (p *Principal) RequiresTwoFactor(settings *Settings) bool {
+	return settings.RequireTwoFactor && (p.Role == SuperAdmin || p.IsGroupAdmin)
+}
@@ -0,0 +1,30 @@
+package models
+
+// Visibility says who besides the user and super admins can see a profile field
+type Visibility string
+
+const (
+	VisibleToGroupMembers Visibility = "group_members"
+	VisibleToGroupAdmins  Visibility = "group_admins"
+	VisibleToNobody       Visibility = "nobody"
+)
+
+// IsValid reports whether the visibility is one of the known settings
+func (v Visibility) IsValid() bool {
+	switch v {
+	case VisibleToGroupMembers, VisibleToGroupAdmins, VisibleToNobody:
+		return true
+	}
+	return false
+}
+
+type PrivacySettings struct {
+	EmailVisibility    Visibility `json:"email_visibility"`
+	LastNameVisibility Visibility `json:"last_name_visibility"`
+}
+
+// Viewer is the caller that user queries apply privacy settings for
+type Viewer struct {
+	UserID       int
+	IsSuperAdmin bool
+}
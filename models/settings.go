@@ -0,0 +1,6 @@
+package models
+
+type Settings struct {
+	RequireTwoFactor bool `json:"require_two_factor"`
+	MagicLinkLogin   bool `json:"magic_link_login"`
+}
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 type User struct {
 	ID           int64     `json:"id"`
@@ -8,7 +11,26 @@ type User struct {
 	LastName     string    `json:"last_name"`
 	Username     string    `json:"username"`
 	Email        string    `json:"email"`
-	PasswordHash []byte    `json:"password_hash"`
+	PasswordHash []byte    `json:"-"`
 	CreatedAt    time.Time `json:"created_at"`
 	Role         Role      `json:"role"`
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	PendingEmail    *string    `json:"pending_email"`
+
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at"`
+
+	DisplayName     string     `json:"display_name"`
+	Bio             string     `json:"bio"`
+	Timezone        string     `json:"timezone"`
+	AvatarKey       *string    `json:"-"`
+	AvatarUpdatedAt *time.Time `json:"avatar_updated_at"`
+}
+
+// AvatarURL is where the user's avatar is served, versioned so clients can cache it until it changes
+func (u *User) AvatarURL() string {
+	if u.AvatarUpdatedAt == nil {
+		return ""
+	}
+	return fmt.Sprintf("/api/user/%d/avatar?v=%d", u.ID, u.AvatarUpdatedAt.Unix())
 }
@@ -6,4 +6,7 @@ type UserDTO struct {
 	Email     string `json:"email"`
 	Username  string `json:"username"`
 	Password  string `json:"password"`
+
+	// Optional token from an invitation link, registering with it joins the inviting group
+	InviteToken string `json:"invite_token"`
 }
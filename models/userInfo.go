@@ -1,7 +0,0 @@
-package models
-
-type UserInfo struct {
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-	Username  string `json:"username"`
-}
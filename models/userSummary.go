@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// UserSummary is the SA's view of an account in the user management console
+type UserSummary struct {
+	ID                    int64      `json:"id"`
+	Username              string     `json:"username"`
+	Email                 string     `json:"email"`
+	FirstName             string     `json:"first_name"`
+	LastName              string     `json:"last_name"`
+	Role                  Role       `json:"role"`
+	Disabled              bool       `json:"disabled"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	EmailVerifiedAt       *time.Time `json:"email_verified_at"`
+	CreatedAt             time.Time  `json:"created_at"`
+}
+
+type UserPage struct {
+	Users  []UserSummary `json:"users"`
+	Total  int           `json:"total"`
+	Limit  int           `json:"limit"`
+	Offset int           `json:"offset"`
+}
@@ -0,0 +1,84 @@
+package models
+
+import "time"
+
+// PublicUser is what other users may see about an account
+type PublicUser struct {
+	ID          int64  `json:"id"`
+	Username    string `json:"username"`
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	DisplayName string `json:"display_name"`
+	Bio         string `json:"bio"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+}
+
+// MemberUser is a group-mate as other members see them, the email is left out unless their privacy settings share it
+type MemberUser struct {
+	PublicUser
+	Email string `json:"email,omitempty"`
+}
+
+// AdminUser adds the contact and account details admins need to manage a user
+type AdminUser struct {
+	PublicUser
+	Email               string     `json:"email,omitempty"`
+	Role                Role       `json:"role"`
+	CreatedAt           time.Time  `json:"created_at"`
+	EmailVerifiedAt     *time.Time `json:"email_verified_at"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at"`
+}
+
+// SelfUser is the account as its owner sees it
+type SelfUser struct {
+	AdminUser
+	PendingEmail *string `json:"pending_email"`
+	Timezone     string  `json:"timezone"`
+}
+
+func NewPublicUser(user *User) PublicUser {
+	return PublicUser{
+		ID:          user.ID,
+		Username:    user.Username,
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarURL:   user.AvatarURL(),
+	}
+}
+
+func NewMemberUser(user *User) MemberUser {
+	return MemberUser{PublicUser: NewPublicUser(user), Email: user.Email}
+}
+
+func NewAdminUser(user *User) AdminUser {
+	return AdminUser{
+		PublicUser:          NewPublicUser(user),
+		Email:               user.Email,
+		Role:                user.Role,
+		CreatedAt:           user.CreatedAt,
+		EmailVerifiedAt:     user.EmailVerifiedAt,
+		DeletionScheduledAt: user.DeletionScheduledAt,
+	}
+}
+
+func NewSelfUser(user *User) SelfUser {
+	return SelfUser{
+		AdminUser:    NewAdminUser(user),
+		PendingEmail: user.PendingEmail,
+		Timezone:     user.Timezone,
+	}
+}
+
+// UserView projects the user for a caller with the given view
+func UserView(user *User, view View) interface{} {
+	switch view {
+	case ViewSelf:
+		return NewSelfUser(user)
+	case ViewAdmin:
+		return NewAdminUser(user)
+	default:
+		return NewPublicUser(user)
+	}
+}
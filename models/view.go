@@ -0,0 +1,13 @@
+package models
+
+// View is how much of a resource the caller is allowed to see in a response
+type View int
+
+const (
+	// ViewPublic is for any signed in user
+	ViewPublic View = iota
+	// ViewSelf is for the user themselves, or a member of the group the resource belongs to
+	ViewSelf
+	// ViewAdmin is for a super admin, or an admin of the group the resource belongs to
+	ViewAdmin
+)
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Values no response may contain, planted in every field that holds a secret
+const (
+	secretPasswordHash = "secret-password-hash"
+	secretAvatarKey    = "avatars/secret-avatar-key"
+	secretPendingEmail = "secret-pending@example.com"
+	secretTOTP         = "SECRETTOTPSEED"
+	secretTokenHash    = "secret-token-hash"
+	secretGroupCode    = "SECRETJOINCODE"
+)
+
+// Keys that would mean a secret made it into a response
+var forbiddenKeys = []string{"password_hash", "avatar_key", "secret", "totp_secret", "token_hash", "code_hash", "refresh_token_hash", "public_key", "sign_count", "last_used_step"}
+
+func testUser() *User {
+	now := time.Now()
+	avatarKey, pendingEmail := secretAvatarKey, secretPendingEmail
+	return &User{
+		ID:                  1,
+		FirstName:           "Ada",
+		LastName:            "Lovelace",
+		Username:            "ada",
+		Email:               "ada@example.com",
+		PasswordHash:        []byte(secretPasswordHash),
+		CreatedAt:           now,
+		Role:                SuperAdmin,
+		EmailVerifiedAt:     &now,
+		PendingEmail:        &pendingEmail,
+		DeletionScheduledAt: &now,
+		DisplayName:         "Ada",
+		Bio:                 "Analyst",
+		Timezone:            "Europe/London",
+		AvatarKey:           &avatarKey,
+		AvatarUpdatedAt:     &now,
+	}
+}
+
+func testGroup() *Group {
+	return &Group{ID: 10, Name: "Engines", CreatedByID: 1, CreatedAt: time.Now(), Code: secretGroupCode, DoSendEmails: true}
+}
+
+func testEvent() *Event {
+	now := time.Now()
+	return &Event{ID: 100, GroupID: 10, Name: "Demo", Description: "Notes", StartTime: now, EndTime: now, CreatedByID: 1, CreatedAt: now, Location: "London"}
+}
+
+// encodedKeys marshals the value and returns every object key in it, at any depth
+func encodedKeys(t *testing.T, value interface{}) (string, []string) {
+	t.Helper()
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+
+	var keys []string
+	var walk func(interface{})
+	walk = func(node interface{}) {
+		switch node := node.(type) {
+		case map[string]interface{}:
+			for key, child := range node {
+				keys = append(keys, key)
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range node {
+				walk(child)
+			}
+		}
+	}
+	walk(decoded)
+
+	slices.Sort(keys)
+	return string(encoded), keys
+}
+
+func checkNoSecrets(t *testing.T, encoded string, keys []string, allowedSecrets ...string) {
+	t.Helper()
+
+	for _, key := range keys {
+		if slices.Contains(forbiddenKeys, key) {
+			t.Errorf("encoded %q: %s", key, encoded)
+		}
+	}
+	for _, secret := range []string{secretPasswordHash, secretAvatarKey, secretPendingEmail, secretTOTP, secretTokenHash, secretGroupCode} {
+		if strings.Contains(encoded, secret) && !slices.Contains(allowedSecrets, secret) {
+			t.Errorf("encoded %q: %s", secret, encoded)
+		}
+	}
+}
+
+// Every view lists its keys exactly, so a field added to a view fails here until it is added on purpose
+func TestViewsEncodeOnlyTheirFields(t *testing.T) {
+	publicUserKeys := []string{"avatar_url", "bio", "display_name", "first_name", "id", "last_name", "username"}
+	adminUserKeys := append([]string{"created_at", "deletion_scheduled_at", "email", "email_verified_at", "role"}, publicUserKeys...)
+	publicGroupKeys := []string{"id", "name"}
+	memberGroupKeys := append([]string{"created_at", "created_by_id", "do_send_emails"}, publicGroupKeys...)
+	publicEventKeys := []string{"end_time", "group_id", "id", "location", "name", "start_time"}
+	memberEventKeys := append([]string{"created_at", "created_by_id", "description"}, publicEventKeys...)
+
+	tests := []struct {
+		name           string
+		value          interface{}
+		wantKeys       []string
+		allowedSecrets []string
+	}{
+		{"public user", UserView(testUser(), ViewPublic), publicUserKeys, nil},
+		{"member user", NewMemberUser(testUser()), append([]string{"email"}, publicUserKeys...), nil},
+		{"admin user", UserView(testUser(), ViewAdmin), adminUserKeys, nil},
+		{"self user", UserView(testUser(), ViewSelf), append([]string{"pending_email", "timezone"}, adminUserKeys...), []string{secretPendingEmail}},
+		{"public group", GroupView(testGroup(), ViewPublic), publicGroupKeys, nil},
+		{"member group", GroupView(testGroup(), ViewSelf), memberGroupKeys, nil},
+		{"admin group", GroupView(testGroup(), ViewAdmin), append([]string{"code"}, memberGroupKeys...), []string{secretGroupCode}},
+		{"public event", EventView(testEvent(), ViewPublic), publicEventKeys, nil},
+		{"member event", EventView(testEvent(), ViewSelf), memberEventKeys, nil},
+		{"admin event", EventView(testEvent(), ViewAdmin), memberEventKeys, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded, keys := encodedKeys(t, test.value)
+			checkNoSecrets(t, encoded, keys, test.allowedSecrets...)
+
+			slices.Sort(test.wantKeys)
+			if !slices.Equal(keys, test.wantKeys) {
+				t.Errorf("keys = %v, want %v", keys, test.wantKeys)
+			}
+		})
+	}
+}
+
+// Handlers encode these records as they are, so their secrets must be kept out by the json tags
+func TestRecordsEncodeWithoutSecrets(t *testing.T) {
+	now := time.Now()
+	step := int64(42)
+
+	tests := []struct {
+		name  string
+		value interface{}
+	}{
+		{"user", testUser()},
+		{"totp", UserTOTP{UserID: 1, Secret: secretTOTP, LastUsedStep: &step, CreatedAt: now, ConfirmedAt: &now}},
+		{"two factor challenge", TwoFactorChallenge{TokenHash: secretTokenHash, UserID: 1, CreatedAt: now, ExpiresAt: now}},
+		{"personal access token", PersonalAccessToken{ID: 1, UserID: 1, Name: "ci", TokenHash: secretTokenHash, GroupIDs: []int64{10}, CreatedAt: now}},
+		{"session", Session{ID: "session", UserID: 1, RefreshTokenHash: secretTokenHash, CreatedAt: now, LastUsedAt: now, ExpiresAt: now}},
+		{"passkey", WebAuthnCredential{ID: 1, UserID: 1, CredentialID: Base64URL("credential"), PublicKey: []byte(secretTokenHash), SignCount: 7, Name: "Laptop", CreatedAt: now}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded, keys := encodedKeys(t, test.value)
+			checkNoSecrets(t, encoded, keys, secretPendingEmail)
+		})
+	}
+}
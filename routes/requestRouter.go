@@ -4,6 +4,7 @@ import (
 	"nest/handlers"
 	"nest/middleware"
 	"nest/models"
+	"nest/utils"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
@@ -15,69 +16,148 @@ func RegisterRoutes() http.Handler {
 	r.Use(middleware.CORSMiddleware)
 	r.Use(middleware.LoggingMiddleware)
 
+	r.Get("/.well-known/jwks.json", handlers.GetJWKS)
+
 	r.Route("/api", func(r chi.Router) {
+		r.Get("/jwks", handlers.GetJWKS)
 		r.Post("/user/login", handlers.Login)
+		r.Post("/user/login/2fa", handlers.VerifyTwoFactorLogin)
+		r.Post("/user/login/magic-link", handlers.RequestMagicLink)
+		r.Post("/user/login/magic-link/verify", handlers.VerifyMagicLink)
+		r.Get("/oidc/providers", handlers.GetOIDCProviders)
+		r.Post("/user/login/oidc/{provider}", handlers.StartOIDCLogin)
+		r.Post("/user/login/oidc/{provider}/callback", handlers.CompleteOIDCLogin)
+		r.Post("/user/login/passkey/begin", handlers.BeginPasskeyLogin)
+		r.Post("/user/login/passkey/finish", handlers.FinishPasskeyLogin)
 		r.Post("/user/register", handlers.Register)
+		r.Post("/user/email/verify", handlers.VerifyEmail)
+		r.Post("/user/email/revert", handlers.RevertEmailChange)
+		r.Get("/invitation/lookup", handlers.LookupInvitation)
+		r.Post("/user/refresh", handlers.RefreshToken)
 		r.Post("/user/reset-password", handlers.GeneratePasswordResetCode)
 		r.Post("/user/reset-password/verify", handlers.VerifyPasswordResetCode)
 		r.Post("/user/reset-password/confirm", handlers.ResetPassword)
 
 		// JWT required routes
-		r.With(middleware.JWTAuthMiddleware).Group(func(r chi.Router) {
-			// User
-			r.Get("/user/{id}", handlers.GetUser)
-			r.Get("/user/{id}/info", handlers.GetUserInfo)
-			r.Get("/user/{id}/event", handlers.GetAllEventsForUser)
-
-			r.Delete("/user/{id}", handlers.DeleteUser)
-
-			r.Patch("/user/{id}", handlers.UpdateUser)
-			r.Patch("/user/{id}/email", handlers.UpdateUserEmail)
-			r.Patch("/user/{id}/firstname", handlers.UpdateUserFirstName)
-			r.Patch("/user/{id}/lastname", handlers.UpdateUserLastName)
-
-			// Group
-			r.Get("/group/{id}", handlers.GetGroup)
-			r.Get("/group/{id}/user", handlers.GetAllMembersInGroup)
-			r.Get("/group/{id}/non-members", handlers.GetAllNonMembersInGroup)
-			r.Get("/group/{id}/non-admins", handlers.GetAllNonAdminMembersInGroup)
-			r.Get("/group/{id}/admins", handlers.GetAllAdminMembersInGroup)
-			r.Get("/group/{id}/event", handlers.GetAllEventsForGroup)
-			r.Get("/group/user/{id}", handlers.GetAllGroupsForUser)
-
-			r.Post("/group", handlers.CreateGroup)
-			r.Post("/group/{id}/user/{user_id}", handlers.AddUserToGroup)
-			r.Post("/group/join/{group_code}", handlers.JoinGroup)
-
-			r.Patch("/group/{id}/name", handlers.UpdateGroupName)
-			r.Patch("/group/{id}/do-send-emails", handlers.UpdateGroupDoSendEmails)
-
-			r.Delete("/group/{id}/user/{user_id}", handlers.RemoveUserFromGroup)
-			r.Delete("/group/{id}/user", handlers.LeaveGroup)
-			r.Delete("/group/{id}", handlers.DeleteGroup)
-
-			// Event
-			r.Get("/event/{id}", handlers.GetEvent)
-			r.Get("/event/{id}/reaction", handlers.GetReactionsByEvent)
-			r.Get("/event/{id}/attendance", handlers.GetEventAttendance)
-
-			r.Post("/event", handlers.CreateEvent)
-			r.Post("/event/reaction", handlers.ReactToEvent)
-			r.Post("/event/attendance", handlers.UpdateEventAttendance)
-
-			r.Patch("/event/{id}/name", handlers.UpdateEventName)
-			r.Patch("/event/{id}/description", handlers.UpdateEventDescription)
-			r.Patch("/event/{id}/start", handlers.UpdateEventStartTime)
-			r.Patch("/event/{id}/end", handlers.UpdateEventEndTime)
-			r.Patch("/event/{id}", handlers.UpdateEvent)
-
-			r.Delete("/event/{id}", handlers.DeleteEvent)
-			r.Delete("/event/reaction", handlers.UnreactToEvent)
-
-			// SA endpoints
-			r.With(middleware.RoleMiddleware(models.SuperAdmin)).Patch("/group/{id}/admin/add/{user_id}", handlers.AddGroupAdmin)
-			r.With(middleware.RoleMiddleware(models.SuperAdmin)).Patch("/group/{id}/admin/remove/{user_id}", handlers.RemoveGroupAdmin)
-			r.With(middleware.RoleMiddleware(models.SuperAdmin)).Get("/group/all", handlers.GetAllGroups)
+		r.With(middleware.JWTAuthMiddleware, middleware.CSRFMiddleware).Group(func(r chi.Router) {
+			// Personal access tokens can't manage the account's credentials
+			r.With(middleware.SessionOnlyMiddleware).Group(func(r chi.Router) {
+				r.Post("/user/logout", handlers.Logout)
+
+				// An SA acting as someone else can't touch their credentials
+				r.With(middleware.NoImpersonationMiddleware).Group(func(r chi.Router) {
+					r.Post("/user/logout/all", handlers.LogoutAllDevices)
+
+					// Two-factor enrollment stays reachable for accounts that are required to enroll
+					r.Get("/user/2fa", handlers.GetTwoFactorStatus)
+					r.Post("/user/2fa/enroll", handlers.BeginTwoFactorEnrollment)
+					r.Post("/user/2fa/confirm", handlers.ConfirmTwoFactorEnrollment)
+					r.Post("/user/2fa/recovery-codes", handlers.RegenerateRecoveryCodes)
+					r.Delete("/user/2fa", handlers.DisableTwoFactor)
+				})
+			})
+
+			r.With(middleware.TwoFactorEnrollmentMiddleware).Group(func(r chi.Router) {
+				// User
+				r.With(middleware.PolicyMiddleware(utils.ActionUserRead)).Get("/user/{id}", handlers.GetUser)
+				r.Get("/user/{id}/info", handlers.GetUserInfo)
+				r.Get("/user/{id}/avatar", handlers.GetUserAvatar)
+				r.With(middleware.PolicyMiddleware(utils.ActionUserEventsList)).Get("/user/{id}/event", handlers.GetAllEventsForUser)
+
+				r.With(middleware.SessionOnlyMiddleware, middleware.NoImpersonationMiddleware, middleware.PolicyMiddleware(utils.ActionUserDelete)).Delete("/user/{id}", handlers.DeleteUser)
+				r.With(middleware.SessionOnlyMiddleware, middleware.NoImpersonationMiddleware, middleware.PolicyMiddleware(utils.ActionUserDelete)).Delete("/user/{id}/deletion", handlers.CancelUserDeletion)
+				r.With(middleware.SessionOnlyMiddleware, middleware.NoImpersonationMiddleware, middleware.PolicyMiddleware(utils.ActionUserExport)).Get("/user/{id}/export", handlers.ExportUserData)
+
+				r.Post("/user/email/resend", handlers.ResendEmailVerification)
+
+				r.With(middleware.SessionOnlyMiddleware, middleware.NoImpersonationMiddleware, middleware.PolicyMiddleware(utils.ActionUserUpdate)).Patch("/user/{id}", handlers.UpdateUser)
+				r.With(middleware.SessionOnlyMiddleware, middleware.NoImpersonationMiddleware, middleware.PolicyMiddleware(utils.ActionUserUpdate)).Patch("/user/{id}/email", handlers.UpdateUserEmail)
+				r.With(middleware.SessionOnlyMiddleware, middleware.NoImpersonationMiddleware, middleware.PolicyMiddleware(utils.ActionUserUpdate)).Patch("/user/{id}/firstname", handlers.UpdateUserFirstName)
+				r.With(middleware.SessionOnlyMiddleware, middleware.NoImpersonationMiddleware, middleware.PolicyMiddleware(utils.ActionUserUpdate)).Patch("/user/{id}/lastname", handlers.UpdateUserLastName)
+				r.With(middleware.PolicyMiddleware(utils.ActionUserRead)).Get("/user/{id}/privacy", handlers.GetPrivacySettings)
+				r.With(middleware.SessionOnlyMiddleware, middleware.NoImpersonationMiddleware, middleware.PolicyMiddleware(utils.ActionUserUpdate)).Patch("/user/{id}/privacy", handlers.UpdatePrivacySettings)
+				r.With(middleware.SessionOnlyMiddleware, middleware.NoImpersonationMiddleware, middleware.PolicyMiddleware(utils.ActionUserUpdate)).Patch("/user/{id}/profile", handlers.UpdateUserProfile)
+				r.With(middleware.SessionOnlyMiddleware, middleware.NoImpersonationMiddleware, middleware.PolicyMiddleware(utils.ActionUserUpdate)).Put("/user/{id}/avatar", handlers.UploadUserAvatar)
+				r.With(middleware.SessionOnlyMiddleware, middleware.NoImpersonationMiddleware, middleware.PolicyMiddleware(utils.ActionUserUpdate)).Delete("/user/{id}/avatar", handlers.DeleteUserAvatar)
+				r.With(middleware.SessionOnlyMiddleware, middleware.NoImpersonationMiddleware, middleware.PolicyMiddleware(utils.ActionUserPasswordChange)).Patch("/user/{id}/password", handlers.ChangePassword)
+
+				// Personal access tokens
+				r.With(middleware.SessionOnlyMiddleware, middleware.NoImpersonationMiddleware).Get("/user/token", handlers.GetPersonalAccessTokens)
+				r.With(middleware.SessionOnlyMiddleware, middleware.NoImpersonationMiddleware).Post("/user/token", handlers.CreatePersonalAccessToken)
+				r.With(middleware.SessionOnlyMiddleware, middleware.NoImpersonationMiddleware).Delete("/user/token/{id}", handlers.RevokePersonalAccessToken)
+
+				// Passkeys
+				r.With(middleware.SessionOnlyMiddleware, middleware.NoImpersonationMiddleware).Get("/user/passkey", handlers.GetPasskeys)
+				r.With(middleware.SessionOnlyMiddleware, middleware.NoImpersonationMiddleware).Post("/user/passkey/register/begin", handlers.BeginPasskeyRegistration)
+				r.With(middleware.SessionOnlyMiddleware, middleware.NoImpersonationMiddleware).Post("/user/passkey/register/finish", handlers.FinishPasskeyRegistration)
+				r.With(middleware.SessionOnlyMiddleware, middleware.NoImpersonationMiddleware).Delete("/user/passkey/{id}", handlers.DeletePasskey)
+
+				// Group
+				r.With(middleware.PolicyMiddleware(utils.ActionGroupRead)).Get("/group/{id}", handlers.GetGroup)
+				r.With(middleware.PolicyMiddleware(utils.ActionGroupMembersList)).Get("/group/{id}/user", handlers.GetAllMembersInGroup)
+				r.With(middleware.PolicyMiddleware(utils.ActionGroupMembersManage)).Get("/group/{id}/non-members", handlers.GetAllNonMembersInGroup)
+				r.With(middleware.PolicyMiddleware(utils.ActionGroupMembersManage)).Get("/group/{id}/non-admins", handlers.GetAllNonAdminMembersInGroup)
+				r.With(middleware.PolicyMiddleware(utils.ActionGroupMembersList)).Get("/group/{id}/admins", handlers.GetAllAdminMembersInGroup)
+				r.With(middleware.PolicyMiddleware(utils.ActionGroupEventsList)).Get("/group/{id}/event", handlers.GetAllEventsForGroup)
+				r.With(middleware.PolicyMiddleware(utils.ActionUserGroupsList)).Get("/group/user/{id}", handlers.GetAllGroupsForUser)
+
+				r.Post("/group", handlers.CreateGroup)
+				r.With(middleware.PolicyMiddleware(utils.ActionGroupMembersManage)).Post("/group/{id}/user/{user_id}", handlers.AddUserToGroup)
+				r.Post("/group/join/{group_code}", handlers.JoinGroup)
+
+				r.With(middleware.PolicyMiddleware(utils.ActionGroupUpdate)).Patch("/group/{id}/name", handlers.UpdateGroupName)
+				r.With(middleware.PolicyMiddleware(utils.ActionGroupUpdate)).Patch("/group/{id}/do-send-emails", handlers.UpdateGroupDoSendEmails)
+
+				r.With(middleware.NoImpersonationMiddleware, middleware.PolicyMiddleware(utils.ActionGroupMembersManage)).Delete("/group/{id}/user/{user_id}", handlers.RemoveUserFromGroup)
+				r.With(middleware.NoImpersonationMiddleware, middleware.PolicyMiddleware(utils.ActionGroupLeave)).Delete("/group/{id}/user", handlers.LeaveGroup)
+				r.With(middleware.NoImpersonationMiddleware, middleware.PolicyMiddleware(utils.ActionGroupDelete)).Delete("/group/{id}", handlers.DeleteGroup)
+
+				// Event
+				r.With(middleware.PolicyMiddleware(utils.ActionEventRead)).Get("/event/{id}", handlers.GetEvent)
+				r.With(middleware.PolicyMiddleware(utils.ActionEventReactionsList)).Get("/event/{id}/reaction", handlers.GetReactionsByEvent)
+				r.With(middleware.PolicyMiddleware(utils.ActionEventAttendanceList)).Get("/event/{id}/attendance", handlers.GetEventAttendance)
+
+				r.Post("/event", handlers.CreateEvent)
+				r.Post("/event/reaction", handlers.ReactToEvent)
+				r.Post("/event/attendance", handlers.UpdateEventAttendance)
+
+				r.With(middleware.PolicyMiddleware(utils.ActionEventUpdate)).Patch("/event/{id}/name", handlers.UpdateEventName)
+				r.With(middleware.PolicyMiddleware(utils.ActionEventUpdate)).Patch("/event/{id}/description", handlers.UpdateEventDescription)
+				r.With(middleware.PolicyMiddleware(utils.ActionEventUpdate)).Patch("/event/{id}/start", handlers.UpdateEventStartTime)
+				r.With(middleware.PolicyMiddleware(utils.ActionEventUpdate)).Patch("/event/{id}/end", handlers.UpdateEventEndTime)
+				r.With(middleware.PolicyMiddleware(utils.ActionEventUpdate)).Patch("/event/{id}", handlers.UpdateEvent)
+
+				r.With(middleware.NoImpersonationMiddleware, middleware.PolicyMiddleware(utils.ActionEventDelete)).Delete("/event/{id}", handlers.DeleteEvent)
+				r.Delete("/event/reaction", handlers.UnreactToEvent)
+
+				// Invitation
+				r.With(middleware.PolicyMiddleware(utils.ActionGroupInvitationsManage)).Get("/group/{id}/invitation", handlers.GetInvitationsForGroup)
+
+				// Audit log
+				r.With(middleware.PolicyMiddleware(utils.ActionGroupAuditList)).Get("/group/{id}/audit", handlers.GetGroupAuditEvents)
+
+				r.Post("/invitation", handlers.CreateInvitation)
+
+				r.With(middleware.NoImpersonationMiddleware).Delete("/invitation/{id}", handlers.RevokeInvitation)
+
+				// SA endpoints
+				r.With(middleware.RoleMiddleware(models.SuperAdmin)).Patch("/group/{id}/admin/add/{user_id}", handlers.AddGroupAdmin)
+				r.With(middleware.RoleMiddleware(models.SuperAdmin)).Patch("/group/{id}/admin/remove/{user_id}", handlers.RemoveGroupAdmin)
+				r.With(middleware.RoleMiddleware(models.SuperAdmin)).Get("/group/all", handlers.GetAllGroups)
+				r.With(middleware.RoleMiddleware(models.SuperAdmin)).Get("/user/locked", handlers.GetLockedUsers)
+				r.With(middleware.RoleMiddleware(models.SuperAdmin)).Patch("/user/{id}/unlock", handlers.UnlockUser)
+				r.With(middleware.RoleMiddleware(models.SuperAdmin)).Get("/user", handlers.SearchUsers)
+				r.With(middleware.RoleMiddleware(models.SuperAdmin)).Patch("/user/{id}/role", handlers.UpdateUserRole)
+				r.With(middleware.RoleMiddleware(models.SuperAdmin)).Patch("/user/{id}/disable", handlers.DisableUser)
+				r.With(middleware.RoleMiddleware(models.SuperAdmin)).Patch("/user/{id}/enable", handlers.EnableUser)
+				r.With(middleware.RoleMiddleware(models.SuperAdmin)).Post("/user/{id}/force-password-reset", handlers.ForcePasswordReset)
+				r.With(middleware.RoleMiddleware(models.SuperAdmin), middleware.SessionOnlyMiddleware).Post("/user/{id}/impersonate", handlers.StartImpersonation)
+				r.With(middleware.RoleMiddleware(models.SuperAdmin)).Get("/invitation", handlers.GetAllInvitations)
+				r.With(middleware.RoleMiddleware(models.SuperAdmin)).Get("/audit", handlers.GetAuditEvents)
+				r.With(middleware.RoleMiddleware(models.SuperAdmin)).Get("/settings", handlers.GetSettings)
+				r.With(middleware.RoleMiddleware(models.SuperAdmin)).Patch("/settings/require-two-factor", handlers.UpdateRequireTwoFactor)
+				r.With(middleware.RoleMiddleware(models.SuperAdmin)).Patch("/settings/magic-link-login", handlers.UpdateMagicLinkLogin)
+			})
 		})
 	})
 
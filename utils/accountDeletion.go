@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"log"
+	"nest/db"
+	"nest/helpers"
+	"nest/models"
+	"time"
+)
+
+// How long a user has to change their mind after asking for their account to be deleted
+const AccountDeletionGracePeriod = 14 * 24 * time.Hour
+
+// PurgeScheduledDeletions anonymizes every account whose deletion grace period has ended
+func PurgeScheduledDeletions(ctx context.Context) {
+	userIDs, err := db.GetUsersDueForPurge(ctx)
+	if err != nil {
+		log.Printf("ERROR: Failed to list accounts due for deletion: %v", err)
+		return
+	}
+
+	for _, userID := range userIDs {
+		if err := purgeUser(ctx, userID); err != nil {
+			if errors.Is(err, db.ErrNoDeletionScheduled) {
+				log.Printf("INFO: Deletion of user %d was cancelled before it ran", userID)
+				continue
+			}
+			log.Printf("ERROR: Failed to purge user %d: %v", userID, err)
+			continue
+		}
+		log.Printf("INFO: Purged user %d after the deletion grace period", userID)
+	}
+}
+
+func purgeUser(ctx context.Context, userID int) error {
+	// Nobody knows this password, so the placeholder account can never be signed in to
+	unusablePassword, err := helpers.GenerateRandomString(48)
+	if err != nil {
+		return err
+	}
+	unusableHash, err := HashPassword(unusablePassword)
+	if err != nil {
+		return err
+	}
+
+	user, err := db.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := db.PurgeUser(ctx, userID, unusableHash); err != nil {
+		return err
+	}
+	InvalidatePrincipal(userID)
+
+	if user.AvatarKey != nil {
+		if err := Storage.Delete(ctx, *user.AvatarKey); err != nil {
+			log.Printf("ERROR: Failed to delete avatar of purged user %d: %v", userID, err)
+		}
+	}
+
+	WriteAuditEvent(ctx, &models.AuditEvent{
+		Action:     AuditUserPurge,
+		TargetType: AuditTargetUser,
+		TargetID:   optionalID(userID),
+	})
+	return nil
+}
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"nest/db"
+	"nest/helpers"
+	"nest/models"
+	"net/http"
+)
+
+// Audit actions, in the same "<resource>:<verb>" form as policy actions
+const (
+	AuditGroupCreate       = "group:create"
+	AuditGroupUpdate       = "group:update"
+	AuditGroupDelete       = "group:delete"
+	AuditGroupJoin         = "group:join"
+	AuditGroupLeave        = "group:leave"
+	AuditGroupMemberAdd    = "group:member:add"
+	AuditGroupMemberRemove = "group:member:remove"
+	AuditGroupAdminAdd     = "group:admin:add"
+	AuditGroupAdminRemove  = "group:admin:remove"
+
+	AuditUserUpdate             = "user:update"
+	AuditUserDelete             = "user:delete"
+	AuditUserDeleteCancel       = "user:delete:cancel"
+	AuditUserPurge              = "user:purge"
+	AuditUserEmailChange        = "user:email:change"
+	AuditUserPasswordChange     = "user:password:change"
+	AuditUserRoleChange         = "user:role:change"
+	AuditUserDisable            = "user:disable"
+	AuditUserEnable             = "user:enable"
+	AuditUserUnlock             = "user:unlock"
+	AuditUserForcePasswordReset = "user:password:force-reset"
+	AuditUserPasskeyAdd         = "user:passkey:add"
+	AuditUserPasskeyRemove      = "user:passkey:remove"
+	AuditUserPrivacyChange      = "user:privacy:change"
+
+	AuditEventUpdate = "event:update"
+	AuditEventDelete = "event:delete"
+
+	AuditImpersonationStart   = "impersonation:start"
+	AuditImpersonationRequest = "impersonation:request"
+)
+
+const (
+	AuditTargetUser  = "user"
+	AuditTargetGroup = "group"
+	AuditTargetEvent = "event"
+)
+
+// AuditEntry describes a privileged or destructive action, zero IDs and nil snapshots are stored as NULL
+type AuditEntry struct {
+	Action     string
+	TargetType string
+	TargetID   int
+	GroupID    int
+	Before     interface{}
+	After      interface{}
+	Metadata   interface{}
+}
+
+// RecordAudit stores an audit event for the authenticated caller, logging rather than failing the request if it can't be written
+func RecordAudit(r *http.Request, entry AuditEntry) {
+	event := models.AuditEvent{
+		Action:     entry.Action,
+		TargetType: entry.TargetType,
+		TargetID:   optionalID(entry.TargetID),
+		GroupID:    optionalID(entry.GroupID),
+		Before:     marshalSnapshot(entry.Before),
+		After:      marshalSnapshot(entry.After),
+		Metadata:   marshalSnapshot(entry.Metadata),
+		IP:         helpers.GetClientIP(r),
+		UserAgent:  r.UserAgent(),
+	}
+
+	if userID, ok := r.Context().Value("user_id").(int); ok {
+		event.ActorID = optionalID(userID)
+	}
+	if impersonatorID, ok := r.Context().Value("impersonator_id").(int); ok {
+		event.ImpersonatorID = optionalID(impersonatorID)
+	}
+
+	WriteAuditEvent(r.Context(), &event)
+}
+
+// WriteAuditEvent stores a fully built audit event
+func WriteAuditEvent(ctx context.Context, event *models.AuditEvent) {
+	if err := db.CreateAuditEvent(ctx, event); err != nil {
+		log.Printf("ERROR: Failed to write audit event %s for %s %v: %v", event.Action, event.TargetType, event.TargetID, err)
+	}
+}
+
+func optionalID(id int) *int64 {
+	if id == 0 {
+		return nil
+	}
+	value := int64(id)
+	return &value
+}
+
+func marshalSnapshot(snapshot interface{}) json.RawMessage {
+	if snapshot == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal audit snapshot: %v", err)
+		return nil
+	}
+	return data
+}
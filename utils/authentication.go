@@ -1,105 +1,24 @@
 package utils
 
 import (
-	"log"
-	"nest/db"
 	"nest/models"
 	"net/http"
 )
 
-func IsSelfOrSA(r *http.Request, userID int) bool {
-	role := r.Context().Value("role").(string)
-	authenticatedUserID := r.Context().Value("user_id").(int)
-
-	if userID != authenticatedUserID && role != string(models.SuperAdmin) {
-		return false
-	}
-
-	return true
-}
-
 func IsSA(r *http.Request) bool {
 	role := r.Context().Value("role").(string)
 
-	return role == string(models.SuperAdmin)
-}
-
-func IsGroupAdminOrSA(r *http.Request, groupID int) bool {
-	role := r.Context().Value("role").(string)
-	authenticatedUserID := r.Context().Value("user_id").(int)
-
-	if role == string(models.SuperAdmin) {
-		return true
-	}
-
-	isGroupAdmin, err := db.IsUserGroupAdmin(r.Context(), authenticatedUserID, groupID)
-	if err != nil {
-		return false
-	}
-
-	if role != string(models.SuperAdmin) && !isGroupAdmin {
-		return false
-	}
-
-	return true
-}
-
-func IsEventCreatorOrGroupMemberOrSA(r *http.Request, eventID int) bool {
-	role := r.Context().Value("role").(string)
-	authenticatedUserID := r.Context().Value("user_id").(int)
-
-	event, err := db.GetEventByID(r.Context(), eventID)
-	if err != nil {
-		return false
-	}
-
-	isGroupMember, err := db.IsUserGroupMember(r.Context(), authenticatedUserID, int(event.GroupID))
-	if err != nil {
-		return false
-	}
-
-	if role != string(models.SuperAdmin) && !isGroupMember && event.CreatedByID != int64(authenticatedUserID) {
-		return false
-	}
-
-	return true
+	return role == string(models.SuperAdmin) && !IsGroupScopedToken(r)
 }
 
-func IsEventCreatorOrGroupAdminOrSA(r *http.Request, eventID int) bool {
-	role := r.Context().Value("role").(string)
-	authenticatedUserID := r.Context().Value("user_id").(int)
-
-	event, err := db.GetEventByID(r.Context(), eventID)
-	if err != nil {
-		return false
-	}
-
-	isGroupAdmin, err := db.IsUserGroupAdmin(r.Context(), authenticatedUserID, int(event.GroupID))
-	if err != nil {
-		log.Println(err)
-		return false
-	}
-
-	if role != string(models.SuperAdmin) && !isGroupAdmin && event.CreatedByID != int64(authenticatedUserID) {
-		return false
-	}
-
-	return true
+// TokenAllowsGroup reports whether the request's personal access token, if any, is scoped to include the group
+func TokenAllowsGroup(r *http.Request, groupID int) bool {
+	scope, ok := r.Context().Value("token_scope").(*models.TokenScope)
+	return !ok || scope.AllowsGroup(int64(groupID))
 }
 
-func IsGroupMemberOrSA(r *http.Request, groupID int) bool {
-	role := r.Context().Value("role").(string)
-	authenticatedUserID := r.Context().Value("user_id").(int)
-
-	isGroupMember, err := db.IsUserGroupMember(r.Context(), authenticatedUserID, groupID)
-	if err != nil {
-		log.Println(err)
-		return false
-	}
-
-	if role != string(models.SuperAdmin) && !isGroupMember {
-		return false
-	}
-
-	return true
+// IsGroupScopedToken reports whether the request uses a personal access token limited to specific groups
+func IsGroupScopedToken(r *http.Request) bool {
+	scope, ok := r.Context().Value("token_scope").(*models.TokenScope)
+	return ok && len(scope.GroupIDs) > 0
 }
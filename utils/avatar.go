@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+
+	// Formats accepted for upload
+	_ "image/gif"
+	_ "image/png"
+)
+
+const (
+	// MaxAvatarUploadSize caps the size of the uploaded file
+	MaxAvatarUploadSize = 5 << 20
+	// AvatarSize is the width and height of stored avatars
+	AvatarSize = 256
+	// Larger images are refused before decoding so a small file can't expand into a huge bitmap
+	maxAvatarSourcePixels = 25_000_000
+	avatarJPEGQuality     = 85
+)
+
+var ErrInvalidAvatar = errors.New("avatar must be a JPEG, PNG or GIF image")
+
+// ProcessAvatar decodes an uploaded image, crops it to a centered square, scales it down to AvatarSize
+// and re-encodes it as JPEG, which also drops any metadata the original carried
+func ProcessAvatar(upload io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(upload, MaxAvatarUploadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxAvatarUploadSize {
+		return nil, fmt.Errorf("avatar must be smaller than %d MB", MaxAvatarUploadSize>>20)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidAvatar
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxAvatarSourcePixels {
+		return nil, errors.New("avatar dimensions are too large")
+	}
+
+	source, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidAvatar
+	}
+
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, resizeSquare(source, AvatarSize), &jpeg.Options{Quality: avatarJPEGQuality}); err != nil {
+		return nil, fmt.Errorf("failed to encode avatar: %w", err)
+	}
+	return encoded.Bytes(), nil
+}
+
+// resizeSquare crops the centre square of the image and box-filters it down to at most size pixels a side.
+// Transparent areas come out white since JPEG has no alpha channel.
+func resizeSquare(source image.Image, size int) *image.RGBA {
+	bounds := source.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	left := bounds.Min.X + (bounds.Dx()-side)/2
+	top := bounds.Min.Y + (bounds.Dy()-side)/2
+
+	// Small images are kept at their own size rather than blown up
+	size = min(size, side)
+	resized := image.NewRGBA(image.Rect(0, 0, size, size))
+
+	for y := 0; y < size; y++ {
+		y0, y1 := top+y*side/size, top+(y+1)*side/size
+		for x := 0; x < size; x++ {
+			x0, x1 := left+x*side/size, left+(x+1)*side/size
+
+			var r, g, b, a, count uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := source.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					count++
+				}
+			}
+
+			// Colors are alpha-premultiplied, so adding the missing alpha as white flattens onto a white background
+			white := count*0xffff - a
+			resized.SetRGBA(x, y, color.RGBA{
+				R: uint8((r + white) / count >> 8),
+				G: uint8((g + white) / count >> 8),
+				B: uint8((b + white) / count >> 8),
+				A: 0xff,
+			})
+		}
+	}
+
+	return resized
+}
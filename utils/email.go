@@ -8,6 +8,9 @@ import (
 	"os"
 )
 
+// AppURL is the public address of the web UI, used when building links in emails
+const AppURL = "https://uccelli.budgeeapp.com"
+
 func SendEmail(to string, subject string, body string) error {
 	from := os.Getenv("SMTP_ADDRESS")
 	password := os.Getenv("SMTP_PASSWORD")
@@ -30,13 +33,13 @@ func SendEmail(to string, subject string, body string) error {
 }
 
 func NotifyAllUsersInGroup(groupID int, subject string, body string) {
-	users, err := db.GetAllMembersForGroup(context.Background(), groupID)
+	emails, err := db.GetVerifiedEmailsForGroup(context.Background(), groupID)
 	if err != nil {
 		log.Printf("ERROR: Failed to get users for group %d: %v", groupID, err)
 		return
 	}
 
-	for _, user := range users {
+	for _, email := range emails {
 		go func(email string) {
 			defer func() {
 				if r := recover(); r != nil {
@@ -44,7 +47,7 @@ func NotifyAllUsersInGroup(groupID int, subject string, body string) {
 				}
 			}()
 			NotifyUser(email, subject, body)
-		}(user.Email)
+		}(email)
 	}
 }
 
@@ -0,0 +1,249 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"nest/models"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// legacyKeyID names the JWT_SECRET key, which also verifies tokens issued before key IDs were added
+const legacyKeyID = "default"
+
+type jwtKey struct {
+	id     string
+	method jwt.SigningMethod
+	// Nil for keys that are only kept to verify tokens signed before a rotation
+	signingKey   interface{}
+	verifyingKey interface{}
+}
+
+var (
+	keyRingMu     sync.RWMutex
+	keyRing       map[string]*jwtKey
+	activeKey     *jwtKey
+	keyRingLoaded bool
+)
+
+// InitKeyRing loads the JWT keys from the environment.
+//
+// JWT_SECRET is an HS256 key with the ID "default". JWT_KEYS_DIR may hold more keys named by their ID:
+// "<kid>.pem" for RSA (RS256) or Ed25519 (EdDSA) private or public keys, and "<kid>.hmac" for HS256 secrets.
+// JWT_SIGNING_KID picks the key new tokens are signed with, every other key is only used for verification.
+func InitKeyRing() error {
+	keys := make(map[string]*jwtKey)
+
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		keys[legacyKeyID] = &jwtKey{
+			id:           legacyKeyID,
+			method:       jwt.SigningMethodHS256,
+			signingKey:   []byte(secret),
+			verifyingKey: []byte(secret),
+		}
+	}
+
+	if dir := os.Getenv("JWT_KEYS_DIR"); dir != "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("failed to read JWT keys directory: %w", err)
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+
+			ext := filepath.Ext(entry.Name())
+			if ext != ".pem" && ext != ".hmac" {
+				continue
+			}
+
+			kid := strings.TrimSuffix(entry.Name(), ext)
+			if _, exists := keys[kid]; exists {
+				return fmt.Errorf("duplicate JWT key ID %q", kid)
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return fmt.Errorf("failed to read JWT key %q: %w", kid, err)
+			}
+
+			var key *jwtKey
+			if ext == ".hmac" {
+				key, err = parseHMACKey(kid, data)
+			} else {
+				key, err = parsePEMKey(kid, data)
+			}
+			if err != nil {
+				return err
+			}
+			keys[kid] = key
+		}
+	}
+
+	if len(keys) == 0 {
+		return errors.New("no JWT keys configured, set JWT_SECRET or JWT_KEYS_DIR")
+	}
+
+	activeID := os.Getenv("JWT_SIGNING_KID")
+	if activeID == "" {
+		activeID = legacyKeyID
+	}
+
+	active, ok := keys[activeID]
+	if !ok {
+		return fmt.Errorf("JWT signing key %q not found", activeID)
+	}
+	if active.signingKey == nil {
+		return fmt.Errorf("JWT signing key %q is a public key and can't sign tokens", activeID)
+	}
+
+	keyRingMu.Lock()
+	keyRing = keys
+	activeKey = active
+	keyRingLoaded = true
+	keyRingMu.Unlock()
+
+	return nil
+}
+
+func parseHMACKey(kid string, data []byte) (*jwtKey, error) {
+	secret := []byte(strings.TrimSpace(string(data)))
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("JWT key %q must be at least 32 bytes", kid)
+	}
+
+	return &jwtKey{
+		id:           kid,
+		method:       jwt.SigningMethodHS256,
+		signingKey:   secret,
+		verifyingKey: secret,
+	}, nil
+}
+
+func parsePEMKey(kid string, data []byte) (*jwtKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("JWT key %q is not valid PEM", kid)
+	}
+
+	var parsed interface{}
+	var err error
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("JWT key %q has unsupported PEM type %q", kid, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWT key %q: %w", kid, err)
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &jwtKey{id: kid, method: jwt.SigningMethodRS256, signingKey: key, verifyingKey: &key.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &jwtKey{id: kid, method: jwt.SigningMethodRS256, verifyingKey: key}, nil
+	case ed25519.PrivateKey:
+		return &jwtKey{id: kid, method: jwt.SigningMethodEdDSA, signingKey: key, verifyingKey: key.Public()}, nil
+	case ed25519.PublicKey:
+		return &jwtKey{id: kid, method: jwt.SigningMethodEdDSA, verifyingKey: key}, nil
+	default:
+		return nil, fmt.Errorf("JWT key %q has unsupported key type %T", kid, parsed)
+	}
+}
+
+// SignJWT signs the claims with the active key and records its ID in the "kid" header
+func SignJWT(claims jwt.Claims) (string, error) {
+	keyRingMu.RLock()
+	key := activeKey
+	keyRingMu.RUnlock()
+
+	if key == nil {
+		return "", errors.New("JWT key ring has not been initialized")
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+
+	return token.SignedString(key.signingKey)
+}
+
+// JWTKeyfunc resolves the verification key for a token from its "kid" header, for use with jwt.Parse
+func JWTKeyfunc(token *jwt.Token) (interface{}, error) {
+	keyRingMu.RLock()
+	defer keyRingMu.RUnlock()
+
+	if !keyRingLoaded {
+		return nil, errors.New("JWT key ring has not been initialized")
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = legacyKeyID
+	}
+
+	key, ok := keyRing[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	// Pin the algorithm to the key so a token can't pick a weaker one
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, errors.New("invalid signing method")
+	}
+
+	return key.verifyingKey, nil
+}
+
+// PublicJWKS returns the asymmetric verification keys, HMAC secrets are never published
+func PublicJWKS() models.JWKS {
+	keyRingMu.RLock()
+	defer keyRingMu.RUnlock()
+
+	jwks := models.JWKS{Keys: []models.JWK{}}
+
+	for _, key := range keyRing {
+		switch pub := key.verifyingKey.(type) {
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, models.JWK{
+				KeyType:   "RSA",
+				KeyID:     key.id,
+				Use:       "sig",
+				Algorithm: key.method.Alg(),
+				Modulus:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				Exponent:  base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks.Keys = append(jwks.Keys, models.JWK{
+				KeyType:   "OKP",
+				KeyID:     key.id,
+				Use:       "sig",
+				Algorithm: key.method.Alg(),
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool { return jwks.Keys[i].KeyID < jwks.Keys[j].KeyID })
+
+	return jwks
+}
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// Per-account limits, persisted on the users table
+	AccountBackoffThreshold = 3
+	MaxAccountLoginFailures = 10
+	AccountLockoutDuration  = 15 * time.Minute
+
+	// Per-IP limits, kept in memory. These are looser since several members may share a network.
+	ipBackoffThreshold = 10
+	maxIPLoginFailures = 50
+	ipLockoutDuration  = 15 * time.Minute
+	ipFailureWindow    = 15 * time.Minute
+
+	maxLoginBackoff = 5 * time.Minute
+)
+
+// LoginBackoff returns how much longer a caller must wait after lastFailure before trying again
+func LoginBackoff(failures int, lastFailure time.Time, threshold int) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+
+	delay := maxLoginBackoff
+	if shift := failures - threshold; shift < 10 {
+		delay = min(time.Duration(1<<shift)*time.Second, maxLoginBackoff)
+	}
+
+	return time.Until(lastFailure.Add(delay))
+}
+
+type ipLoginFailures struct {
+	count       int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+var (
+	ipLoginFailuresMu sync.Mutex
+	ipLoginFailureMap = make(map[string]*ipLoginFailures)
+)
+
+// IPLoginWait returns how long the IP must wait before another login attempt is allowed
+func IPLoginWait(ip string) time.Duration {
+	ipLoginFailuresMu.Lock()
+	defer ipLoginFailuresMu.Unlock()
+
+	entry, ok := ipLoginFailureMap[ip]
+	if !ok {
+		return 0
+	}
+
+	if wait := time.Until(entry.lockedUntil); wait > 0 {
+		return wait
+	}
+
+	if wait := LoginBackoff(entry.count, entry.lastFailure, ipBackoffThreshold); wait > 0 {
+		return wait
+	}
+
+	return 0
+}
+
+// RecordIPLoginFailure counts a failed login from the IP, locking it out once it crosses the limit
+func RecordIPLoginFailure(ip string) {
+	ipLoginFailuresMu.Lock()
+	defer ipLoginFailuresMu.Unlock()
+
+	now := time.Now()
+
+	// Forget IPs that have gone quiet so the map doesn't grow forever
+	for key, entry := range ipLoginFailureMap {
+		if now.Sub(entry.lastFailure) > ipFailureWindow && now.After(entry.lockedUntil) {
+			delete(ipLoginFailureMap, key)
+		}
+	}
+
+	entry, ok := ipLoginFailureMap[ip]
+	if !ok {
+		entry = &ipLoginFailures{}
+		ipLoginFailureMap[ip] = entry
+	}
+
+	entry.count++
+	entry.lastFailure = now
+
+	if entry.count >= maxIPLoginFailures {
+		entry.count = 0
+		entry.lockedUntil = now.Add(ipLockoutDuration)
+	}
+}
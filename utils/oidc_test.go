@@ -0,0 +1,332 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"nest/models"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	testOIDCClientID     = "nest"
+	testOIDCClientSecret = "stand-in-secret"
+	testOIDCRedirectURL  = "https://nest.example/login/oidc/stand-in/callback"
+	testOIDCKeyID        = "stand-in-key"
+)
+
+// testAuthorization is what the stand-in provider remembers about a code between the redirect and the token request
+type testAuthorization struct {
+	codeChallenge string
+	redirectURI   string
+	claims        jwt.MapClaims
+}
+
+// standInOIDCProvider serves discovery, a key set and a token endpoint the way a real identity provider does
+type standInOIDCProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu             sync.Mutex
+	signingKey     *rsa.PrivateKey
+	authorizations map[string]testAuthorization
+}
+
+func newStandInOIDCProvider(t *testing.T) *standInOIDCProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	provider := &standInOIDCProvider{key: key, signingKey: key, authorizations: map[string]testAuthorization{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 provider.server.URL,
+			"authorization_endpoint": provider.server.URL + "/authorize",
+			"token_endpoint":         provider.server.URL + "/token",
+			"jwks_uri":               provider.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": testOIDCKeyID,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", provider.token)
+
+	provider.server = httptest.NewServer(mux)
+	t.Cleanup(provider.server.Close)
+	return provider
+}
+
+// token redeems a code once, and only for the verifier whose challenge started the flow
+func (p *standInOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, _ := r.BasicAuth()
+	if r.Method != http.MethodPost || r.ParseForm() != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		http.Error(w, `{"error":"invalid_request"}`, http.StatusBadRequest)
+		return
+	}
+	if clientID != testOIDCClientID || clientSecret != testOIDCClientSecret {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	p.mu.Lock()
+	authorization, ok := p.authorizations[r.PostForm.Get("code")]
+	delete(p.authorizations, r.PostForm.Get("code"))
+	signingKey := p.signingKey
+	p.mu.Unlock()
+
+	if !ok || authorization.redirectURI != r.PostForm.Get("redirect_uri") ||
+		PKCEChallenge(r.PostForm.Get("code_verifier")) != authorization.codeChallenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, authorization.claims)
+	token.Header["kid"] = testOIDCKeyID
+	idToken, err := token.SignedString(signingKey)
+	if err != nil {
+		http.Error(w, `{"error":"server_error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "opaque", "token_type": "Bearer", "id_token": idToken})
+}
+
+// authorize plays the user signing in at the provider, returning the code it would redirect back with. The ID token
+// claims start out valid for the request, and modify can break them.
+func (p *standInOIDCProvider) authorize(t *testing.T, authorizationURL string, modify func(jwt.MapClaims)) string {
+	t.Helper()
+
+	parsed, err := url.Parse(authorizationURL)
+	if err != nil || !strings.HasPrefix(authorizationURL, p.server.URL+"/authorize?") {
+		t.Fatalf("unexpected authorization URL %q", authorizationURL)
+	}
+	query := parsed.Query()
+	if query.Get("response_type") != "code" || query.Get("client_id") != testOIDCClientID || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("authorization request is missing parameters: %v", query)
+	}
+
+	claims := jwt.MapClaims{
+		"iss":            p.server.URL,
+		"aud":            testOIDCClientID,
+		"sub":            "stand-in-subject",
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(5 * time.Minute).Unix(),
+		"nonce":          query.Get("nonce"),
+		"email":          "Ada.Lovelace@Example.com",
+		"email_verified": true,
+		"given_name":     "Ada",
+		"family_name":    "Lovelace",
+	}
+	if modify != nil {
+		modify(claims)
+	}
+
+	code := newTestChallenge()
+	p.mu.Lock()
+	p.authorizations[code] = testAuthorization{
+		codeChallenge: query.Get("code_challenge"),
+		redirectURI:   query.Get("redirect_uri"),
+		claims:        claims,
+	}
+	p.mu.Unlock()
+	return code
+}
+
+func (p *standInOIDCProvider) client() *OIDCProvider {
+	return &OIDCProvider{config: models.OIDCProviderConfig{
+		ID:           "stand-in",
+		Issuer:       p.server.URL,
+		ClientID:     testOIDCClientID,
+		ClientSecret: testOIDCClientSecret,
+		Scopes:       []string{"openid", "email", "profile"},
+		RedirectURL:  testOIDCRedirectURL,
+	}}
+}
+
+// startTestOIDCLogin mirrors StartOIDCLogin, returning the URL along with the nonce and verifier it stores
+func startTestOIDCLogin(t *testing.T, client *OIDCProvider) (authorizationURL, nonce, codeVerifier string) {
+	t.Helper()
+
+	nonce, codeVerifier = newTestChallenge(), newTestChallenge()
+	authorizationURL, err := client.AuthorizationURL(context.Background(), newTestChallenge(), nonce, codeVerifier)
+	if err != nil {
+		t.Fatalf("failed to build authorization URL: %v", err)
+	}
+	return authorizationURL, nonce, codeVerifier
+}
+
+func TestOIDCLogin(t *testing.T) {
+	provider := newStandInOIDCProvider(t)
+	client := provider.client()
+
+	authorizationURL, nonce, codeVerifier := startTestOIDCLogin(t, client)
+	code := provider.authorize(t, authorizationURL, nil)
+
+	identity, err := client.Exchange(context.Background(), code, codeVerifier, nonce)
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+
+	want := models.OIDCIdentity{
+		Subject:       "stand-in-subject",
+		Email:         "Ada.Lovelace@Example.com",
+		EmailVerified: true,
+		GivenName:     "Ada",
+		FamilyName:    "Lovelace",
+	}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+
+	if _, err := client.Exchange(context.Background(), code, codeVerifier, nonce); err == nil {
+		t.Error("an authorization code was redeemed twice")
+	}
+}
+
+func TestOIDCEmailVerifiedClaim(t *testing.T) {
+	provider := newStandInOIDCProvider(t)
+	client := provider.client()
+
+	for _, test := range []struct {
+		name         string
+		claim        interface{}
+		wantVerified bool
+	}{
+		{"boolean", true, true},
+		{"string", "true", true},
+		{"false", false, false},
+		{"missing", nil, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			authorizationURL, nonce, codeVerifier := startTestOIDCLogin(t, client)
+			code := provider.authorize(t, authorizationURL, func(claims jwt.MapClaims) {
+				if test.claim == nil {
+					delete(claims, "email_verified")
+				} else {
+					claims["email_verified"] = test.claim
+				}
+			})
+
+			identity, err := client.Exchange(context.Background(), code, codeVerifier, nonce)
+			if err != nil {
+				t.Fatalf("exchange failed: %v", err)
+			}
+			if identity.EmailVerified != test.wantVerified {
+				t.Errorf("email verified = %v, want %v", identity.EmailVerified, test.wantVerified)
+			}
+		})
+	}
+}
+
+func TestOIDCPKCE(t *testing.T) {
+	provider := newStandInOIDCProvider(t)
+	client := provider.client()
+
+	authorizationURL, nonce, codeVerifier := startTestOIDCLogin(t, client)
+	parsed, _ := url.Parse(authorizationURL)
+	if got := parsed.Query().Get("code_challenge"); got != PKCEChallenge(codeVerifier) || got == codeVerifier {
+		t.Fatalf("code challenge = %q, want the S256 challenge of the verifier", got)
+	}
+
+	// A code intercepted on the redirect is useless without the verifier that stayed on the server
+	code := provider.authorize(t, authorizationURL, nil)
+	if _, err := client.Exchange(context.Background(), code, newTestChallenge(), nonce); err == nil {
+		t.Fatal("a code was redeemed with the wrong verifier")
+	}
+}
+
+func TestOIDCIDTokenRejections(t *testing.T) {
+	provider := newStandInOIDCProvider(t)
+	client := provider.client()
+
+	tests := []struct {
+		name   string
+		modify func(jwt.MapClaims)
+	}{
+		{"nonce from another login", func(claims jwt.MapClaims) { claims["nonce"] = newTestChallenge() }},
+		{"no nonce", func(claims jwt.MapClaims) { delete(claims, "nonce") }},
+		{"issuer mismatch", func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example" }},
+		{"no issuer", func(claims jwt.MapClaims) { delete(claims, "iss") }},
+		{"audience mismatch", func(claims jwt.MapClaims) { claims["aud"] = "another-client" }},
+		{"audience list without us", func(claims jwt.MapClaims) { claims["aud"] = []string{"another-client", "a-third-client"} }},
+		{"authorized party mismatch", func(claims jwt.MapClaims) {
+			claims["aud"] = []string{testOIDCClientID, "another-client"}
+			claims["azp"] = "another-client"
+		}},
+		{"expired", func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{"no expiry", func(claims jwt.MapClaims) { delete(claims, "exp") }},
+		{"no subject", func(claims jwt.MapClaims) { delete(claims, "sub") }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			authorizationURL, nonce, codeVerifier := startTestOIDCLogin(t, client)
+			code := provider.authorize(t, authorizationURL, test.modify)
+			if identity, err := client.Exchange(context.Background(), code, codeVerifier, nonce); err == nil {
+				t.Fatalf("ID token was accepted: %+v", identity)
+			}
+		})
+	}
+
+	t.Run("nonce replayed into another login", func(t *testing.T) {
+		authorizationURL, _, codeVerifier := startTestOIDCLogin(t, client)
+		code := provider.authorize(t, authorizationURL, nil)
+		if _, err := client.Exchange(context.Background(), code, codeVerifier, newTestChallenge()); err == nil {
+			t.Fatal("ID token was accepted for a different login's nonce")
+		}
+	})
+
+	t.Run("signed by another key", func(t *testing.T) {
+		otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("failed to generate key: %v", err)
+		}
+		provider.mu.Lock()
+		provider.signingKey = otherKey
+		provider.mu.Unlock()
+		t.Cleanup(func() {
+			provider.mu.Lock()
+			provider.signingKey = provider.key
+			provider.mu.Unlock()
+		})
+
+		authorizationURL, nonce, codeVerifier := startTestOIDCLogin(t, client)
+		code := provider.authorize(t, authorizationURL, nil)
+		if _, err := client.Exchange(context.Background(), code, codeVerifier, nonce); err == nil {
+			t.Fatal("ID token signed by another key was accepted")
+		}
+	})
+}
+
+func TestOIDCDiscoveryIssuerMismatch(t *testing.T) {
+	provider := newStandInOIDCProvider(t)
+	client := provider.client()
+	// The same server reached under another name, so the document is fetched but names a different issuer
+	client.config.Issuer = strings.Replace(provider.server.URL, "127.0.0.1", "localhost", 1)
+
+	if _, err := client.AuthorizationURL(context.Background(), "state", "nonce", "verifier"); err == nil {
+		t.Fatal("a discovery document for another issuer was accepted")
+	}
+}
@@ -0,0 +1,211 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher hashes new passwords and verifies stored hashes, including ones written by older policies
+type PasswordHasher interface {
+	Hash(password string) ([]byte, error)
+	Verify(hash []byte, password string) (bool, error)
+	// NeedsRehash reports whether the hash is weaker than what Hash would produce today
+	NeedsRehash(hash []byte) bool
+}
+
+// Argon2Params are the argon2id cost parameters, memory is in KiB
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params follow the second recommended option in RFC 9106 with lower parallelism for small hosts
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+const argon2idPrefix = "$argon2id$"
+
+var errMalformedPasswordHash = errors.New("malformed password hash")
+
+var passwordHasher PasswordHasher = NewArgon2idHasher(DefaultArgon2Params)
+
+// InitPasswordHasher reads the argon2id parameters from PASSWORD_ARGON2_MEMORY (KiB),
+// PASSWORD_ARGON2_ITERATIONS and PASSWORD_ARGON2_PARALLELISM, falling back to the defaults for unset values
+func InitPasswordHasher() error {
+	params := DefaultArgon2Params
+
+	if err := envUint("PASSWORD_ARGON2_MEMORY", &params.Memory, 32); err != nil {
+		return err
+	}
+	if err := envUint("PASSWORD_ARGON2_ITERATIONS", &params.Iterations, 32); err != nil {
+		return err
+	}
+
+	parallelism := uint32(params.Parallelism)
+	if err := envUint("PASSWORD_ARGON2_PARALLELISM", &parallelism, 8); err != nil {
+		return err
+	}
+	params.Parallelism = uint8(parallelism)
+
+	if params.Iterations < 1 || params.Parallelism < 1 {
+		return errors.New("argon2 iterations and parallelism must be at least 1")
+	}
+	if params.Memory < 8*uint32(params.Parallelism) {
+		return errors.New("argon2 memory must be at least 8 KiB per lane of parallelism")
+	}
+
+	passwordHasher = NewArgon2idHasher(params)
+	return nil
+}
+
+func envUint(name string, dest *uint32, bits int) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+
+	parsed, err := strconv.ParseUint(value, 10, bits)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+
+	*dest = uint32(parsed)
+	return nil
+}
+
+// HashPassword hashes a password with the configured hasher
+func HashPassword(password string) ([]byte, error) {
+	return passwordHasher.Hash(password)
+}
+
+// VerifyPassword checks a password against a stored hash, a mismatch is not an error
+func VerifyPassword(hash []byte, password string) (bool, error) {
+	return passwordHasher.Verify(hash, password)
+}
+
+// PasswordNeedsRehash reports whether a stored hash should be upgraded the next time the password is known
+func PasswordNeedsRehash(hash []byte) bool {
+	return passwordHasher.NeedsRehash(hash)
+}
+
+type argon2idHasher struct {
+	params Argon2Params
+}
+
+// NewArgon2idHasher returns a hasher that writes argon2id PHC strings and still verifies bcrypt hashes
+func NewArgon2idHasher(params Argon2Params) PasswordHasher {
+	return &argon2idHasher{params: params}
+}
+
+func (h *argon2idHasher) Hash(password string) ([]byte, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+
+	encoded := fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix,
+		argon2.Version,
+		h.params.Memory,
+		h.params.Iterations,
+		h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))
+
+	return []byte(encoded), nil
+}
+
+func (h *argon2idHasher) Verify(hash []byte, password string) (bool, error) {
+	if !bytes.HasPrefix(hash, []byte(argon2idPrefix)) {
+		// Hashes from before argon2id was introduced
+		err := bcrypt.CompareHashAndPassword(hash, []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	params, version, salt, key, err := decodeArgon2idHash(hash)
+	if err != nil {
+		return false, err
+	}
+	if version != argon2.Version {
+		return false, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	return subtle.ConstantTimeCompare(key, candidate) == 1, nil
+}
+
+func (h *argon2idHasher) NeedsRehash(hash []byte) bool {
+	if !bytes.HasPrefix(hash, []byte(argon2idPrefix)) {
+		return true
+	}
+
+	params, version, salt, _, err := decodeArgon2idHash(hash)
+	if err != nil {
+		return true
+	}
+
+	return version != argon2.Version ||
+		params.Memory < h.params.Memory ||
+		params.Iterations < h.params.Iterations ||
+		params.KeyLength < h.params.KeyLength ||
+		uint32(len(salt)) < h.params.SaltLength
+}
+
+// decodeArgon2idHash parses "$argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>"
+func decodeArgon2idHash(hash []byte) (Argon2Params, int, []byte, []byte, error) {
+	var params Argon2Params
+	var version int
+
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 {
+		return params, 0, nil, nil, errMalformedPasswordHash
+	}
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, 0, nil, nil, errMalformedPasswordHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, 0, nil, nil, errMalformedPasswordHash
+	}
+	if params.Iterations < 1 || params.Parallelism < 1 {
+		return params, 0, nil, nil, errMalformedPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, 0, nil, nil, errMalformedPasswordHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, 0, nil, nil, errMalformedPasswordHash
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, version, salt, key, nil
+}
@@ -0,0 +1,224 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"nest/db"
+	"nest/models"
+	"net/http"
+)
+
+// Action names something a caller wants to do to a resource, in the form "<resource>:<verb>"
+type Action string
+
+const (
+	ActionUserRead           Action = "user:read"
+	ActionUserUpdate         Action = "user:update"
+	ActionUserDelete         Action = "user:delete"
+	ActionUserPasswordChange Action = "user:password:change"
+	ActionUserEventsList     Action = "user:events:list"
+	ActionUserGroupsList     Action = "user:groups:list"
+	ActionUserExport         Action = "user:export"
+
+	ActionGroupRead              Action = "group:read"
+	ActionGroupUpdate            Action = "group:update"
+	ActionGroupDelete            Action = "group:delete"
+	ActionGroupLeave             Action = "group:leave"
+	ActionGroupMembersList       Action = "group:members:list"
+	ActionGroupMembersManage     Action = "group:members:manage"
+	ActionGroupEventsList        Action = "group:events:list"
+	ActionGroupEventsCreate      Action = "group:events:create"
+	ActionGroupInvitationsManage Action = "group:invitations:manage"
+	ActionGroupAuditList         Action = "group:audit:list"
+
+	ActionEventRead             Action = "event:read"
+	ActionEventUpdate           Action = "event:update"
+	ActionEventDelete           Action = "event:delete"
+	ActionEventReact            Action = "event:react"
+	ActionEventReactionsList    Action = "event:reactions:list"
+	ActionEventAttendanceList   Action = "event:attendance:list"
+	ActionEventAttendanceUpdate Action = "event:attendance:update"
+	ActionEventAttendanceManage Action = "event:attendance:manage"
+)
+
+// ResourceKind says what the ID passed alongside an action refers to
+type ResourceKind int
+
+const (
+	ResourceUser ResourceKind = iota
+	ResourceGroup
+	ResourceEvent
+)
+
+// Subject is the authenticated caller
+type Subject struct {
+	UserID int
+	Role   models.Role
+	Scope  *models.TokenScope
+}
+
+// Resource is the target of an action, with the group and creator filled in for events
+type Resource struct {
+	Kind    ResourceKind
+	ID      int
+	GroupID int
+	Event   *models.Event
+}
+
+// Rule grants access when it returns true, a policy allows an action if any of its rules do
+type Rule func(ctx context.Context, subject Subject, resource Resource) (bool, error)
+
+type Policy struct {
+	Resource ResourceKind
+	Rules    []Rule
+}
+
+// Policies is the single source of truth for who may do what
+var Policies = map[Action]Policy{
+	ActionUserRead:           {ResourceUser, []Rule{AllowSelf, AllowSuperAdmin}},
+	ActionUserUpdate:         {ResourceUser, []Rule{AllowSelf, AllowSuperAdmin}},
+	ActionUserDelete:         {ResourceUser, []Rule{AllowSelf, AllowSuperAdmin}},
+	ActionUserPasswordChange: {ResourceUser, []Rule{AllowSelf}},
+	ActionUserEventsList:     {ResourceUser, []Rule{AllowSelf, AllowSuperAdmin}},
+	ActionUserGroupsList:     {ResourceUser, []Rule{AllowSelf, AllowSuperAdmin}},
+	ActionUserExport:         {ResourceUser, []Rule{AllowSelf}},
+
+	ActionGroupRead:              {ResourceGroup, []Rule{AllowGroupMember, AllowSuperAdmin}},
+	ActionGroupUpdate:            {ResourceGroup, []Rule{AllowGroupAdmin, AllowSuperAdmin}},
+	ActionGroupDelete:            {ResourceGroup, []Rule{AllowGroupAdmin, AllowSuperAdmin}},
+	ActionGroupLeave:             {ResourceGroup, []Rule{AllowGroupMember, AllowSuperAdmin}},
+	ActionGroupMembersList:       {ResourceGroup, []Rule{AllowGroupMember, AllowSuperAdmin}},
+	ActionGroupMembersManage:     {ResourceGroup, []Rule{AllowGroupAdmin, AllowSuperAdmin}},
+	ActionGroupEventsList:        {ResourceGroup, []Rule{AllowGroupMember, AllowSuperAdmin}},
+	ActionGroupEventsCreate:      {ResourceGroup, []Rule{AllowGroupMember, AllowSuperAdmin}},
+	ActionGroupInvitationsManage: {ResourceGroup, []Rule{AllowGroupAdmin, AllowSuperAdmin}},
+	ActionGroupAuditList:         {ResourceGroup, []Rule{AllowGroupAdmin, AllowSuperAdmin}},
+
+	ActionEventRead:             {ResourceEvent, []Rule{AllowEventCreator, AllowGroupMember, AllowSuperAdmin}},
+	ActionEventUpdate:           {ResourceEvent, []Rule{AllowEventCreator, AllowGroupAdmin, AllowSuperAdmin}},
+	ActionEventDelete:           {ResourceEvent, []Rule{AllowEventCreator, AllowGroupAdmin, AllowSuperAdmin}},
+	ActionEventReact:            {ResourceEvent, []Rule{AllowGroupMember, AllowSuperAdmin}},
+	ActionEventReactionsList:    {ResourceEvent, []Rule{AllowEventCreator, AllowGroupMember, AllowSuperAdmin}},
+	ActionEventAttendanceList:   {ResourceEvent, []Rule{AllowEventCreator, AllowGroupMember, AllowSuperAdmin}},
+	ActionEventAttendanceUpdate: {ResourceEvent, []Rule{AllowEventCreator, AllowGroupMember, AllowSuperAdmin}},
+	// Setting someone else's attendance
+	ActionEventAttendanceManage: {ResourceEvent, []Rule{AllowEventCreator, AllowGroupAdmin, AllowSuperAdmin}},
+}
+
+// crossGroupActions return data from every group the user is in, so a token scoped to some groups can't use them
+var crossGroupActions = map[Action]bool{
+	ActionUserEventsList: true,
+	ActionUserGroupsList: true,
+}
+
+// Group membership lookups behind the group rules, tests swap them out to evaluate policies without a database
+var (
+	isGroupMember = db.IsUserGroupMember
+	isGroupAdmin  = db.IsUserGroupAdmin
+)
+
+func AllowSelf(ctx context.Context, subject Subject, resource Resource) (bool, error) {
+	return resource.Kind == ResourceUser && resource.ID == subject.UserID, nil
+}
+
+func AllowSuperAdmin(ctx context.Context, subject Subject, resource Resource) (bool, error) {
+	// A token limited to specific groups never carries deployment-wide powers
+	return subject.Role == models.SuperAdmin && (subject.Scope == nil || len(subject.Scope.GroupIDs) == 0), nil
+}
+
+func AllowGroupMember(ctx context.Context, subject Subject, resource Resource) (bool, error) {
+	if resource.Kind == ResourceUser {
+		return false, nil
+	}
+	return isGroupMember(ctx, subject.UserID, resource.GroupID)
+}
+
+func AllowGroupAdmin(ctx context.Context, subject Subject, resource Resource) (bool, error) {
+	if resource.Kind == ResourceUser {
+		return false, nil
+	}
+	return isGroupAdmin(ctx, subject.UserID, resource.GroupID)
+}
+
+func AllowEventCreator(ctx context.Context, subject Subject, resource Resource) (bool, error) {
+	return resource.Event != nil && resource.Event.CreatedByID == int64(subject.UserID), nil
+}
+
+// SubjectFromRequest reads the caller set by JWTAuthMiddleware
+func SubjectFromRequest(r *http.Request) Subject {
+	subject := Subject{
+		UserID: r.Context().Value("user_id").(int),
+		Role:   models.Role(r.Context().Value("role").(string)),
+	}
+	subject.Scope, _ = r.Context().Value("token_scope").(*models.TokenScope)
+
+	return subject
+}
+
+// ResolveResource loads what a policy needs to know about the resource, such as an event's group
+func ResolveResource(ctx context.Context, kind ResourceKind, id int) (Resource, error) {
+	resource := Resource{Kind: kind, ID: id}
+
+	switch kind {
+	case ResourceGroup:
+		resource.GroupID = id
+	case ResourceEvent:
+		event, err := db.GetEventByID(ctx, id)
+		if err != nil {
+			return resource, err
+		}
+		resource.Event = event
+		resource.GroupID = int(event.GroupID)
+	}
+
+	return resource, nil
+}
+
+// Evaluate decides whether the subject may perform the action on the resource
+func Evaluate(ctx context.Context, subject Subject, action Action, resource Resource) (bool, error) {
+	policy, ok := Policies[action]
+	if !ok {
+		return false, fmt.Errorf("no policy for action %q", action)
+	}
+	if policy.Resource != resource.Kind {
+		return false, fmt.Errorf("action %q does not apply to this resource", action)
+	}
+
+	// Personal access token scopes cap every rule below
+	if subject.Scope != nil && len(subject.Scope.GroupIDs) > 0 {
+		if resource.Kind == ResourceUser && (resource.ID != subject.UserID || crossGroupActions[action]) {
+			return false, nil
+		}
+		if resource.Kind != ResourceUser && !subject.Scope.AllowsGroup(int64(resource.GroupID)) {
+			return false, nil
+		}
+	}
+
+	for _, rule := range policy.Rules {
+		allowed, err := rule(ctx, subject, resource)
+		if err != nil {
+			return false, err
+		}
+		if allowed {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Authorize reports whether the caller may perform the action on the resource with the given ID, denying on any error
+func Authorize(r *http.Request, action Action, id int) bool {
+	policy, ok := Policies[action]
+	if !ok {
+		return false
+	}
+
+	resource, err := ResolveResource(r.Context(), policy.Resource, id)
+	if err != nil {
+		return false
+	}
+
+	allowed, err := Evaluate(r.Context(), SubjectFromRequest(r), action, resource)
+	return err == nil && allowed
+}
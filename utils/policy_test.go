@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"context"
+	"nest/models"
+	"slices"
+	"testing"
+)
+
+// The fixture is one group holding one event. The self user is a plain member who created the event and is the
+// target of user actions, so "self" also means the resource's owner.
+const (
+	testGroupID = 10
+	testEventID = 100
+
+	selfUserID       = 1
+	otherMemberID    = 2
+	groupAdminUserID = 3
+	superAdminUserID = 4
+	nonMemberUserID  = 5
+)
+
+type policySubject struct {
+	name    string
+	subject Subject
+}
+
+var policySubjects = []policySubject{
+	{"self", Subject{UserID: selfUserID, Role: models.Member}},
+	{"other member", Subject{UserID: otherMemberID, Role: models.Member}},
+	{"group admin", Subject{UserID: groupAdminUserID, Role: models.Member}},
+	{"super admin", Subject{UserID: superAdminUserID, Role: models.SuperAdmin}},
+	{"non-member", Subject{UserID: nonMemberUserID, Role: models.Member}},
+}
+
+// Expected outcome per subject, in the order of policySubjects
+type outcomes [5]bool
+
+var (
+	selfOrSuperAdmin = outcomes{true, false, false, true, false}
+	selfOnly         = outcomes{true, false, false, false, false}
+	anyMember        = outcomes{true, true, true, true, false}
+	adminOnly        = outcomes{false, false, true, true, false}
+	creatorOrAdmin   = outcomes{true, false, true, true, false}
+)
+
+var policyTable = map[Action]outcomes{
+	ActionUserRead:           selfOrSuperAdmin,
+	ActionUserUpdate:         selfOrSuperAdmin,
+	ActionUserDelete:         selfOrSuperAdmin,
+	ActionUserPasswordChange: selfOnly,
+	ActionUserEventsList:     selfOrSuperAdmin,
+	ActionUserGroupsList:     selfOrSuperAdmin,
+	ActionUserExport:         selfOnly,
+
+	ActionGroupRead:              anyMember,
+	ActionGroupUpdate:            adminOnly,
+	ActionGroupDelete:            adminOnly,
+	ActionGroupLeave:             anyMember,
+	ActionGroupMembersList:       anyMember,
+	ActionGroupMembersManage:     adminOnly,
+	ActionGroupEventsList:        anyMember,
+	ActionGroupEventsCreate:      anyMember,
+	ActionGroupInvitationsManage: adminOnly,
+	ActionGroupAuditList:         adminOnly,
+
+	ActionEventRead:             anyMember,
+	ActionEventUpdate:           creatorOrAdmin,
+	ActionEventDelete:           creatorOrAdmin,
+	ActionEventReact:            anyMember,
+	ActionEventReactionsList:    anyMember,
+	ActionEventAttendanceList:   anyMember,
+	ActionEventAttendanceUpdate: anyMember,
+	ActionEventAttendanceManage: creatorOrAdmin,
+}
+
+// useTestMemberships answers the group rules from the fixture instead of the database
+func useTestMemberships(t *testing.T) {
+	t.Helper()
+
+	members := []int{selfUserID, otherMemberID, groupAdminUserID}
+	previousMember, previousAdmin := isGroupMember, isGroupAdmin
+	isGroupMember = func(ctx context.Context, userID, groupID int) (bool, error) {
+		return groupID == testGroupID && slices.Contains(members, userID), nil
+	}
+	isGroupAdmin = func(ctx context.Context, userID, groupID int) (bool, error) {
+		return groupID == testGroupID && userID == groupAdminUserID, nil
+	}
+	t.Cleanup(func() { isGroupMember, isGroupAdmin = previousMember, previousAdmin })
+}
+
+func testResource(kind ResourceKind) Resource {
+	switch kind {
+	case ResourceGroup:
+		return Resource{Kind: ResourceGroup, ID: testGroupID, GroupID: testGroupID}
+	case ResourceEvent:
+		event := &models.Event{ID: testEventID, GroupID: testGroupID, CreatedByID: selfUserID}
+		return Resource{Kind: ResourceEvent, ID: testEventID, GroupID: testGroupID, Event: event}
+	}
+	return Resource{Kind: ResourceUser, ID: selfUserID}
+}
+
+func TestPolicyTableCoversEveryAction(t *testing.T) {
+	for action := range Policies {
+		if _, ok := policyTable[action]; !ok {
+			t.Errorf("action %q has no expected outcomes", action)
+		}
+	}
+	for action := range policyTable {
+		if _, ok := Policies[action]; !ok {
+			t.Errorf("action %q has expected outcomes but no policy", action)
+		}
+	}
+}
+
+func TestPolicies(t *testing.T) {
+	useTestMemberships(t)
+
+	for action, expected := range policyTable {
+		for i, subject := range policySubjects {
+			t.Run(string(action)+"/"+subject.name, func(t *testing.T) {
+				allowed, err := Evaluate(context.Background(), subject.subject, action, testResource(Policies[action].Resource))
+				if err != nil {
+					t.Fatalf("evaluate failed: %v", err)
+				}
+				if allowed != expected[i] {
+					t.Errorf("allowed = %v, want %v", allowed, expected[i])
+				}
+			})
+		}
+	}
+}
+
+func TestPolicyTokenScopes(t *testing.T) {
+	useTestMemberships(t)
+
+	otherGroup := &models.TokenScope{GroupIDs: []int64{testGroupID + 1}}
+	thisGroup := &models.TokenScope{GroupIDs: []int64{testGroupID}}
+
+	tests := []struct {
+		name    string
+		subject Subject
+		action  Action
+		want    bool
+	}{
+		{"member token scoped to another group", Subject{UserID: otherMemberID, Role: models.Member, Scope: otherGroup}, ActionGroupRead, false},
+		{"member token scoped to the group", Subject{UserID: otherMemberID, Role: models.Member, Scope: thisGroup}, ActionGroupRead, true},
+		{"super admin token scoped to another group", Subject{UserID: superAdminUserID, Role: models.SuperAdmin, Scope: otherGroup}, ActionEventRead, false},
+		{"scoped super admin token loses deployment-wide access", Subject{UserID: superAdminUserID, Role: models.SuperAdmin, Scope: thisGroup}, ActionGroupRead, false},
+		{"scoped token can still reach its own account", Subject{UserID: selfUserID, Role: models.Member, Scope: otherGroup}, ActionUserRead, true},
+		{"scoped super admin token can't reach other accounts", Subject{UserID: superAdminUserID, Role: models.SuperAdmin, Scope: thisGroup}, ActionUserRead, false},
+		{"scoped token can't list events across groups", Subject{UserID: selfUserID, Role: models.Member, Scope: thisGroup}, ActionUserEventsList, false},
+		{"scoped token can't list groups across groups", Subject{UserID: selfUserID, Role: models.Member, Scope: thisGroup}, ActionUserGroupsList, false},
+		{"unscoped token can list events across groups", Subject{UserID: selfUserID, Role: models.Member, Scope: &models.TokenScope{}}, ActionUserEventsList, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			allowed, err := Evaluate(context.Background(), test.subject, test.action, testResource(Policies[test.action].Resource))
+			if err != nil {
+				t.Fatalf("evaluate failed: %v", err)
+			}
+			if allowed != test.want {
+				t.Errorf("allowed = %v, want %v", allowed, test.want)
+			}
+		})
+	}
+}
+
+func TestPolicyRejectsMismatchedResource(t *testing.T) {
+	if _, err := Evaluate(context.Background(), policySubjects[0].subject, ActionGroupRead, testResource(ResourceUser)); err == nil {
+		t.Error("a group action was evaluated against a user")
+	}
+	if _, err := Evaluate(context.Background(), policySubjects[0].subject, Action("unknown:action"), testResource(ResourceUser)); err == nil {
+		t.Error("an action without a policy was evaluated")
+	}
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"context"
+	"nest/db"
+	"nest/models"
+	"sync"
+	"time"
+)
+
+// How long a loaded principal is trusted before the database is consulted again
+const principalCacheTTL = 30 * time.Second
+
+type cachedPrincipal struct {
+	principal models.Principal
+	expiresAt time.Time
+}
+
+var (
+	principalCacheMu sync.Mutex
+	principalCache   = make(map[int]cachedPrincipal)
+)
+
+// LoadPrincipal returns the user's current role and disabled status, served from a short-lived per-process cache
+func LoadPrincipal(ctx context.Context, userID int) (*models.Principal, error) {
+	principalCacheMu.Lock()
+	cached, ok := principalCache[userID]
+	principalCacheMu.Unlock()
+
+	if ok && time.Now().Before(cached.expiresAt) {
+		principal := cached.principal
+		return &principal, nil
+	}
+
+	principal, err := db.GetPrincipal(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	principalCacheMu.Lock()
+	principalCache[userID] = cachedPrincipal{
+		principal: *principal,
+		expiresAt: time.Now().Add(principalCacheTTL),
+	}
+	principalCacheMu.Unlock()
+
+	return principal, nil
+}
+
+// InvalidatePrincipal drops the cached principal so the next request reloads it from the database
+func InvalidatePrincipal(userID int) {
+	principalCacheMu.Lock()
+	delete(principalCache, userID)
+	principalCacheMu.Unlock()
+}
@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	SessionCookieName = "uccelli_session"
+	RefreshCookieName = "uccelli_refresh"
+	CSRFCookieName    = "uccelli_csrf"
+	CSRFHeaderName    = "X-CSRF-Token"
+
+	csrfTokenPurpose = "csrf"
+)
+
+type sessionCookieConfig struct {
+	enabled        bool
+	domain         string
+	sameSite       http.SameSite
+	allowedOrigins []string
+}
+
+var sessionCookies = sessionCookieConfig{sameSite: http.SameSiteLaxMode}
+
+// InitSessionCookies reads the cookie session settings. SESSION_COOKIES=true lets clients sign in with cookies
+// instead of bearer tokens, SESSION_COOKIE_DOMAIN and SESSION_COOKIE_SAMESITE (lax, strict or none) tune the cookies
+// and CORS_ALLOWED_ORIGINS lists the origins allowed to make credentialed requests, defaulting to AppURL.
+func InitSessionCookies() error {
+	config := sessionCookieConfig{
+		enabled:        os.Getenv("SESSION_COOKIES") == "true",
+		domain:         os.Getenv("SESSION_COOKIE_DOMAIN"),
+		sameSite:       http.SameSiteLaxMode,
+		allowedOrigins: []string{AppURL},
+	}
+
+	switch strings.ToLower(os.Getenv("SESSION_COOKIE_SAMESITE")) {
+	case "", "lax":
+	case "strict":
+		config.sameSite = http.SameSiteStrictMode
+	case "none":
+		config.sameSite = http.SameSiteNoneMode
+	default:
+		return fmt.Errorf("invalid SESSION_COOKIE_SAMESITE %q", os.Getenv("SESSION_COOKIE_SAMESITE"))
+	}
+
+	if origins := os.Getenv("CORS_ALLOWED_ORIGINS"); origins != "" {
+		config.allowedOrigins = nil
+		for _, origin := range strings.Split(origins, ",") {
+			if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+				config.allowedOrigins = append(config.allowedOrigins, origin)
+			}
+		}
+	}
+
+	sessionCookies = config
+	return nil
+}
+
+// SessionCookiesEnabled reports whether clients may use cookie sessions
+func SessionCookiesEnabled() bool {
+	return sessionCookies.enabled
+}
+
+// IsAllowedOrigin reports whether the origin may make credentialed cross-origin requests
+func IsAllowedOrigin(origin string) bool {
+	return sessionCookies.enabled && slices.Contains(sessionCookies.allowedOrigins, origin)
+}
+
+// SetSessionCookies stores the session's tokens in HttpOnly cookies and returns the CSRF token the client must echo
+// back in the X-CSRF-Token header
+func SetSessionCookies(w http.ResponseWriter, sessionID, accessToken, refreshToken string) (string, error) {
+	csrfToken, err := GenerateSignedToken(csrfTokenPurpose, sessionID, RefreshTokenTTL)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign CSRF token: %w", err)
+	}
+
+	http.SetCookie(w, sessionCookie(SessionCookieName, accessToken, "/api", AccessTokenTTL, true))
+	http.SetCookie(w, sessionCookie(RefreshCookieName, refreshToken, "/api/user/refresh", RefreshTokenTTL, true))
+	// Readable by scripts on the same site so the UI can copy it into the header
+	http.SetCookie(w, sessionCookie(CSRFCookieName, csrfToken, "/", RefreshTokenTTL, false))
+
+	return csrfToken, nil
+}
+
+// ClearSessionCookies expires every session cookie
+func ClearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, sessionCookie(SessionCookieName, "", "/api", -1, true))
+	http.SetCookie(w, sessionCookie(RefreshCookieName, "", "/api/user/refresh", -1, true))
+	http.SetCookie(w, sessionCookie(CSRFCookieName, "", "/", -1, false))
+}
+
+func sessionCookie(name, value, path string, ttl time.Duration, httpOnly bool) *http.Cookie {
+	maxAge := int(ttl.Seconds())
+	if ttl < 0 {
+		maxAge = -1
+	}
+
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   sessionCookies.domain,
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: httpOnly,
+		SameSite: sessionCookies.sameSite,
+	}
+}
+
+// CookieValue returns the named cookie when cookie sessions are enabled
+func CookieValue(r *http.Request, name string) string {
+	if !sessionCookies.enabled {
+		return ""
+	}
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+
+	return cookie.Value
+}
+
+// ValidCSRFToken checks the double-submitted CSRF header against its cookie and the session it was issued for
+func ValidCSRFToken(r *http.Request, sessionID string) bool {
+	header := r.Header.Get(CSRFHeaderName)
+	cookie := CookieValue(r, CSRFCookieName)
+	if header == "" || subtle.ConstantTimeCompare([]byte(header), []byte(cookie)) != 1 {
+		return false
+	}
+
+	subject, err := ParseSignedToken(csrfTokenPurpose, header)
+	return err == nil && sessionID != "" && subject == sessionID
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"context"
+	"nest/db"
+	"nest/models"
+	"sync"
+	"time"
+)
+
+const settingsCacheTTL = 30 * time.Second
+
+var (
+	settingsCacheMu      sync.Mutex
+	settingsCache        *models.Settings
+	settingsCacheExpires time.Time
+)
+
+// LoadSettings returns the deployment settings, served from a short-lived per-process cache
+func LoadSettings(ctx context.Context) (*models.Settings, error) {
+	settingsCacheMu.Lock()
+	defer settingsCacheMu.Unlock()
+
+	if settingsCache != nil && time.Now().Before(settingsCacheExpires) {
+		settings := *settingsCache
+		return &settings, nil
+	}
+
+	settings, err := db.GetSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cached := *settings
+	settingsCache = &cached
+	settingsCacheExpires = time.Now().Add(settingsCacheTTL)
+
+	return settings, nil
+}
+
+// InvalidateSettings drops the cached settings so the next read goes to the database
+func InvalidateSettings() {
+	settingsCacheMu.Lock()
+	settingsCache = nil
+	settingsCacheMu.Unlock()
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"errors"
+	"nest/helpers"
+	"nest/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 504 * time.Hour
+)
+
+// GenerateAccessToken signs a short-lived JWT for the user that is bound to the given session
+func GenerateAccessToken(user *models.User, sessionID string) (string, error) {
+	return SignJWT(jwt.MapClaims{
+		"user_id":  user.ID,
+		"username": user.Username,
+		"role":     user.Role,
+		"sid":      sessionID,
+		"exp":      time.Now().Add(AccessTokenTTL).Unix(),
+	})
+}
+
+// GenerateRefreshToken creates a refresh token of the form "<session id>.<secret>"
+func GenerateRefreshToken(sessionID string) (string, error) {
+	secret, err := helpers.GenerateRandomString(48)
+	if err != nil {
+		return "", err
+	}
+
+	return sessionID + "." + secret, nil
+}
+
+// ParseRefreshToken splits a refresh token into its session ID, returning an error if it is malformed
+func ParseRefreshToken(refreshToken string) (string, error) {
+	sessionID, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok || sessionID == "" || secret == "" {
+		return "", errors.New("malformed refresh token")
+	}
+
+	return sessionID, nil
+}
+
+// GenerateSignedToken signs a single-purpose token, such as an invitation link, that expires after ttl
+func GenerateSignedToken(purpose, subject string, ttl time.Duration) (string, error) {
+	return SignJWT(jwt.MapClaims{
+		"purpose": purpose,
+		"sub":     subject,
+		"exp":     time.Now().Add(ttl).Unix(),
+	})
+}
+
+// ParseSignedToken validates a token made by GenerateSignedToken for the given purpose and returns its subject
+func ParseSignedToken(purpose, tokenString string) (string, error) {
+	token, err := jwt.Parse(tokenString, JWTKeyfunc)
+	if err != nil || !token.Valid {
+		return "", errors.New("invalid or expired token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != purpose {
+		return "", errors.New("invalid token purpose")
+	}
+
+	subject, ok := claims["sub"].(string)
+	if !ok || subject == "" {
+		return "", errors.New("invalid token subject")
+	}
+
+	return subject, nil
+}
+
+// PersonalAccessTokenPrefix marks bearer tokens that are personal access tokens rather than JWTs
+const PersonalAccessTokenPrefix = "ucp_"
+
+// GeneratePersonalAccessToken creates the plaintext for a new personal access token
+func GeneratePersonalAccessToken() (string, error) {
+	secret, err := helpers.GenerateRandomString(40)
+	if err != nil {
+		return "", err
+	}
+
+	return PersonalAccessTokenPrefix + secret, nil
+}
+
+// IsPersonalAccessToken reports whether a bearer token is a personal access token
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// ImpersonationTTL is how long an SA can act as another user before requesting a new token
+const ImpersonationTTL = 15 * time.Minute
+
+// GenerateImpersonationToken signs an access token for the target user that names the acting SA in an "act" claim (RFC 8693)
+func GenerateImpersonationToken(target *models.User, actorID int, sessionID string) (string, error) {
+	return SignJWT(jwt.MapClaims{
+		"user_id":  target.ID,
+		"username": target.Username,
+		"role":     target.Role,
+		"sid":      sessionID,
+		"act":      map[string]interface{}{"sub": strconv.Itoa(actorID)},
+		"exp":      time.Now().Add(ImpersonationTTL).Unix(),
+	})
+}
+
+// ImpersonatorFromClaims returns the acting SA's ID if the token is an impersonation token
+func ImpersonatorFromClaims(claims jwt.MapClaims) (int, bool) {
+	act, ok := claims["act"].(map[string]interface{})
+	if !ok {
+		return 0, false
+	}
+
+	sub, _ := act["sub"].(string)
+	actorID, err := strconv.Atoi(sub)
+	if err != nil {
+		return 0, false
+	}
+
+	return actorID, true
+}
@@ -1,41 +1,231 @@
 package utils
 
 import (
-	"errors"
+	"encoding/json"
+	"fmt"
 	"log"
+	"maps"
 	"nest/db"
 	"nest/models"
 	"net/http"
 	"regexp"
+	"slices"
 	"strings"
+	"time"
 	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
 )
 
-// **************************************
-// USER VALIDATION
-// **************************************
-func ValidateNewUser(r *http.Request, userDTO models.UserDTO) error {
-	if !ValidateEmail(userDTO.Email) {
-		return errors.New("invalid email")
+const (
+	MaxNameLength             = 50
+	MaxEventNameLength        = 255
+	MaxEventDescriptionLength = 1000
+	MaxEventLocationLength    = 255
+	MaxGroupNameLength        = 255
+)
+
+// Codes are stable so clients can match on them, messages are meant to be shown as they are
+const (
+	ValidationRequired     = "required"
+	ValidationInvalid      = "invalid"
+	ValidationTooLong      = "too_long"
+	ValidationTaken        = "taken"
+	ValidationTooWeak      = "too_weak"
+	ValidationOutOfOrder   = "out_of_order"
+	ValidationUnknownField = "unknown_field"
+)
+
+// FieldError is one problem with one field of a request body
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	problems := make([]string, len(e))
+	for i, fieldError := range e {
+		problems[i] = fieldError.Field + ": " + fieldError.Message
+	}
+	return strings.Join(problems, "; ")
+}
+
+// WriteValidationErrors responds 422 with every problem found, so a form can highlight all of its fields at once
+func WriteValidationErrors(w http.ResponseWriter, errs ValidationErrors) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]ValidationErrors{"errors": errs})
+}
+
+// Validator collects field errors instead of stopping at the first one
+type Validator struct {
+	Errors ValidationErrors
+}
+
+func (v *Validator) Valid() bool {
+	return len(v.Errors) == 0
+}
+
+func (v *Validator) Add(field, code, message string) {
+	v.Errors = append(v.Errors, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Text checks a free text field against a length in characters, optionally refusing a blank value
+func (v *Validator) Text(field, value string, required bool, maxLength int) {
+	if required && strings.TrimSpace(value) == "" {
+		v.Add(field, ValidationRequired, "This field is required")
+		return
+	}
+	if utf8.RuneCountInString(value) > maxLength {
+		v.Add(field, ValidationTooLong, fmt.Sprintf("Must be at most %d characters", maxLength))
 	}
+}
 
-	if !ValidateName(userDTO.FirstName) {
-		return errors.New("invalid first name")
+func (v *Validator) Name(field, name string) {
+	switch {
+	case strings.TrimSpace(name) == "":
+		v.Add(field, ValidationRequired, "This field is required")
+	case utf8.RuneCountInString(NormalizeName(name)) > MaxNameLength:
+		v.Add(field, ValidationTooLong, fmt.Sprintf("Must be at most %d characters", MaxNameLength))
+	case !ValidateName(name):
+		v.Add(field, ValidationInvalid, "Must contain only letters, with words separated by a space, apostrophe or dash")
 	}
+}
 
-	if !ValidateName(userDTO.LastName) {
-		return errors.New("invalid last name")
+func (v *Validator) Email(field, email string) {
+	switch {
+	case strings.TrimSpace(email) == "":
+		v.Add(field, ValidationRequired, "This field is required")
+	case !ValidateEmail(strings.TrimSpace(email)):
+		v.Add(field, ValidationInvalid, "Must be a valid email address")
 	}
+}
 
-	if !ValidateUsername(r, userDTO.Username) {
-		return errors.New("invalid username")
+// Username checks the format and that no other account has it, exceptUserID lets a user keep or recase their own
+func (v *Validator) Username(r *http.Request, field, username string, exceptUserID int) {
+	if username == "" {
+		v.Add(field, ValidationRequired, "This field is required")
+		return
+	}
+	if !usernameRegex.MatchString(username) {
+		v.Add(field, ValidationInvalid, "Must be 3 to 30 letters, numbers, dots or underscores and start with a letter")
+		return
 	}
 
-	if !ValidatePassword(userDTO.Password) {
-		return errors.New("invalid password")
+	isTaken, err := db.IsUsernameTakenByOther(r.Context(), username, exceptUserID)
+	if err != nil {
+		log.Println("Error checking username", err)
+		v.Add(field, ValidationInvalid, "Could not check whether the username is available, please try again")
+		return
 	}
+	if isTaken {
+		v.Add(field, ValidationTaken, "This username is already taken")
+	}
+}
 
-	return nil
+func (v *Validator) Password(field, password string) {
+	switch {
+	case password == "":
+		v.Add(field, ValidationRequired, "This field is required")
+	case !ValidatePassword(password):
+		v.Add(field, ValidationTooWeak, "Must be at least 8 characters with an uppercase letter, a lowercase letter, a number and a symbol")
+	}
+}
+
+// TimeRange checks both times are set and the end isn't before the start, reporting the order on endField.
+// Routes that change a single time pass that field as both names.
+func (v *Validator) TimeRange(startField string, start time.Time, endField string, end time.Time) {
+	if start.IsZero() {
+		v.Add(startField, ValidationRequired, "This field is required")
+	}
+	if end.IsZero() {
+		v.Add(endField, ValidationRequired, "This field is required")
+	}
+	if !start.IsZero() && !end.IsZero() && start.After(end) {
+		v.Add(endField, ValidationOutOfOrder, "The end time must not be before the start time")
+	}
+}
+
+// Time parses an RFC 3339 field of an update map and replaces it with the parsed time, falling back to current when
+// the field isn't being updated. It reports false when the field is present but unusable.
+func (v *Validator) Time(updates map[string]interface{}, field string, current time.Time) (time.Time, bool) {
+	if _, present := updates[field]; !present {
+		return current, true
+	}
+
+	value, ok := v.String(updates, field)
+	if !ok {
+		return current, false
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		v.Add(field, ValidationInvalid, "Must be an RFC 3339 timestamp such as 2006-01-02T15:04:05Z")
+		return current, false
+	}
+
+	updates[field] = parsed
+	return parsed, true
+}
+
+// OnlyFields rejects fields of an update map that aren't in the allowed list
+func (v *Validator) OnlyFields(updates map[string]interface{}, allowed ...string) {
+	for _, field := range slices.Sorted(maps.Keys(updates)) {
+		if !slices.Contains(allowed, field) {
+			v.Add(field, ValidationUnknownField, "This field can't be updated")
+		}
+	}
+}
+
+// String reads a field of an update map, reporting it when the value isn't a string
+func (v *Validator) String(updates map[string]interface{}, field string) (string, bool) {
+	value, present := updates[field]
+	if !present {
+		return "", false
+	}
+	s, ok := value.(string)
+	if !ok {
+		v.Add(field, ValidationInvalid, "Must be a string")
+		return "", false
+	}
+	return s, true
+}
+
+// **************************************
+// USER VALIDATION
+// **************************************
+func ValidateNewUser(r *http.Request, userDTO models.UserDTO) ValidationErrors {
+	var v Validator
+	v.Email("email", userDTO.Email)
+	v.Name("first_name", userDTO.FirstName)
+	v.Name("last_name", userDTO.LastName)
+	v.Username(r, "username", userDTO.Username, 0)
+	v.Password("password", userDTO.Password)
+	return v.Errors
+}
+
+// ValidateUserUpdate checks a partial update of the user's account details
+func ValidateUserUpdate(r *http.Request, userID int, updates map[string]interface{}) ValidationErrors {
+	var v Validator
+	v.OnlyFields(updates, "first_name", "last_name", "email", "username")
+
+	if firstName, ok := v.String(updates, "first_name"); ok {
+		v.Name("first_name", firstName)
+	}
+	if lastName, ok := v.String(updates, "last_name"); ok {
+		v.Name("last_name", lastName)
+	}
+	if email, ok := v.String(updates, "email"); ok {
+		v.Email("email", email)
+	}
+	if username, ok := v.String(updates, "username"); ok {
+		v.Username(r, "username", username, userID)
+	}
+
+	return v.Errors
 }
 
 func ValidateEmail(email string) bool {
@@ -50,29 +240,29 @@ func ValidateEmail(email string) bool {
 	return emailRegex.MatchString(email)
 }
 
-// Alphabetic, < 50, no special chars (besides dash/space)
+// Letters in any script, at most 50 characters, words may be joined by a space, apostrophe or dash
 func ValidateName(name string) bool {
 	if len(name) < 1 {
 		return false
 	}
 
-	const nameRegexPattern = `^[a-zA-Z]+(?:[ '-][a-zA-Z]+)*$`
+	// Marks cover combining accents, so "José" passes whether or not the é is precomposed
+	const nameRegexPattern = `^[\p{L}\p{M}]+(?:[ '’-][\p{L}\p{M}]+)*$`
 
 	nameRegex := regexp.MustCompile(nameRegexPattern)
 
-	return len(name) > 0 && len(name) <= 50 && nameRegex.MatchString(name)
+	return utf8.RuneCountInString(NormalizeName(name)) <= MaxNameLength && nameRegex.MatchString(name)
 }
 
-// Alphanumeric, underscores/dots
-func ValidateUsername(r *http.Request, username string) bool {
-	if len(username) < 1 {
-		return false
-	}
-
-	const usernameRegexPattern = `^[a-zA-Z][a-zA-Z0-9._]{2,29}$`
+// NormalizeName trims a name and composes its accents, so the same name is always stored the same way
+func NormalizeName(name string) string {
+	return norm.NFC.String(strings.TrimSpace(name))
+}
 
-	usernameRegex := regexp.MustCompile(usernameRegexPattern)
+// Alphanumeric, underscores/dots
+var usernameRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9._]{2,29}$`)
 
+func ValidateUsername(r *http.Request, username string) bool {
 	if !usernameRegex.MatchString(username) {
 		return false
 	}
@@ -113,38 +303,45 @@ func ValidatePassword(password string) bool {
 // **************************************
 // EVENT VALIDATION
 // **************************************
-func ValidateNewEvent(event models.EventDTO) error {
-	if len(strings.TrimSpace(event.Name)) == 0 {
-		return errors.New("event name cannot be empty")
+func ValidateNewEvent(event models.EventDTO) ValidationErrors {
+	var v Validator
+	v.Text("name", event.Name, true, MaxEventNameLength)
+	v.Text("description", event.Description, false, MaxEventDescriptionLength)
+	v.Text("location", event.Location, false, MaxEventLocationLength)
+	v.TimeRange("start_time", event.StartTime, "end_time", event.EndTime)
+	return v.Errors
+}
+
+// ValidateEventUpdate checks a partial update of the event. Times are parsed in place so the map can be handed to
+// db.UpdateEvent, and a time that isn't being changed is taken from the event to check the order.
+func ValidateEventUpdate(event *models.Event, updates map[string]interface{}) ValidationErrors {
+	var v Validator
+	v.OnlyFields(updates, "name", "description", "location", "start_time", "end_time")
+
+	if name, ok := v.String(updates, "name"); ok {
+		v.Text("name", name, true, MaxEventNameLength)
 	}
-	if len(event.Name) > 255 {
-		return errors.New("event name cannot exceed 255 characters")
+	if description, ok := v.String(updates, "description"); ok {
+		v.Text("description", description, false, MaxEventDescriptionLength)
 	}
-
-	if len(event.Description) > 1000 {
-		return errors.New("event description cannot exceed 1000 characters")
+	if location, ok := v.String(updates, "location"); ok {
+		v.Text("location", location, false, MaxEventLocationLength)
 	}
 
-	if event.StartTime.IsZero() || event.EndTime.IsZero() {
-		return errors.New("start time and end time must be provided")
-	}
-	if event.StartTime.After(event.EndTime) {
-		return errors.New("start time cannot be after end time")
+	startTime, startValid := v.Time(updates, "start_time", event.StartTime)
+	endTime, endValid := v.Time(updates, "end_time", event.EndTime)
+	if startValid && endValid {
+		v.TimeRange("start_time", startTime, "end_time", endTime)
 	}
 
-	return nil
+	return v.Errors
 }
 
 // **************************************
 // GROUP VALIDATION
 // **************************************
-func ValidateNewGroup(group models.GroupDTO) error {
-	if len(strings.TrimSpace(group.Name)) == 0 {
-		return errors.New("group name cannot be empty")
-	}
-	if len(group.Name) > 255 {
-		return errors.New("group name cannot exceed 255 characters")
-	}
-
-	return nil
+func ValidateNewGroup(group models.GroupDTO) ValidationErrors {
+	var v Validator
+	v.Text("name", group.Name, true, MaxGroupNameLength)
+	return v.Errors
 }
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"nest/db"
+	"nest/models"
+	"net/http"
+)
+
+// UserViewFor picks how much of a user's account the caller may see
+func UserViewFor(r *http.Request, userID int) models.View {
+	if r.Context().Value("user_id").(int) == userID {
+		return models.ViewSelf
+	}
+	if IsSA(r) {
+		return models.ViewAdmin
+	}
+	return models.ViewPublic
+}
+
+// GroupViewFor picks how much of a group the caller may see from their role in it
+func GroupViewFor(r *http.Request, groupID int) models.View {
+	if IsSA(r) {
+		return models.ViewAdmin
+	}
+
+	userID := r.Context().Value("user_id").(int)
+	if isAdmin, err := db.IsUserGroupAdmin(r.Context(), userID, groupID); err == nil && isAdmin {
+		return models.ViewAdmin
+	}
+	if isMember, err := db.IsUserGroupMember(r.Context(), userID, groupID); err == nil && isMember {
+		return models.ViewSelf
+	}
+	return models.ViewPublic
+}
+
+// EventViewFor picks how much of an event the caller may see, its creator always sees all of it
+func EventViewFor(r *http.Request, event *models.Event) models.View {
+	if event.CreatedByID == int64(r.Context().Value("user_id").(int)) {
+		return models.ViewSelf
+	}
+	return GroupViewFor(r, int(event.GroupID))
+}
+
+// ViewerFor identifies the caller for queries that apply users' privacy settings
+func ViewerFor(r *http.Request) models.Viewer {
+	return models.Viewer{
+		UserID:       r.Context().Value("user_id").(int),
+		IsSuperAdmin: IsSA(r),
+	}
+}
@@ -0,0 +1,315 @@
+package utils
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"nest/models"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+// COSE algorithm identifiers for the passkey signatures we accept
+const (
+	COSEAlgES256 = -7
+	COSEAlgEdDSA = -8
+	COSEAlgRS256 = -257
+)
+
+const (
+	webAuthnFlagUserPresent  = 0x01
+	webAuthnFlagUserVerified = 0x04
+	webAuthnFlagAttestedData = 0x40
+)
+
+// ErrWebAuthnSignCount means the authenticator's counter went backwards, which points to a cloned credential
+var ErrWebAuthnSignCount = errors.New("passkey signature counter did not increase")
+
+var webAuthnConfig = struct {
+	rpID    string
+	rpName  string
+	origins []string
+}{
+	rpName: "Uccelli",
+}
+
+// InitWebAuthn reads the relying party settings. WEBAUTHN_RP_ID defaults to the web UI's host and
+// WEBAUTHN_ORIGINS, a comma separated list, defaults to AppURL.
+func InitWebAuthn() error {
+	rpID := os.Getenv("WEBAUTHN_RP_ID")
+	if rpID == "" {
+		appURL, err := url.Parse(AppURL)
+		if err != nil {
+			return fmt.Errorf("failed to parse AppURL: %w", err)
+		}
+		rpID = appURL.Hostname()
+	}
+
+	origins := []string{AppURL}
+	if env := os.Getenv("WEBAUTHN_ORIGINS"); env != "" {
+		origins = nil
+		for _, origin := range strings.Split(env, ",") {
+			if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+				origins = append(origins, origin)
+			}
+		}
+	}
+
+	webAuthnConfig.rpID = rpID
+	webAuthnConfig.origins = origins
+	return nil
+}
+
+func WebAuthnRelyingParty() models.WebAuthnRelyingParty {
+	return models.WebAuthnRelyingParty{ID: webAuthnConfig.rpID, Name: webAuthnConfig.rpName}
+}
+
+// WebAuthnCredentialParameters lists the signature algorithms passkeys may use, in order of preference
+func WebAuthnCredentialParameters() []models.WebAuthnCredentialParameter {
+	return []models.WebAuthnCredentialParameter{
+		{Type: "public-key", Algorithm: COSEAlgES256},
+		{Type: "public-key", Algorithm: COSEAlgEdDSA},
+		{Type: "public-key", Algorithm: COSEAlgRS256},
+	}
+}
+
+type webAuthnClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// WebAuthnChallenge checks the client data's ceremony type and origin and returns the challenge it signed,
+// so the caller can look up and consume the challenge it issued
+func WebAuthnChallenge(clientDataJSON []byte, ceremony string) (string, error) {
+	var clientData webAuthnClientData
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return "", fmt.Errorf("invalid client data: %w", err)
+	}
+
+	if clientData.Type != ceremony {
+		return "", fmt.Errorf("unexpected ceremony type %q", clientData.Type)
+	}
+	if !slices.Contains(webAuthnConfig.origins, clientData.Origin) {
+		return "", fmt.Errorf("unexpected origin %q", clientData.Origin)
+	}
+	if clientData.Challenge == "" {
+		return "", errors.New("client data has no challenge")
+	}
+
+	return clientData.Challenge, nil
+}
+
+type webAuthnAuthenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+func parseWebAuthnAuthenticatorData(data []byte) (*webAuthnAuthenticatorData, error) {
+	if len(data) < 37 {
+		return nil, errors.New("authenticator data is too short")
+	}
+
+	authData := &webAuthnAuthenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+
+	if authData.flags&webAuthnFlagAttestedData != 0 {
+		rest := data[37:]
+		// AAGUID then a two byte credential ID length
+		if len(rest) < 18 {
+			return nil, errors.New("attested credential data is too short")
+		}
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < idLength {
+			return nil, errors.New("credential ID is truncated")
+		}
+		authData.credentialID = rest[:idLength]
+		rest = rest[idLength:]
+
+		// The COSE key is followed by optional extensions, so measure it by decoding it
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid credential public key: %w", err)
+		}
+		authData.publicKey = rest[:len(rest)-len(after)]
+	}
+
+	return authData, nil
+}
+
+// checkRelyingParty verifies the authenticator data was made for this site with the user present
+func (a *webAuthnAuthenticatorData) checkRelyingParty() error {
+	expected := sha256.Sum256([]byte(webAuthnConfig.rpID))
+	if !bytes.Equal(a.rpIDHash, expected[:]) {
+		return errors.New("relying party ID mismatch")
+	}
+	if a.flags&webAuthnFlagUserPresent == 0 {
+		return errors.New("user was not present")
+	}
+	return nil
+}
+
+// WebAuthnRegistration is a newly created passkey that passed verification
+type WebAuthnRegistration struct {
+	CredentialID []byte
+	PublicKey    []byte
+	SignCount    uint32
+}
+
+// VerifyWebAuthnRegistration checks an attestation for this relying party and extracts the new credential.
+// We ask for no attestation, so any attestation statement is ignored rather than verified against a trust root.
+func VerifyWebAuthnRegistration(attestationObject []byte) (*WebAuthnRegistration, error) {
+	decoded, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation object: %w", err)
+	}
+
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("attestation object is not a map")
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("attestation object has no authenticator data")
+	}
+
+	authData, err := parseWebAuthnAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := authData.checkRelyingParty(); err != nil {
+		return nil, err
+	}
+	if authData.credentialID == nil {
+		return nil, errors.New("attestation has no credential")
+	}
+
+	if _, _, err := parseCOSEKey(authData.publicKey); err != nil {
+		return nil, err
+	}
+
+	return &WebAuthnRegistration{
+		CredentialID: authData.credentialID,
+		PublicKey:    authData.publicKey,
+		SignCount:    authData.signCount,
+	}, nil
+}
+
+// VerifyWebAuthnAssertion checks a sign in signature against the stored credential and returns the new counter
+// value and whether the authenticator verified the user, for example with a PIN or biometric
+func VerifyWebAuthnAssertion(credential *models.WebAuthnCredential, clientDataJSON, authenticatorData, signature []byte) (uint32, bool, error) {
+	authData, err := parseWebAuthnAuthenticatorData(authenticatorData)
+	if err != nil {
+		return 0, false, err
+	}
+	if err := authData.checkRelyingParty(); err != nil {
+		return 0, false, err
+	}
+
+	publicKey, algorithm, err := parseCOSEKey(credential.PublicKey)
+	if err != nil {
+		return 0, false, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), authenticatorData...), clientDataHash[:]...)
+
+	if err := verifyCOSESignature(publicKey, algorithm, signed, signature); err != nil {
+		return 0, false, err
+	}
+
+	// Authenticators that don't keep a counter always report zero
+	if (authData.signCount != 0 || credential.SignCount != 0) && authData.signCount <= credential.SignCount {
+		return 0, false, ErrWebAuthnSignCount
+	}
+
+	return authData.signCount, authData.flags&webAuthnFlagUserVerified != 0, nil
+}
+
+// parseCOSEKey reads a COSE_Key (RFC 9053) for one of the algorithms we accept
+func parseCOSEKey(data []byte) (crypto.PublicKey, int64, error) {
+	decoded, _, err := decodeCBOR(data)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid COSE key: %w", err)
+	}
+
+	key, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, 0, errors.New("COSE key is not a map")
+	}
+
+	keyType, _ := key[int64(1)].(int64)
+	algorithm, _ := key[int64(3)].(int64)
+
+	switch {
+	case keyType == 2 && algorithm == COSEAlgES256:
+		curve, _ := key[int64(-1)].(int64)
+		x, _ := key[int64(-2)].([]byte)
+		y, _ := key[int64(-3)].([]byte)
+		if curve != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, 0, errors.New("invalid P-256 key")
+		}
+		publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !publicKey.Curve.IsOnCurve(publicKey.X, publicKey.Y) {
+			return nil, 0, errors.New("P-256 key is not on the curve")
+		}
+		return publicKey, algorithm, nil
+	case keyType == 1 && algorithm == COSEAlgEdDSA:
+		curve, _ := key[int64(-1)].(int64)
+		x, _ := key[int64(-2)].([]byte)
+		if curve != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, 0, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), algorithm, nil
+	case keyType == 3 && algorithm == COSEAlgRS256:
+		n, _ := key[int64(-1)].([]byte)
+		e, _ := key[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, 0, errors.New("invalid RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, algorithm, nil
+	}
+
+	return nil, 0, fmt.Errorf("unsupported COSE key type %d with algorithm %d", keyType, algorithm)
+}
+
+func verifyCOSESignature(publicKey crypto.PublicKey, algorithm int64, signed, signature []byte) error {
+	digest := sha256.Sum256(signed)
+
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		if ecdsa.VerifyASN1(key, digest[:], signature) {
+			return nil
+		}
+	case ed25519.PublicKey:
+		if ed25519.Verify(key, signed, signature) {
+			return nil
+		}
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil {
+			return nil
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm %d", algorithm)
+	}
+
+	return errors.New("invalid passkey signature")
+}
@@ -0,0 +1,283 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"nest/models"
+	"testing"
+)
+
+const (
+	testRPID   = "nest.example"
+	testOrigin = "https://nest.example"
+)
+
+// cborPairs is a CBOR map whose entries are encoded in the given order
+type cborPairs [][2]interface{}
+
+// encodeTestCBOR covers the few CBOR types a software authenticator needs to produce
+func encodeTestCBOR(value interface{}) []byte {
+	header := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n < 1<<8:
+			return []byte{major<<5 | 24, byte(n)}
+		case n < 1<<16:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		default:
+			return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+		}
+	}
+
+	switch v := value.(type) {
+	case int:
+		if v < 0 {
+			return header(1, uint64(-1-v))
+		}
+		return header(0, uint64(v))
+	case []byte:
+		return append(header(2, uint64(len(v))), v...)
+	case string:
+		return append(header(3, uint64(len(v))), v...)
+	case cborPairs:
+		encoded := header(5, uint64(len(v)))
+		for _, pair := range v {
+			encoded = append(encoded, encodeTestCBOR(pair[0])...)
+			encoded = append(encoded, encodeTestCBOR(pair[1])...)
+		}
+		return encoded
+	}
+	panic("unsupported CBOR value")
+}
+
+// softwareAuthenticator plays the part of a platform authenticator holding one ES256 passkey
+type softwareAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	signCount    uint32
+	rpID         string
+}
+
+func newSoftwareAuthenticator(t *testing.T) *softwareAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	credentialID := make([]byte, 16)
+	rand.Read(credentialID)
+
+	return &softwareAuthenticator{key: key, credentialID: credentialID, rpID: testRPID}
+}
+
+func (a *softwareAuthenticator) coseKey() []byte {
+	x := a.key.PublicKey.X.FillBytes(make([]byte, 32))
+	y := a.key.PublicKey.Y.FillBytes(make([]byte, 32))
+	return encodeTestCBOR(cborPairs{{1, 2}, {3, COSEAlgES256}, {-1, 1}, {-2, x}, {-3, y}})
+}
+
+func (a *softwareAuthenticator) authenticatorData(flags byte, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+
+	if attested {
+		data = append(data, make([]byte, 16)...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+		data = append(data, a.credentialID...)
+		data = append(data, a.coseKey()...)
+	}
+	return data
+}
+
+func testClientData(ceremony, challenge string) []byte {
+	clientData, _ := json.Marshal(map[string]string{"type": ceremony, "challenge": challenge, "origin": testOrigin})
+	return clientData
+}
+
+// register answers navigator.credentials.create() and returns the client data and attestation object
+func (a *softwareAuthenticator) register(challenge string) ([]byte, []byte) {
+	authData := a.authenticatorData(webAuthnFlagUserPresent|webAuthnFlagUserVerified|webAuthnFlagAttestedData, true)
+	attestation := encodeTestCBOR(cborPairs{{"fmt", "none"}, {"attStmt", cborPairs{}}, {"authData", authData}})
+	return testClientData("webauthn.create", challenge), attestation
+}
+
+// assert answers navigator.credentials.get(), counting the signature like a real authenticator does
+func (a *softwareAuthenticator) assert(t *testing.T, challenge string, flags byte) (clientData, authData, signature []byte) {
+	t.Helper()
+
+	a.signCount++
+	clientData = testClientData("webauthn.get", challenge)
+	authData = a.authenticatorData(flags, false)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatalf("failed to sign assertion: %v", err)
+	}
+	return clientData, authData, signature
+}
+
+func useTestRelyingParty(t *testing.T) {
+	t.Helper()
+
+	previous := webAuthnConfig
+	webAuthnConfig.rpID = testRPID
+	webAuthnConfig.origins = []string{testOrigin}
+	t.Cleanup(func() { webAuthnConfig = previous })
+}
+
+func newTestChallenge() string {
+	challenge := make([]byte, 32)
+	rand.Read(challenge)
+	return base64.RawURLEncoding.EncodeToString(challenge)
+}
+
+// registerTestPasskey runs the registration ceremony and returns the credential as it would be stored
+func registerTestPasskey(t *testing.T, authenticator *softwareAuthenticator) *models.WebAuthnCredential {
+	t.Helper()
+
+	challenge := newTestChallenge()
+	clientData, attestation := authenticator.register(challenge)
+
+	signed, err := WebAuthnChallenge(clientData, "webauthn.create")
+	if err != nil || signed != challenge {
+		t.Fatalf("registration challenge = %q, %v, want %q", signed, err, challenge)
+	}
+
+	registration, err := VerifyWebAuthnRegistration(attestation)
+	if err != nil {
+		t.Fatalf("registration failed: %v", err)
+	}
+
+	return &models.WebAuthnCredential{
+		CredentialID: registration.CredentialID,
+		PublicKey:    registration.PublicKey,
+		SignCount:    registration.SignCount,
+	}
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	useTestRelyingParty(t)
+	authenticator := newSoftwareAuthenticator(t)
+
+	credential := registerTestPasskey(t, authenticator)
+	if string(credential.CredentialID) != string(authenticator.credentialID) {
+		t.Fatalf("registered credential ID %x, want %x", credential.CredentialID, authenticator.credentialID)
+	}
+
+	for _, test := range []struct {
+		name             string
+		flags            byte
+		wantUserVerified bool
+	}{
+		{"user verified", webAuthnFlagUserPresent | webAuthnFlagUserVerified, true},
+		{"user present only", webAuthnFlagUserPresent, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			challenge := newTestChallenge()
+			clientData, authData, signature := authenticator.assert(t, challenge, test.flags)
+
+			signed, err := WebAuthnChallenge(clientData, "webauthn.get")
+			if err != nil || signed != challenge {
+				t.Fatalf("login challenge = %q, %v, want %q", signed, err, challenge)
+			}
+
+			signCount, userVerified, err := VerifyWebAuthnAssertion(credential, clientData, authData, signature)
+			if err != nil {
+				t.Fatalf("login failed: %v", err)
+			}
+			if signCount != authenticator.signCount || userVerified != test.wantUserVerified {
+				t.Fatalf("got counter %d verified %v, want %d %v", signCount, userVerified, authenticator.signCount, test.wantUserVerified)
+			}
+			credential.SignCount = signCount
+		})
+	}
+}
+
+func TestPasskeyLoginRejectsStaleSignCount(t *testing.T) {
+	useTestRelyingParty(t)
+	authenticator := newSoftwareAuthenticator(t)
+	credential := registerTestPasskey(t, authenticator)
+
+	clientData, authData, signature := authenticator.assert(t, newTestChallenge(), webAuthnFlagUserPresent)
+	signCount, _, err := VerifyWebAuthnAssertion(credential, clientData, authData, signature)
+	if err != nil {
+		t.Fatalf("first login failed: %v", err)
+	}
+	credential.SignCount = signCount
+
+	// Replaying the same assertion presents a counter that was already seen
+	if _, _, err := VerifyWebAuthnAssertion(credential, clientData, authData, signature); !errors.Is(err, ErrWebAuthnSignCount) {
+		t.Fatalf("replayed assertion: got %v, want ErrWebAuthnSignCount", err)
+	}
+
+	// So does a clone of the authenticator that is behind the stored counter
+	credential.SignCount = authenticator.signCount + 5
+	clientData, authData, signature = authenticator.assert(t, newTestChallenge(), webAuthnFlagUserPresent)
+	if _, _, err := VerifyWebAuthnAssertion(credential, clientData, authData, signature); !errors.Is(err, ErrWebAuthnSignCount) {
+		t.Fatalf("stale counter: got %v, want ErrWebAuthnSignCount", err)
+	}
+}
+
+func TestPasskeyCeremonyRejections(t *testing.T) {
+	useTestRelyingParty(t)
+	authenticator := newSoftwareAuthenticator(t)
+	credential := registerTestPasskey(t, authenticator)
+
+	t.Run("wrong ceremony type", func(t *testing.T) {
+		clientData, _ := authenticator.register(newTestChallenge())
+		if _, err := WebAuthnChallenge(clientData, "webauthn.get"); err == nil {
+			t.Fatal("registration client data was accepted for a login")
+		}
+	})
+
+	t.Run("wrong origin", func(t *testing.T) {
+		clientData, _ := json.Marshal(map[string]string{"type": "webauthn.get", "challenge": newTestChallenge(), "origin": "https://evil.example"})
+		if _, err := WebAuthnChallenge(clientData, "webauthn.get"); err == nil {
+			t.Fatal("client data from another origin was accepted")
+		}
+	})
+
+	t.Run("registration for another relying party", func(t *testing.T) {
+		other := newSoftwareAuthenticator(t)
+		other.rpID = "evil.example"
+		_, attestation := other.register(newTestChallenge())
+		if _, err := VerifyWebAuthnRegistration(attestation); err == nil {
+			t.Fatal("attestation for another relying party was accepted")
+		}
+	})
+
+	t.Run("user not present", func(t *testing.T) {
+		clientData, authData, signature := authenticator.assert(t, newTestChallenge(), 0)
+		if _, _, err := VerifyWebAuthnAssertion(credential, clientData, authData, signature); err == nil {
+			t.Fatal("assertion without user presence was accepted")
+		}
+	})
+
+	t.Run("tampered client data", func(t *testing.T) {
+		_, authData, signature := authenticator.assert(t, newTestChallenge(), webAuthnFlagUserPresent)
+		clientData := testClientData("webauthn.get", newTestChallenge())
+		if _, _, err := VerifyWebAuthnAssertion(credential, clientData, authData, signature); err == nil {
+			t.Fatal("signature over different client data was accepted")
+		}
+	})
+
+	t.Run("signed by another key", func(t *testing.T) {
+		other := newSoftwareAuthenticator(t)
+		other.signCount = authenticator.signCount + 10
+		clientData, authData, signature := other.assert(t, newTestChallenge(), webAuthnFlagUserPresent)
+		if _, _, err := VerifyWebAuthnAssertion(credential, clientData, authData, signature); err == nil {
+			t.Fatal("assertion signed by another key was accepted")
+		}
+	})
+}